@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// renameFile is os.Rename, replaced in tests to simulate a rename across
+// devices.
+var renameFile = os.Rename
+
+// writeFileAtomic writes through write into a temporary file next to path,
+// syncs it and renames it into place, so an interrupted save never leaves a
+// partly written file behind. If the rename crosses devices, the temporary
+// file is copied into a second one beside path, which is renamed instead.
+func writeFileAtomic(path string, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := syncAndClose(tmp); err != nil {
+		return err
+	}
+	err = renameFile(tmp.Name(), path)
+	if errors.Is(err, syscall.EXDEV) {
+		return copyFileAtomic(tmp.Name(), path)
+	}
+	return err
+}
+
+// copyFileAtomic copies src into a temporary file in dst's directory and
+// renames that into place, leaving dst untouched if any step fails.
+func copyFileAtomic(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*.copy")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(out.Name())
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := syncAndClose(out); err != nil {
+		return err
+	}
+	return renameFile(out.Name(), dst)
+}
+
+// syncAndClose flushes a temporary file to disk before it is renamed, so a
+// crash cannot leave the new name pointing at unwritten data.
+func syncAndClose(f *os.File) error {
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
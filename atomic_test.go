@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// checkAtomicWrite checks that path holds want and no temporary file is
+// left beside it.
+func checkAtomicWrite(t *testing.T, path, want string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != want {
+		t.Errorf("%s holds %q, want %q", path, data, want)
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d entries, want only %s", len(entries), filepath.Base(path))
+	}
+}
+
+func writeString(s string) func(io.Writer) error {
+	return func(w io.Writer) error {
+		_, err := io.WriteString(w, s)
+		return err
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.csv")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(path, writeString("new")); err != nil {
+		t.Fatal(err)
+	}
+	checkAtomicWrite(t, path, "new")
+
+	failure := errors.New("disk full")
+	err := writeFileAtomic(path, func(w io.Writer) error {
+		io.WriteString(w, "partial")
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("got error %v, want %v", err, failure)
+	}
+	checkAtomicWrite(t, path, "new")
+}
+
+// TestWriteFileAtomicCrossDevice checks that when the first rename fails
+// with EXDEV the file is still replaced by a rename, never written in place.
+func TestWriteFileAtomicCrossDevice(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.csv")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var renamed []string
+	defer func() { renameFile = os.Rename }()
+	renameFile = func(oldpath, newpath string) error {
+		renamed = append(renamed, filepath.Ext(oldpath))
+		if len(renamed) == 1 {
+			return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+		}
+		return os.Rename(oldpath, newpath)
+	}
+
+	if err := writeFileAtomic(path, writeString("new")); err != nil {
+		t.Fatal(err)
+	}
+	checkAtomicWrite(t, path, "new")
+	if len(renamed) != 2 || renamed[1] != ".copy" {
+		t.Errorf("renamed %v, want the .tmp file and then its .copy", renamed)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/template"
+)
+
+// badgeColors maps the lowest coverage that earns a color to the color, in
+// the same scale as the usual README coverage badges.
+var badgeColors = []struct {
+	min   float64
+	color string
+}{
+	{90, "#4c1"},
+	{80, "#97ca00"},
+	{70, "#a4a61d"},
+	{60, "#dfb317"},
+	{50, "#fe7d37"},
+	{0, "#e05d44"},
+}
+
+var badgeTemplate = template.Must(template.New("badge").Parse(`<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="20" role="img" aria-label="{{html .Label}}: {{.Value}}">
+  <title>{{html .Label}}: {{.Value}}</title>
+  <linearGradient id="s" x2="0" y2="100%">
+    <stop offset="0" stop-color="#bbb" stop-opacity=".1"/>
+    <stop offset="1" stop-opacity=".1"/>
+  </linearGradient>
+  <clipPath id="r">
+    <rect width="{{.Width}}" height="20" rx="3" fill="#fff"/>
+  </clipPath>
+  <g clip-path="url(#r)">
+    <rect width="{{.LabelWidth}}" height="20" fill="#555"/>
+    <rect x="{{.LabelWidth}}" width="{{.ValueWidth}}" height="20" fill="{{.Color}}"/>
+    <rect width="{{.Width}}" height="20" fill="url(#s)"/>
+  </g>
+  <g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+    <text x="{{.LabelX}}" y="15" fill="#010101" fill-opacity=".3">{{html .Label}}</text>
+    <text x="{{.LabelX}}" y="14">{{html .Label}}</text>
+    <text x="{{.ValueX}}" y="15" fill="#010101" fill-opacity=".3">{{.Value}}</text>
+    <text x="{{.ValueX}}" y="14">{{.Value}}</text>
+  </g>
+</svg>
+`))
+
+// writeBadge writes an SVG badge showing label and coverage, colored by
+// badgeColors. Text widths are estimated at 7 pixels a character, which
+// fits Verdana at 11px closely enough without measuring fonts.
+func writeBadge(file, label string, coverage float64, precision int) error {
+	value := fmt.Sprintf("%.*f%%", precision, coverage)
+	color := badgeColors[len(badgeColors)-1].color
+	for _, c := range badgeColors {
+		if coverage >= c.min {
+			color = c.color
+			break
+		}
+	}
+	labelWidth := 7*len([]rune(label)) + 10
+	valueWidth := 7*len(value) + 10
+	data := map[string]interface{}{
+		"Label":      label,
+		"Value":      value,
+		"Color":      color,
+		"Width":      labelWidth + valueWidth,
+		"LabelWidth": labelWidth,
+		"ValueWidth": valueWidth,
+		"LabelX":     float64(labelWidth) / 2,
+		"ValueX":     float64(labelWidth) + float64(valueWidth)/2,
+	}
+	return writeFileAtomic(file, func(w io.Writer) error {
+		if err := badgeTemplate.Execute(w, data); err != nil {
+			return fmt.Errorf("failed to render badge: %w", err)
+		}
+		return nil
+	})
+}
+
+// saveBadge writes the -badge for the aggregate coverage, the initial one
+// under -measure-only.
+func saveBadge(cfg *Config, summary *Summary) {
+	if cfg.Badge == "" {
+		return
+	}
+	coverage := summary.FinalCoverage()
+	if cfg.MeasureOnly {
+		coverage = summary.InitialCoverage()
+	}
+	if err := writeBadge(cfg.Badge, cfg.BadgeLabel, coverage, cfg.Precision); err != nil {
+		fmt.Println("Failed to write badge:", err)
+	} else {
+		fmt.Printf("Badge saved as %s\n", cfg.Badge)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestWriteBadge checks the badge is well-formed SVG with the escaped label,
+// the rounded coverage and the color of its threshold.
+func TestWriteBadge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "badge.svg")
+	for _, tc := range []struct {
+		coverage float64
+		value    string
+		color    string
+	}{
+		{95.04, "95.0%", "#4c1"},
+		{80, "80.0%", "#97ca00"},
+		{12.5, "12.5%", "#e05d44"},
+	} {
+		if err := writeBadge(path, "tests & coverage", tc.coverage, 1); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := xml.Unmarshal(data, new(struct{})); err != nil {
+			t.Errorf("%v%%: badge is not valid XML: %v", tc.coverage, err)
+		}
+		svg := string(data)
+		for _, want := range []string{">tests &amp; coverage<", ">" + tc.value + "<", `fill="` + tc.color + `"`} {
+			if !strings.Contains(svg, want) {
+				t.Errorf("%v%%: badge lacks %s:\n%s", tc.coverage, want, svg)
+			}
+		}
+	}
+}
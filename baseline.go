@@ -0,0 +1,52 @@
+package main
+
+import "fmt"
+
+// loadBaseline reads the -baseline report, nil without one.
+func loadBaseline(cfg *Config) ([]ReportRow, error) {
+	if cfg.Baseline == "" {
+		return nil, nil
+	}
+	return readReport(cfg.Baseline)
+}
+
+// compareBaseline prints the coverage change of each file against a prior
+// report and returns the number of files whose final coverage dropped by
+// more than threshold percentage points. Files are matched by root and
+// relative path, with the baseline's paths normalized to the same
+// -path-style.
+func compareBaseline(results []Result, baseline []ReportRow, threshold float64, pathStyle string) int {
+	previous := make(map[string]float64, len(baseline))
+	for _, row := range baseline {
+		previous[row["root"]+"\x00"+normalizePath(row["path"], pathStyle)] = toFloat(row["final_coverage"])
+	}
+
+	fmt.Println("Coverage compared to baseline:")
+	regressions := 0
+	for _, r := range results {
+		name := r.Path
+		if r.Root != "" {
+			name = r.Root + "/" + r.Path
+		}
+		if r.Status == statusUnsupported || r.Status == statusIncomplete {
+			fmt.Printf("  %s: %s\n", name, r.Status)
+			continue
+		}
+		before, ok := previous[r.Root+"\x00"+r.Path]
+		if !ok {
+			fmt.Printf("  %s: %.2f%% (not in baseline)\n", name, r.Metrics.FinalCoverage)
+			continue
+		}
+		change := r.Metrics.FinalCoverage - before
+		marker := ""
+		if change < -threshold {
+			marker = red("  REGRESSION")
+			regressions++
+		}
+		fmt.Printf("  %s: %s (%+.2f)%s\n", name, coverageChange(before, r.Metrics.FinalCoverage), change, marker)
+	}
+	if regressions > 0 {
+		fmt.Printf("%d file(s) regressed against the baseline\n", regressions)
+	}
+	return regressions
+}
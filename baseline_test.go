@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+// TestCompareBaseline checks that only drops beyond -regression-threshold
+// count, with baseline paths matched by root under the same -path-style.
+func TestCompareBaseline(t *testing.T) {
+	baseline := []ReportRow{
+		{"path": "a.py", "final_coverage": "80"},
+		{"path": "b.py", "final_coverage": "80"},
+		{"path": `pkg\c.py`, "final_coverage": "80"},
+		{"root": "other", "path": "d.py", "final_coverage": "80"},
+	}
+	results := []Result{
+		{Path: "a.py", Status: statusOK, Metrics: Metrics{FinalCoverage: 75}},
+		{Path: "b.py", Status: statusOK, Metrics: Metrics{FinalCoverage: 79.5}},
+		{Path: "pkg/c.py", Status: statusOK, Metrics: Metrics{FinalCoverage: 70}},
+		{Path: "d.py", Status: statusOK, Metrics: Metrics{FinalCoverage: 10}},
+		{Path: "e.py", Status: statusIncomplete},
+	}
+	if got := compareBaseline(results, baseline, 1, "unix"); got != 2 {
+		t.Errorf("got %d regressions, want 2 (a.py and pkg/c.py)", got)
+	}
+	if got := compareBaseline(results, baseline, 1, "native"); got != 1 {
+		t.Errorf("native -path-style: got %d regressions, want 1 (a.py)", got)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// batchWindow is how long a partly filled batch waits for more files.
+const batchWindow = 100 * time.Millisecond
+
+// batchTransport packs the requests that workers make at about the same
+// time, up to -batch-size, into one request whose sourceFilePaths lists
+// every file. The server tags each event with its sourceFilePath, which
+// routes it back to the file's stream. If the server sends untagged events
+// it does not batch, so batching is switched off for the rest of the run
+// and every file is requested on its own. A batch that fails to send fails
+// each of its files, which are then retried like any other request.
+type batchTransport struct {
+	next Transport
+	size int
+
+	mu          sync.Mutex
+	pending     []*batchedRequest
+	timer       *time.Timer
+	unsupported atomic.Bool
+}
+
+type batchedRequest struct {
+	ctx    context.Context
+	req    GenerateTestRequest
+	events chan StreamEvent
+}
+
+func newBatchTransport(next Transport, size int) *batchTransport {
+	return &batchTransport{next: next, size: size}
+}
+
+func (t *batchTransport) Stream(ctx context.Context, req GenerateTestRequest) (<-chan StreamEvent, error) {
+	if t.unsupported.Load() {
+		return t.next.Stream(ctx, req)
+	}
+	br := &batchedRequest{ctx: ctx, req: req, events: make(chan StreamEvent)}
+	t.mu.Lock()
+	t.pending = append(t.pending, br)
+	if len(t.pending) >= t.size {
+		t.flushLocked()
+	} else if t.timer == nil {
+		t.timer = time.AfterFunc(batchWindow, func() {
+			t.mu.Lock()
+			t.flushLocked()
+			t.mu.Unlock()
+		})
+	}
+	t.mu.Unlock()
+	return br.events, nil
+}
+
+func (t *batchTransport) flushLocked() {
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	batch := t.pending
+	t.pending = nil
+	if len(batch) > 0 {
+		go t.send(batch)
+	}
+}
+
+// send streams a batch and demultiplexes its events. A batch of one is
+// sent as a plain request.
+func (t *batchTransport) send(batch []*batchedRequest) {
+	if len(batch) == 1 || t.unsupported.Load() {
+		t.sendEach(batch)
+		return
+	}
+	req := batch[0].req
+	byPath := make(map[string]*batchedRequest, len(batch))
+	for _, br := range batch {
+		req.Files = append(req.Files, br.req.SrcFilePath)
+		byPath[br.req.SrcFilePath] = br
+	}
+	debugf("sending a batch of %d files", len(batch))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := t.next.Stream(ctx, req)
+	if err != nil {
+		for _, br := range batch {
+			emit(br.ctx, br.events, StreamEvent{Err: err})
+			close(br.events)
+		}
+		return
+	}
+
+	open := make(map[*batchedRequest]bool, len(batch))
+	for _, br := range batch {
+		open[br] = true
+	}
+	routed := false
+	for e := range events {
+		if e.Err != nil {
+			for br := range open {
+				emit(br.ctx, br.events, e)
+			}
+			break
+		}
+		if e.Header {
+			for br := range open {
+				emit(br.ctx, br.events, e)
+			}
+			continue
+		}
+		br, ok := byPath[eventString(e.Fields, "sourceFilePath")]
+		if !ok && !routed {
+			cancel()
+			t.fallBack(batch, "events carry no sourceFilePath")
+			return
+		}
+		if !ok {
+			debugf("dropping batch event for an unknown file: %v", e.Fields)
+			continue
+		}
+		routed = true
+		// A file whose reader stopped, as under -stop-at-expected, gets
+		// no more events; the others keep reading.
+		if open[br] && !emit(br.ctx, br.events, e) {
+			delete(open, br)
+			close(br.events)
+			if len(open) == 0 {
+				return
+			}
+		}
+	}
+	for br := range open {
+		close(br.events)
+	}
+}
+
+// fallBack switches batching off and requests the batch's files one by one.
+func (t *batchTransport) fallBack(batch []*batchedRequest, reason string) {
+	if !t.unsupported.Swap(true) {
+		fmt.Printf("Warning: the server does not support batches (%s); requesting files one at a time\n", reason)
+	}
+	t.sendEach(batch)
+}
+
+func (t *batchTransport) sendEach(batch []*batchedRequest) {
+	for _, br := range batch {
+		go func(br *batchedRequest) {
+			defer close(br.events)
+			events, err := t.next.Stream(br.ctx, br.req)
+			if err != nil {
+				emit(br.ctx, br.events, StreamEvent{Err: err})
+				return
+			}
+			for e := range events {
+				if !emit(br.ctx, br.events, e) {
+					return
+				}
+			}
+		}(br)
+	}
+}
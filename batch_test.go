@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingTransport answers each request with respond, recording the
+// files of every request it sees.
+type recordingTransport struct {
+	mu       sync.Mutex
+	requests [][]string
+	respond  func(req GenerateTestRequest) ([]StreamEvent, error)
+}
+
+func (t *recordingTransport) Stream(ctx context.Context, req GenerateTestRequest) (<-chan StreamEvent, error) {
+	t.mu.Lock()
+	t.requests = append(t.requests, append([]string{req.SrcFilePath}, req.Files...))
+	t.mu.Unlock()
+	events, err := t.respond(req)
+	if err != nil {
+		return nil, err
+	}
+	return fakeTransport{events}.Stream(ctx, req)
+}
+
+func taggedSummary(file, final string) StreamEvent {
+	return StreamEvent{Fields: map[string]interface{}{"dataType": "summary", "sourceFilePath": file, "coverageIncreased": "Coverage increased to " + final + "%", "linesCovered": "5", "totalLines": "10", "testAdded": "1"}}
+}
+
+// streamBatch streams files through a batch transport as concurrent
+// workers would, returning each file's metrics and error.
+func streamBatch(next Transport, files ...string) (*batchTransport, []Metrics, []error) {
+	transport := newBatchTransport(next, len(files))
+	cfg := &Config{transport: transport}
+	metrics := make([]Metrics, len(files))
+	errs := make([]error, len(files))
+	var wg sync.WaitGroup
+	for i, file := range files {
+		wg.Add(1)
+		go func(i int, file string) {
+			defer wg.Done()
+			metrics[i], errs[i] = streamMetrics(cfg, GenerateTestRequest{SrcFilePath: file})
+		}(i, file)
+	}
+	wg.Wait()
+	return transport, metrics, errs
+}
+
+func TestBatchTransportRoutesEvents(t *testing.T) {
+	next := &recordingTransport{respond: func(req GenerateTestRequest) ([]StreamEvent, error) {
+		return []StreamEvent{taggedSummary("b.py", "70"), taggedSummary("a.py", "60")}, nil
+	}}
+	_, metrics, errs := streamBatch(next, "a.py", "b.py")
+	if len(next.requests) != 1 || len(next.requests[0]) != 3 {
+		t.Fatalf("sent requests %v, want one batch of both files", next.requests)
+	}
+	for i, want := range []float64{60, 70} {
+		if errs[i] != nil || metrics[i].FinalCoverage != want {
+			t.Errorf("file %d: got %+v, error %v, want final coverage %v", i, metrics[i], errs[i], want)
+		}
+	}
+}
+
+// TestBatchTransportFailedBatch checks that a batch that fails to send
+// fails its files without switching batching off.
+func TestBatchTransportFailedBatch(t *testing.T) {
+	failure := errors.New("connection refused")
+	next := &recordingTransport{respond: func(GenerateTestRequest) ([]StreamEvent, error) { return nil, failure }}
+	transport, _, errs := streamBatch(next, "a.py", "b.py")
+	for i, err := range errs {
+		if !errors.Is(err, failure) {
+			t.Errorf("file %d: got error %v, want %v", i, err, failure)
+		}
+	}
+	if len(next.requests) != 1 || transport.unsupported.Load() {
+		t.Errorf("sent requests %v and switched batching off: %v", next.requests, transport.unsupported.Load())
+	}
+}
+
+// TestBatchTransportUntaggedEvents checks that a server that answers a
+// batch with untagged events gets each file on its own.
+func TestBatchTransportUntaggedEvents(t *testing.T) {
+	next := &recordingTransport{respond: func(req GenerateTestRequest) ([]StreamEvent, error) {
+		final := "60"
+		if strings.HasPrefix(req.SrcFilePath, "b") {
+			final = "70"
+		}
+		return []StreamEvent{coverageEvent("10%"), {Fields: map[string]interface{}{"dataType": "summary", "coverageIncreased": "Coverage increased to " + final + "%", "linesCovered": "5", "totalLines": "10", "testAdded": "1"}}}, nil
+	}}
+	transport, metrics, errs := streamBatch(next, "a.py", "b.py")
+	if !transport.unsupported.Load() || len(next.requests) != 3 {
+		t.Errorf("sent requests %v, want a batch followed by one request per file", next.requests)
+	}
+	for i, want := range []float64{60, 70} {
+		if errs[i] != nil || metrics[i].FinalCoverage != want {
+			t.Errorf("file %d: got %+v, error %v, want final coverage %v", i, metrics[i], errs[i], want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// newHTTPClient builds the client shared by every request. Proxies come from
+// HTTP_PROXY/HTTPS_PROXY/NO_PROXY unless -proxy overrides them; NO_PROXY is
+// honored either way, and loopback addresses are never proxied. With
+// -no-follow-redirects a redirect is returned as the response, so a
+// misconfigured endpoint fails instead of silently posting elsewhere.
+func newHTTPClient(cfg *Config) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxyFunc(cfg.Proxy)
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   cfg.Timeout, // Zero by default to allow long-lived streaming
+	}
+	if cfg.NoFollowRedirects {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+	return client
+}
+
+func proxyFunc(proxy string) func(*http.Request) (*url.URL, error) {
+	if proxy == "" {
+		return http.ProxyFromEnvironment
+	}
+	noProxy := os.Getenv("NO_PROXY")
+	if noProxy == "" {
+		noProxy = os.Getenv("no_proxy")
+	}
+	resolve := (&httpproxy.Config{HTTPProxy: proxy, HTTPSProxy: proxy, NoProxy: noProxy}).ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return resolve(req.URL)
+	}
+}
+
+func validateProxy(proxy string) error {
+	if proxy == "" {
+		return nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid -proxy %q: expected a URL such as http://proxy:3128", proxy)
+	}
+	return nil
+}
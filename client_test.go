@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func proxyFor(t *testing.T, client *http.Client, target string) *url.URL {
+	t.Helper()
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok || transport.Proxy == nil {
+		t.Fatalf("client transport %T has no proxy function", client.Transport)
+	}
+	req, err := http.NewRequest(http.MethodPost, target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy, err := transport.Proxy(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proxy
+}
+
+func TestNewHTTPClientProxy(t *testing.T) {
+	t.Setenv("NO_PROXY", "internal.example.com")
+
+	client := newHTTPClient(&Config{Proxy: "http://proxy.example.com:3128"})
+	if got := proxyFor(t, client, "http://api.example.com/generate"); got == nil || got.Host != "proxy.example.com:3128" {
+		t.Errorf("-proxy: request proxied through %v, want proxy.example.com:3128", got)
+	}
+	if got := proxyFor(t, client, "http://internal.example.com/generate"); got != nil {
+		t.Errorf("NO_PROXY host proxied through %v", got)
+	}
+	if got := proxyFor(t, client, "http://127.0.0.1:8080/generate"); got != nil {
+		t.Errorf("loopback address proxied through %v", got)
+	}
+}
+
+func TestNewHTTPClientEnvironmentProxy(t *testing.T) {
+	transport := newHTTPClient(&Config{}).Transport.(*http.Transport)
+	if reflect.ValueOf(transport.Proxy).Pointer() != reflect.ValueOf(http.ProxyFromEnvironment).Pointer() {
+		t.Error("without -proxy the transport does not use http.ProxyFromEnvironment")
+	}
+}
+
+// TestNoFollowRedirects checks that a redirected endpoint is followed by
+// default and fails the file under -no-follow-redirects.
+func TestNoFollowRedirects(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/api/generate", http.RedirectHandler("/v2/generate", http.StatusPermanentRedirect))
+	mux.HandleFunc("/v2/generate", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"dataType": "summary", "coverageIncreased": "Coverage increased from 40% to 60%", "totalLines": "10"}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for _, noFollow := range []bool{false, true} {
+		cfg := &Config{endpoint: server.URL + "/api/generate", NoFollowRedirects: noFollow}
+		cfg.client = newHTTPClient(cfg)
+		cfg.transport = &httpTransport{cfg: cfg}
+		metrics, err := streamMetrics(cfg, GenerateTestRequest{SrcFilePath: "app.py"})
+		switch {
+		case !noFollow && (err != nil || metrics.FinalCoverage != 60):
+			t.Errorf("following redirects: got %+v, error %v", metrics, err)
+		case noFollow && (err == nil || !strings.Contains(err.Error(), "308")):
+			t.Errorf("-no-follow-redirects: got error %v, want the 308 response", err)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The Cobertura elements written by -cobertura, following coverage-04.dtd.
+// Branch figures are not reported by the server and are written as 0.
+type coberturaCoverage struct {
+	XMLName         xml.Name           `xml:"coverage"`
+	LineRate        float64            `xml:"line-rate,attr"`
+	BranchRate      float64            `xml:"branch-rate,attr"`
+	LinesCovered    int                `xml:"lines-covered,attr"`
+	LinesValid      int                `xml:"lines-valid,attr"`
+	BranchesCovered int                `xml:"branches-covered,attr"`
+	BranchesValid   int                `xml:"branches-valid,attr"`
+	Complexity      float64            `xml:"complexity,attr"`
+	Version         string             `xml:"version,attr"`
+	Timestamp       int64              `xml:"timestamp,attr"`
+	Sources         []string           `xml:"sources>source"`
+	Packages        []coberturaPackage `xml:"packages>package"`
+}
+
+type coberturaPackage struct {
+	Name       string           `xml:"name,attr"`
+	LineRate   float64          `xml:"line-rate,attr"`
+	BranchRate float64          `xml:"branch-rate,attr"`
+	Complexity float64          `xml:"complexity,attr"`
+	Classes    []coberturaClass `xml:"classes>class"`
+}
+
+type coberturaClass struct {
+	Name       string          `xml:"name,attr"`
+	Filename   string          `xml:"filename,attr"`
+	LineRate   float64         `xml:"line-rate,attr"`
+	BranchRate float64         `xml:"branch-rate,attr"`
+	Complexity float64         `xml:"complexity,attr"`
+	Methods    struct{}        `xml:"methods"`
+	Lines      []coberturaLine `xml:"lines>line"`
+}
+
+type coberturaLine struct {
+	Number int `xml:"number,attr"`
+	Hits   int `xml:"hits,attr"`
+}
+
+// writeCobertura writes one class per file, grouped into a package per
+// directory. A file's line-rate is its final coverage (the initial one for
+// -measure-only) and the overall line-rate the weighted aggregate. Lines
+// are listed when the server reported covered and uncovered lines.
+// Files without a usable coverage figure are left out.
+func writeCobertura(file, source string, results []Result, summary *Summary, measureOnly bool) error {
+	rate := summary.FinalCoverage()
+	if measureOnly {
+		rate = summary.InitialCoverage()
+	}
+	report := coberturaCoverage{
+		LineRate:  roundTo(rate/100, 4),
+		Version:   version,
+		Timestamp: time.Now().UnixMilli(),
+		Sources:   []string{source},
+	}
+
+	packages := make(map[string]*coberturaPackage)
+	packageLines := make(map[string][2]float64)
+	for _, r := range results {
+		if r.Status != statusOK && r.Status != statusStopped {
+			continue
+		}
+		name := r.Path
+		if r.Root != "" {
+			name = r.Root + "/" + r.Path
+		}
+		name = strings.ReplaceAll(name, "\\", "/")
+		coverage := r.Metrics.FinalCoverage
+		if r.MeasureOnly {
+			coverage = r.Metrics.InitialCoverage
+		}
+		class := coberturaClass{
+			Name:     strings.ReplaceAll(strings.TrimSuffix(name, path.Ext(name)), "/", "."),
+			Filename: name,
+			LineRate: roundTo(coverage/100, 4),
+		}
+		numbers := make([]int, 0, len(r.Metrics.Lines))
+		for n := range r.Metrics.Lines {
+			numbers = append(numbers, n)
+		}
+		sort.Ints(numbers)
+		for _, n := range numbers {
+			hits := 0
+			if r.Metrics.Lines[n] {
+				hits = 1
+			}
+			class.Lines = append(class.Lines, coberturaLine{Number: n, Hits: hits})
+		}
+
+		dir := path.Dir(name)
+		if packages[dir] == nil {
+			packages[dir] = &coberturaPackage{Name: strings.ReplaceAll(strings.TrimPrefix(dir, "."), "/", ".")}
+		}
+		packages[dir].Classes = append(packages[dir].Classes, class)
+		lines := packageLines[dir]
+		packageLines[dir] = [2]float64{lines[0] + coverage*r.Metrics.TotalLines, lines[1] + r.Metrics.TotalLines}
+		report.LinesValid += int(r.Metrics.TotalLines)
+		report.LinesCovered += int(coverage*r.Metrics.TotalLines/100 + 0.5)
+	}
+
+	dirs := make([]string, 0, len(packages))
+	for dir := range packages {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		p := packages[dir]
+		if lines := packageLines[dir]; lines[1] > 0 {
+			p.LineRate = roundTo(lines[0]/lines[1]/100, 4)
+		}
+		report.Packages = append(report.Packages, *p)
+	}
+
+	return writeFileAtomic(file, func(w io.Writer) error {
+		if _, err := io.WriteString(w, xml.Header+`<!DOCTYPE coverage SYSTEM "http://cobertura.sourceforge.net/xml/coverage-04.dtd">`+"\n"); err != nil {
+			return err
+		}
+		encoder := xml.NewEncoder(w)
+		encoder.Indent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode Cobertura report: %w", err)
+		}
+		_, err := io.WriteString(w, "\n")
+		return err
+	})
+}
+
+// saveCobertura writes the -cobertura report, if asked for. Its source is
+// -path-base, or else the root when there is only one, or else the working
+// directory, redacted like the report rows under -redact.
+func saveCobertura(cfg *Config, roots []sourceRoot, results []Result, summary *Summary, pathRedactor *redactor) {
+	if cfg.Cobertura == "" {
+		return
+	}
+	source := cfg.PathBase
+	if source == "" && len(roots) == 1 {
+		source = roots[0].dir
+	} else if source == "" {
+		source, _ = os.Getwd()
+	}
+	if pathRedactor != nil {
+		source = pathRedactor.Redact(source)
+	}
+	if err := writeCobertura(cfg.Cobertura, source, results, summary, cfg.MeasureOnly); err != nil {
+		fmt.Println("Failed to write Cobertura report:", err)
+	} else {
+		fmt.Printf("Cobertura report saved as %s\n", cfg.Cobertura)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSaveCoberturaRedactsSource checks that under -redact the source root
+// is hashed like the report rows rather than written as an absolute path.
+func TestSaveCoberturaRedactsSource(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "secret-project")
+	cfg := &Config{Cobertura: filepath.Join(dir, "coverage.xml")}
+	redact, err := newRedactor("seed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := []Result{{Path: redact.Redact("pkg/app.py"), Status: statusOK, Metrics: Metrics{FinalCoverage: 50, TotalLines: 10}}}
+	var summary Summary
+	summary.Add(results[0])
+
+	saveCobertura(cfg, []sourceRoot{{dir: root}}, results, &summary, redact)
+	data, err := os.ReadFile(cfg.Cobertura)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret-project") {
+		t.Errorf("report exposes the root:\n%s", data)
+	}
+	var report coberturaCoverage
+	if err := xml.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Sources) != 1 || report.Sources[0] != redact.Redact(root) {
+		t.Errorf("sources are %v, want the redacted root %s", report.Sources, redact.Redact(root))
+	}
+}
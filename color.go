@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// colorOutput is set from -color at startup. Colors are only ever used for
+// terminal output, never in reports or logs written to files.
+var colorOutput bool
+
+// setColor resolves -color: auto enables color on a terminal unless NO_COLOR
+// is set, so CI logs and redirected output stay plain.
+func setColor(mode string) {
+	switch mode {
+	case "always":
+		colorOutput = true
+	case "never":
+		colorOutput = false
+	default:
+		_, noColor := os.LookupEnv("NO_COLOR")
+		info, err := os.Stdout.Stat()
+		colorOutput = !noColor && err == nil && info.Mode()&os.ModeCharDevice != 0
+	}
+}
+
+func colorize(code, s string) string {
+	if !colorOutput {
+		return s
+	}
+	return fmt.Sprintf("\x1b[%sm%s\x1b[0m", code, s)
+}
+
+func green(s string) string { return colorize("32", s) }
+
+func red(s string) string { return colorize("31", s) }
+
+// coverageChange formats "initial% -> final%", green when coverage went up
+// and red when it went down.
+func coverageChange(initial, final float64) string {
+	s := fmt.Sprintf("%.2f%% -> %.2f%%", initial, final)
+	switch {
+	case final > initial:
+		return green(s)
+	case final < initial:
+		return red(s)
+	}
+	return s
+}
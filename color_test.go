@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestCoverageChange(t *testing.T) {
+	defer setColor("never")
+	setColor("always")
+	for _, tc := range []struct {
+		initial, final float64
+		want           string
+	}{
+		{40, 75.5, "\x1b[32m40.00% -> 75.50%\x1b[0m"},
+		{40, 30, "\x1b[31m40.00% -> 30.00%\x1b[0m"},
+		{40, 40, "40.00% -> 40.00%"},
+	} {
+		if got := coverageChange(tc.initial, tc.final); got != tc.want {
+			t.Errorf("%v -> %v: got %q, want %q", tc.initial, tc.final, got, tc.want)
+		}
+	}
+
+	// Test output is not a terminal, so auto leaves it plain.
+	for _, mode := range []string{"never", "auto"} {
+		setColor(mode)
+		if got := coverageChange(40, 75.5); got != "40.00% -> 75.50%" {
+			t.Errorf("-color %s: got %q", mode, got)
+		}
+	}
+}
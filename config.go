@@ -0,0 +1,694 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the options for a single run.
+type Config struct {
+	Output    string
+	Formats   []string
+	JSONLines bool
+	Append    bool
+	Stdout    bool
+
+	SummaryJSON bool
+
+	AutosaveInterval time.Duration
+
+	ChunkSize  int
+	ChunkIndex int
+	Merge      bool
+
+	ValidateReport string
+
+	Concurrency int
+	BatchSize   int
+
+	Timeout  time.Duration
+	SkipFile string
+	AutoSkip bool
+
+	KeepGoingAfterPanic bool
+
+	Retries      int
+	RetryBudget  time.Duration
+	RetryBackoff time.Duration
+	RetryOnZero  bool
+	RetryJitter  bool
+
+	MinCoverage         float64
+	RequireImprovement  bool
+	Baseline            string
+	RegressionThreshold float64
+
+	MaxErrors     int
+	MaxWarnings   int
+	MaxErrorsMode string
+	MaxTotalTests int
+
+	SortBy        string
+	Precision     int
+	SummaryLog    string
+	CovOut        string
+	Cobertura     string
+	Badge         string
+	BadgeLabel    string
+	TimingsChart  string
+	Roots         []string
+	SkipFiles     []string
+	ProcessInit   bool
+	SkipIfTested  bool
+	OnlyLanguage  string
+	Explain       bool
+	Rewalk        bool
+	ByDirectory   bool
+	SinceLastRun  bool
+	StateFile     string
+	MaxPasses     int
+	AbsolutePaths bool
+	PathStyle     string
+	CoverageMatch string
+	PathBase      string
+
+	OnlyRegressions bool
+	AggregateOnly   bool
+	Timings         string
+
+	Redact     bool
+	RedactSeed string
+	RedactMap  string
+
+	JSONCompact      bool
+	FieldMap         []string
+	ReadBuffer       int
+	DumpRequests     bool
+	MaxResponseBytes int64
+	MaxEvents        int
+
+	TagsFile string
+	TagsMode string
+
+	AggregateExcludeTags []string
+
+	PerFunction         bool
+	FunctionsFile       string
+	FunctionConcurrency int
+	DedupeFunctions     bool
+
+	MeasureOnly bool
+
+	ExpectedCoverage float64
+	StopAtExpected   bool
+	Flakiness        bool
+	Trajectory       bool
+	RequestID        bool
+	CoverageByType   bool
+	Seed             string
+
+	APIURL     string
+	APIPath    string
+	APIToken   string
+	Transport  string
+	Proxy      string
+	ConfigFile string
+	Profile    string
+	StrictEnv  bool
+	Strict     bool
+
+	NoFollowRedirects bool
+
+	CompareURL        string
+	CompareConcurrent bool
+
+	Credentials string
+
+	ExcelStyle  string
+	ReportTitle string
+	ReportNote  string
+	Manifest    string
+	OutputDir   string
+
+	Commit string
+
+	Color string
+	Debug bool
+
+	PreHook  string
+	PostHook string
+
+	PrintConfig       bool
+	SelfTest          bool
+	DryValidateConfig bool
+
+	flags      *flag.FlagSet
+	endpoint   string
+	client     *http.Client
+	transport  Transport
+	clock      retryClock
+	excelStyle *ExcelStyle
+	lastRun    *lastRunState
+	seed       *int64
+
+	// fieldMap holds the parsed -field-map paths by event field.
+	fieldMap map[string][]string
+
+	// compare is the configuration for the -compare-url server; it differs
+	// from the primary one only in URL, endpoint and transport.
+	compare *Config
+
+	// columns overrides the report columns, from -columns or to keep the
+	// schema of merged reports.
+	columns []Column
+}
+
+func parseConfig(args []string) (*Config, error) {
+	cfg := &Config{}
+	var formats, columnKeys, skipFiles, aggregateExcludeTags string
+
+	fs := flag.NewFlagSet("metrics-script", flag.ContinueOnError)
+	fs.StringVar(&cfg.Output, "output", "execution_log_2.xlsx", "report file; other formats reuse its name with their own extension. May contain {date}, {lang}, {count} and {host}")
+	fs.StringVar(&formats, "format", "excel", "comma-separated report formats: excel, csv, json, tidy-csv")
+	fs.StringVar(&columnKeys, "columns", "", "ordered comma-separated report columns (default: all enabled), from: "+strings.Join(allColumnKeys(), ", "))
+	fs.BoolVar(&cfg.JSONLines, "json-lines", false, "write the JSON report as JSON lines (.jsonl) after every file instead of an array at the end")
+	fs.DurationVar(&cfg.AutosaveInterval, "autosave-interval", 0, "also save reports that hold rows in memory, such as the JSON array, at this interval (0 disables)")
+	fs.BoolVar(&cfg.OnlyRegressions, "only-regressions", false, "write only rows whose final coverage is not above the initial coverage or below -expected-coverage; the summary still covers every file")
+	fs.StringVar(&cfg.Timings, "timings", "", "prior report or timings CSV whose per-file durations estimate the time left; a .csv is updated with this run's durations")
+	fs.BoolVar(&cfg.AggregateOnly, "aggregate-only", false, "write reports with only the run's totals (files, weighted coverage before and after, tests added, duration) and no per-file rows")
+	fs.BoolVar(&cfg.Stdout, "stdout", false, "write the report to standard output instead of -output, and all logs to standard error; needs a single csv, tidy-csv or json -format")
+	fs.BoolVar(&cfg.SummaryJSON, "summary-json", false, "end the run with one JSON line on standard error holding file counts, failures, aggregate coverage, duration and exit code, also when stopped by SIGINT or SIGTERM")
+	fs.BoolVar(&cfg.Append, "append", false, "add rows to existing reports instead of overwriting them")
+	fs.IntVar(&cfg.ChunkSize, "chunk-size", 0, "process only -chunk-index'th slice of this many files from the sorted file list (0 processes everything)")
+	fs.IntVar(&cfg.ChunkIndex, "chunk-index", 0, "zero-based chunk to process with -chunk-size")
+	fs.BoolVar(&cfg.Merge, "merge", false, "combine the reports given as arguments into -output instead of processing files; later rows for the same path win")
+	fs.StringVar(&cfg.ValidateReport, "validate-report", "", "check this report's header, numeric columns and Tags sheet totals instead of processing files; exits non-zero on any problem")
+	fs.IntVar(&cfg.Concurrency, "concurrency", 1, "number of files processed in parallel; reports keep discovery order")
+	fs.IntVar(&cfg.BatchSize, "batch-size", 1, "send up to this many of the files in flight as one request, for servers that tag events with sourceFilePath; needs -concurrency of at least the batch size, and falls back to one file per request if the server doesn't batch")
+	fs.DurationVar(&cfg.Timeout, "timeout", 0, "per-file request timeout (0 means no timeout)")
+	fs.StringVar(&cfg.SkipFile, "skip-file", "", "file listing relative paths to exclude from processing, one per line")
+	fs.BoolVar(&cfg.AutoSkip, "auto-skip", false, "append files that time out to the -skip-file")
+	fs.BoolVar(&cfg.KeepGoingAfterPanic, "keep-going-after-panic", false, "record a request that panics, such as on a malformed event, as a failed file and continue the run; the stack trace is shown with -debug")
+	fs.IntVar(&cfg.Retries, "retries", 0, "number of times to retry a failed request (0 means no retries, or unlimited retries within a nonzero -retry-budget)")
+	fs.DurationVar(&cfg.RetryBudget, "retry-budget", 0, "maximum total time spent retrying a single file (0 means no limit)")
+	fs.DurationVar(&cfg.RetryBackoff, "retry-backoff", time.Second, "delay before the first retry, doubled after each attempt")
+	fs.BoolVar(&cfg.RetryJitter, "retry-jitter", false, "wait a random delay between half and all of each -retry-backoff step, so parallel workers don't retry in lockstep")
+	fs.BoolVar(&cfg.RetryOnZero, "retry-on-zero", false, "request a file once more when its initial coverage, final coverage and tests added are all zero")
+	fs.Float64Var(&cfg.MinCoverage, "min-coverage", 0, "fail with exit code 3 if the aggregate final coverage is below this percentage")
+	fs.BoolVar(&cfg.RequireImprovement, "require-improvement", false, "fail with exit code 3 if any processed file's final coverage is not above its initial coverage, listing those files")
+	fs.StringVar(&cfg.Baseline, "baseline", "", "prior report (xlsx, csv, json or jsonl) to compare final coverage against")
+	fs.Float64Var(&cfg.RegressionThreshold, "regression-threshold", 0, "percentage points a file may drop below -baseline before exiting with code 5")
+	fs.IntVar(&cfg.MaxWarnings, "max-warnings", 0, "exit with code 6 when the run's parse warnings exceed this many (0 means unlimited); unlike -strict, which fails files on a schema version mismatch, single warnings are tolerated")
+	fs.IntVar(&cfg.MaxErrors, "max-errors", 0, "abort the run once this many files have failed (0 means unlimited)")
+	fs.StringVar(&cfg.MaxErrorsMode, "max-errors-mode", "total", "how -max-errors counts failures: total or consecutive")
+	fs.IntVar(&cfg.MaxTotalTests, "max-total-tests", 0, "stop starting new files once this many tests have been added in total; files already in progress under -concurrency still finish (0 means unlimited)")
+	fs.StringVar(&cfg.SortBy, "sort-by", "path", "report row order: path, delta, duration or final-coverage; any order but path buffers rows and disables per-file saving")
+	fs.IntVar(&cfg.Precision, "precision", 2, "decimal places for coverage values in every report")
+	fs.StringVar(&cfg.CovOut, "cov-out", "", "directory for per-file .cov annotations of covered and uncovered lines, when the server reports coveredLines/uncoveredLines")
+	fs.StringVar(&cfg.Badge, "badge", "", "also write an SVG badge of the aggregate final coverage to this file, colored from red below 50% to bright green from 90%")
+	fs.StringVar(&cfg.BadgeLabel, "badge-label", "coverage", "label text on the left of the -badge")
+	fs.StringVar(&cfg.TimingsChart, "timings-chart", "", "also write an SVG bar chart of each file's duration, slowest first, to this file")
+	fs.StringVar(&cfg.Cobertura, "cobertura", "", "also write the final coverage per file and overall as Cobertura XML to this file, with line hits when the server reports coveredLines/uncoveredLines")
+	fs.StringVar(&cfg.SummaryLog, "summary-log", "", "append a one-line tab-separated summary per file to this log")
+	fs.StringVar(&cfg.PathBase, "path-base", "", "record report paths relative to this directory, such as the git root, instead of the scan root; files outside it keep root-relative paths")
+	fs.StringVar(&cfg.CoverageMatch, "coverage-match", "auto", "how to pick the initial coverage out of a calculatedCoverage message: auto (a percentage after \"coverage\", else the first percentage, else the last number), first or last number, or labeled (the number next to \"coverage\", else the last)")
+	fs.StringVar(&cfg.PathStyle, "path-style", "unix", "separator for relative paths in reports: unix (always /) or native")
+	fs.BoolVar(&cfg.AbsolutePaths, "absolute-paths", false, "add an Absolute Path column next to the relative path")
+	fs.Var((*listFlag)(&cfg.FieldMap), "field-map", "read an event field from a dotted path into nested events, as field=path (e.g. totalLines=summary.metrics.lines.total); repeat or comma-separate")
+	fs.BoolVar(&cfg.JSONCompact, "json-compact", false, "decode only the event fields the parsers read, with a small read buffer, to keep memory flat on huge streams")
+	fs.IntVar(&cfg.ReadBuffer, "read-buffer", 0, "bytes buffered when reading a response stream (0 means 4096, or 1024 with -json-compact)")
+	fs.Int64Var(&cfg.MaxResponseBytes, "max-response-bytes", 0, "fail a file whose response body exceeds this many bytes (0 means unlimited)")
+	fs.IntVar(&cfg.MaxEvents, "max-events", 0, "fail a file whose stream exceeds this many events, keeping its partial metrics in the summary log; catches servers that repeat events forever (0 means unlimited)")
+	fs.BoolVar(&cfg.MeasureOnly, "measure-only", false, "only measure initial coverage without generating tests; requires server support for measureOnly requests")
+	fs.Float64Var(&cfg.ExpectedCoverage, "expected-coverage", 0, "target coverage percentage sent to the server with each request")
+	fs.BoolVar(&cfg.StopAtExpected, "stop-at-expected", false, "close a file's stream as soon as an interim coverage event reaches -expected-coverage; the server needs no support for this")
+	fs.StringVar(&cfg.Seed, "seed", "", "integer seed sent with every request so servers that support it generate reproducibly (omitted when empty)")
+	fs.BoolVar(&cfg.CoverageByType, "coverage-by-type", false, "add Unit Coverage and Integration Coverage columns and totals, when the server's summary reports unitCoverage/integrationCoverage")
+	fs.BoolVar(&cfg.RequestID, "request-id", false, "add a Request ID column with each file's X-Request-ID response header or requestId event field, for quoting in support tickets")
+	fs.BoolVar(&cfg.Trajectory, "trajectory", false, "add a Coverage Trajectory column with the coverage after each iteration, when the server streams interim coverage")
+	fs.BoolVar(&cfg.Flakiness, "flakiness", false, "ask the server to check generated tests for flakiness and add Flaky and Flakiness Runs columns")
+	fs.BoolVar(&cfg.Redact, "redact", false, "replace path segments with hashes in all reports")
+	fs.StringVar(&cfg.RedactSeed, "redact-seed", "", "seed for -redact hashes; reuse it to correlate reports (random per run by default)")
+	fs.StringVar(&cfg.RedactMap, "redact-map", "redact_map.csv", "local file mapping redacted paths back to the originals")
+	fs.StringVar(&cfg.ExcelStyle, "excel-style", "", "JSON file with column widths, header colors and number formats for the Excel report")
+	fs.StringVar(&cfg.ReportTitle, "report-title", "", "title written in a metadata block at the top of the report")
+	fs.StringVar(&cfg.ReportNote, "report-note", "", "note written in the report metadata block")
+	fs.StringVar(&cfg.OutputDir, "output-dir", "", "collect the reports, manifest, summary log, coverage annotations, Cobertura report, badge, timings chart and redaction map in a new timestamped directory here, listed in its index.txt; relative artifact paths are placed inside it")
+	fs.StringVar(&cfg.Manifest, "manifest", "", "write a JSON record of the run (timings, commit, reports, totals) to this file")
+	fs.StringVar(&cfg.Commit, "commit", "", "commit to record in the report metadata and manifest instead of the root's detected HEAD commit and dirty state")
+	fs.BoolVar(&cfg.Debug, "debug", false, "print diagnostic output such as hook command output")
+	fs.StringVar(&cfg.PreHook, "pre-hook", "", "shell command run before each file's requests, with the file in $METRICS_FILE; the file fails if it exits non-zero")
+	fs.StringVar(&cfg.PostHook, "post-hook", "", "shell command run after each file's requests, with the file in $METRICS_FILE and ok or err in $METRICS_STATUS")
+	fs.StringVar(&cfg.Color, "color", "auto", "color terminal output: auto (only on a terminal without NO_COLOR), always or never")
+	fs.BoolVar(&cfg.PrintConfig, "print-config", false, "print the resolved configuration as JSON (secrets redacted) and exit")
+	fs.StringVar(&cfg.TagsFile, "tags-file", "", "file of \"glob tag[,tag...]\" lines; adds a Tags column and per-tag aggregates")
+	fs.StringVar(&aggregateExcludeTags, "aggregate-exclude-tags", "", "comma-separated -tags-file tags, such as generated or vendored, whose files stay in the report but are left out of the aggregate coverage and -min-coverage gate")
+	fs.StringVar(&cfg.TagsMode, "tags-mode", "union", "how several matching -tags-file rules combine: union or last")
+	fs.BoolVar(&cfg.DryValidateConfig, "dry-validate-config", false, "validate the flags, config, credentials and referenced list files, then exit without scanning files or contacting the server")
+	fs.BoolVar(&cfg.SelfTest, "self-test", false, "run the full pipeline against a built-in mock server and check the reports")
+	fs.BoolVar(&cfg.PerFunction, "per-function", false, "issue one request per function listed in -functions and report one row per (file, function)")
+	fs.StringVar(&cfg.FunctionsFile, "functions", "", "file listing functions to target, one \"relative/path.py:function [id]\" per line; the optional id identifies re-exported functions")
+	fs.IntVar(&cfg.FunctionConcurrency, "function-concurrency", 4, "maximum concurrent requests for the functions of one file")
+	fs.BoolVar(&cfg.DedupeFunctions, "dedupe-functions", false, "with -per-function, request each function ID in -functions only once, for functions re-exported from several files")
+	fs.StringVar(&cfg.APIURL, "api-url", "http://localhost:4407", "base URL of the generation server")
+	fs.StringVar(&cfg.APIPath, "api-path", "/api/generate", "path of the generate endpoint, joined to -api-url")
+	fs.StringVar(&cfg.Transport, "transport", "http", "how requests reach the server: http (JSON stream), grpc (the GenerateTests RPC in proto/generator.proto, on the -api-url host) or websocket (one JSON event per message on the generate endpoint)")
+	fs.StringVar(&cfg.APIToken, "api-token", "", "bearer token sent with every request")
+	fs.BoolVar(&cfg.DumpRequests, "dump-requests", false, "print each request's headers (credentials redacted) and pretty-printed JSON body before sending it")
+	fs.StringVar(&cfg.Credentials, "credentials", "", "JSON or INI file with api-url and api-token; overrides -config, command-line flags override it")
+	fs.BoolVar(&cfg.NoFollowRedirects, "no-follow-redirects", false, "fail on HTTP redirects, logging their Location, instead of following them")
+	fs.StringVar(&cfg.CompareURL, "compare-url", "", "also send every file to this server (B) and add its coverage, tests and duration next to -api-url's (A), with B-A deltas")
+	fs.BoolVar(&cfg.CompareConcurrent, "compare-concurrent", false, "with -compare-url, send each file to both servers at once instead of one after the other")
+	fs.StringVar(&cfg.Proxy, "proxy", "", "proxy URL for API requests, overriding HTTP_PROXY/HTTPS_PROXY (NO_PROXY still applies)")
+	fs.Var((*listFlag)(&cfg.Roots), "root", "directory to scan for source files (default: the working directory); repeat or comma-separate to scan several roots into one report with a Root column")
+	fs.StringVar(&skipFiles, "skip-files", strings.Join(pythonProfile.SkipFiles, ","), "comma-separated file names never processed")
+	fs.BoolVar(&cfg.ByDirectory, "by-directory", false, "send one request per directory of discovered files and report one row per directory; if the server only handles files, each directory's files are requested separately and combined")
+	fs.BoolVar(&cfg.SinceLastRun, "since-last-run", false, "only process files modified since the last run that processed every file, as recorded in -state-file; a run that stops early is resumed by the next one")
+	fs.StringVar(&cfg.StateFile, "state-file", ".lastrun", "state file for -since-last-run; with -chunk-size each chunk keeps its own, suffixed -size<N>-chunk<I>")
+	fs.BoolVar(&cfg.Rewalk, "rewalk", false, "after the discovered files are done, walk again and process files created meanwhile, until a pass finds none or -max-passes is reached")
+	fs.IntVar(&cfg.MaxPasses, "max-passes", 5, "most walks, including the first, made with -rewalk")
+	fs.BoolVar(&cfg.Explain, "explain", false, "print why each candidate file is included or excluded, then exit without sending requests")
+	fs.StringVar(&cfg.OnlyLanguage, "only-language", "", "language to process files under when several language profiles match them ("+strings.Join(profileNames(languageProfiles), ", ")+"); by default the first listed wins")
+	fs.BoolVar(&cfg.SkipIfTested, "skip-if-tested", false, "skip source files that already have a sibling test file (test_<name>.py or <name>_test.py)")
+	fs.BoolVar(&cfg.ProcessInit, "process-init", false, "process __init__.py files even though -skip-files lists them")
+	fs.StringVar(&cfg.ConfigFile, "config", "", "JSON file of flag values; flags given on the command line take precedence")
+	fs.StringVar(&cfg.Profile, "profile", "", "named profile from the config file's \"profiles\" object to apply over its top-level values")
+	fs.BoolVar(&cfg.Strict, "strict", false, "fail files whose server reports an event schema version other than the one this tool parses, instead of warning")
+	fs.BoolVar(&cfg.StrictEnv, "strict-env", false, "fail if the config file references an unset environment variable")
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	commandLine := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { commandLine[f.Name] = true })
+	if cfg.Profile != "" && cfg.ConfigFile == "" {
+		return nil, fmt.Errorf("-profile requires -config")
+	}
+	if cfg.ConfigFile != "" {
+		if err := loadConfigFile(fs, cfg.ConfigFile, cfg.StrictEnv, cfg.Profile); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Credentials != "" {
+		if err := loadCredentials(fs, cfg.Credentials, commandLine); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, f := range strings.Split(formats, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if _, ok := formatExtensions[f]; !ok {
+			return nil, fmt.Errorf("unknown format %q", f)
+		}
+		cfg.Formats = append(cfg.Formats, f)
+	}
+	if len(cfg.Formats) == 0 {
+		return nil, fmt.Errorf("no report format selected")
+	}
+	if cfg.Stdout {
+		switch {
+		case len(cfg.Formats) > 1:
+			return nil, fmt.Errorf("-stdout writes a single report; choose one -format")
+		case cfg.Formats[0] == "excel":
+			return nil, fmt.Errorf("-stdout cannot write Excel reports, which are binary; use -format csv or json")
+		case cfg.Append:
+			return nil, fmt.Errorf("-stdout cannot be combined with -append")
+		case cfg.OutputDir != "":
+			return nil, fmt.Errorf("-stdout cannot be combined with -output-dir")
+		}
+	}
+	for _, name := range strings.Split(skipFiles, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			cfg.SkipFiles = append(cfg.SkipFiles, name)
+		}
+	}
+	for _, key := range strings.Split(columnKeys, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		c := columnByKey(key)
+		if c == nil {
+			return nil, fmt.Errorf("unknown column %q in -columns; known columns: %s", key, strings.Join(allColumnKeys(), ", "))
+		}
+		cfg.columns = append(cfg.columns, *c)
+	}
+	if _, ok := resultOrders[cfg.SortBy]; !ok {
+		return nil, fmt.Errorf("unknown -sort-by %q", cfg.SortBy)
+	}
+	if cfg.Color != "auto" && cfg.Color != "always" && cfg.Color != "never" {
+		return nil, fmt.Errorf("unknown -color %q", cfg.Color)
+	}
+	if !contains(coverageMatchModes, cfg.CoverageMatch) {
+		return nil, fmt.Errorf("unknown -coverage-match %q; use %s", cfg.CoverageMatch, strings.Join(coverageMatchModes, ", "))
+	}
+	if cfg.PathStyle != "unix" && cfg.PathStyle != "native" {
+		return nil, fmt.Errorf("unknown -path-style %q", cfg.PathStyle)
+	}
+	if cfg.PathBase != "" {
+		base, err := filepath.Abs(cfg.PathBase)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -path-base: %w", err)
+		}
+		if info, err := os.Stat(base); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("invalid -path-base: %s is not a directory", cfg.PathBase)
+		}
+		cfg.PathBase = base
+	}
+	if cfg.TagsMode != "union" && cfg.TagsMode != "last" {
+		return nil, fmt.Errorf("unknown -tags-mode %q", cfg.TagsMode)
+	}
+	for _, tag := range strings.Split(aggregateExcludeTags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			cfg.AggregateExcludeTags = append(cfg.AggregateExcludeTags, tag)
+		}
+	}
+	if len(cfg.AggregateExcludeTags) > 0 && cfg.TagsFile == "" {
+		return nil, fmt.Errorf("-aggregate-exclude-tags requires -tags-file")
+	}
+	if cfg.MaxErrorsMode != "total" && cfg.MaxErrorsMode != "consecutive" {
+		return nil, fmt.Errorf("unknown -max-errors-mode %q", cfg.MaxErrorsMode)
+	}
+	if cfg.ChunkSize < 0 || cfg.ChunkIndex < 0 {
+		return nil, fmt.Errorf("-chunk-size and -chunk-index must not be negative")
+	}
+	if cfg.Merge && fs.NArg() == 0 {
+		return nil, fmt.Errorf("-merge requires report files as arguments")
+	}
+	if cfg.Precision < 0 {
+		return nil, fmt.Errorf("-precision must not be negative")
+	}
+	if err := validateTemplate(cfg.Output); err != nil {
+		return nil, fmt.Errorf("invalid -output: %w", err)
+	}
+	cfg.endpoint, err = apiEndpoint(cfg.APIURL, cfg.APIPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateProxy(cfg.Proxy); err != nil {
+		return nil, err
+	}
+	if cfg.Seed != "" {
+		seed, err := strconv.ParseInt(cfg.Seed, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("-seed must be an integer, got %q", cfg.Seed)
+		}
+		cfg.seed = &seed
+	}
+	if cfg.OnlyLanguage != "" && !contains(profileNames(languageProfiles), cfg.OnlyLanguage) {
+		return nil, fmt.Errorf("unknown -only-language %q; known languages: %s", cfg.OnlyLanguage, strings.Join(profileNames(languageProfiles), ", "))
+	}
+	if cfg.MaxWarnings < 0 {
+		return nil, fmt.Errorf("-max-warnings must not be negative")
+	}
+	if cfg.MaxTotalTests < 0 {
+		return nil, fmt.Errorf("-max-total-tests must not be negative")
+	}
+	if cfg.MaxPasses < 1 {
+		return nil, fmt.Errorf("-max-passes must be at least 1")
+	}
+	cfg.fieldMap, err = parseFieldMap(cfg.FieldMap)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.fieldMap != nil && cfg.JSONCompact {
+		return nil, fmt.Errorf("-field-map cannot be used with -json-compact, which drops nested fields")
+	}
+	if cfg.AutosaveInterval < 0 {
+		return nil, fmt.Errorf("-autosave-interval must not be negative")
+	}
+	if cfg.ReadBuffer < 0 {
+		return nil, fmt.Errorf("-read-buffer must not be negative")
+	}
+	if cfg.MaxResponseBytes < 0 {
+		return nil, fmt.Errorf("-max-response-bytes must not be negative")
+	}
+	if cfg.BatchSize < 1 {
+		return nil, fmt.Errorf("-batch-size must be at least 1")
+	}
+	if cfg.BatchSize > cfg.Concurrency {
+		return nil, fmt.Errorf("-batch-size %d needs -concurrency of at least %d to fill a batch", cfg.BatchSize, cfg.BatchSize)
+	}
+	if cfg.BatchSize > 1 && cfg.PerFunction {
+		// Batched events are routed by file, which a file's functions share.
+		return nil, fmt.Errorf("-batch-size cannot be used with -per-function")
+	}
+	if cfg.MaxEvents < 0 {
+		return nil, fmt.Errorf("-max-events must not be negative")
+	}
+	if cfg.Retries < 0 {
+		return nil, fmt.Errorf("-retries must not be negative")
+	}
+	if cfg.Retries == 0 && cfg.RetryBudget > 0 && cfg.RetryBackoff <= 0 {
+		return nil, fmt.Errorf("-retry-budget without -retries needs a positive -retry-backoff")
+	}
+	if cfg.AggregateOnly && (cfg.SummaryLog != "" || cfg.CovOut != "" || cfg.Cobertura != "" || cfg.TimingsChart != "") {
+		return nil, fmt.Errorf("-aggregate-only leaves out per-file output and cannot be used with -summary-log, -cov-out, -cobertura or -timings-chart")
+	}
+	if cfg.OnlyRegressions && cfg.MeasureOnly {
+		return nil, fmt.Errorf("-only-regressions needs final coverage and cannot be used with -measure-only")
+	}
+	if cfg.RequireImprovement && cfg.MeasureOnly {
+		return nil, fmt.Errorf("-require-improvement needs final coverage and cannot be used with -measure-only")
+	}
+	if cfg.StopAtExpected && cfg.ExpectedCoverage <= 0 {
+		return nil, fmt.Errorf("-stop-at-expected requires -expected-coverage")
+	}
+	if cfg.ByDirectory && (cfg.PerFunction || cfg.Rewalk || cfg.BatchSize > 1 || cfg.CovOut != "" || cfg.Cobertura != "") {
+		return nil, fmt.Errorf("-by-directory reports directories, not files, and cannot be used with -per-function, -rewalk, -batch-size, -cov-out or -cobertura")
+	}
+	if cfg.PerFunction && cfg.FunctionsFile == "" {
+		return nil, fmt.Errorf("-per-function requires -functions")
+	}
+	if cfg.Concurrency < 1 {
+		return nil, fmt.Errorf("-concurrency must be at least 1")
+	}
+	if cfg.FunctionConcurrency < 1 {
+		return nil, fmt.Errorf("-function-concurrency must be at least 1")
+	}
+	if cfg.AutoSkip && cfg.SkipFile == "" {
+		return nil, fmt.Errorf("-auto-skip requires -skip-file")
+	}
+	if cfg.SinceLastRun {
+		state, err := loadLastRun(cfg.chunkStateFile())
+		if err != nil {
+			return nil, err
+		}
+		cfg.lastRun = state
+	}
+	if cfg.ExcelStyle != "" {
+		style, err := loadExcelStyle(cfg.ExcelStyle)
+		if err != nil {
+			return nil, err
+		}
+		cfg.excelStyle = style
+	}
+	cfg.flags = fs
+	cfg.client = newHTTPClient(cfg)
+	cfg.clock = realClock{}
+	cfg.transport, err = newTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.BatchSize > 1 {
+		cfg.transport = newBatchTransport(cfg.transport, cfg.BatchSize)
+	}
+	if cfg.CompareURL != "" {
+		compare := *cfg
+		compare.APIURL, compare.CompareURL = cfg.CompareURL, ""
+		compare.endpoint, err = apiEndpoint(compare.APIURL, compare.APIPath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -compare-url: %w", err)
+		}
+		compare.transport, err = newTransport(&compare)
+		if err != nil {
+			return nil, err
+		}
+		cfg.compare = &compare
+	}
+	return cfg, nil
+}
+
+// chunkOutput returns the -output template, adding a -chunk{chunk} suffix
+// when chunking so each chunk writes its own reports for a later merge.
+func (c *Config) chunkOutput() string {
+	if c.ChunkSize == 0 || strings.Contains(c.Output, "{chunk}") {
+		return c.Output
+	}
+	ext := filepath.Ext(c.Output)
+	return strings.TrimSuffix(c.Output, ext) + "-chunk{chunk}" + ext
+}
+
+// chunkStateFile returns -state-file, with a -size<N>-chunk<I> suffix when
+// chunking. Each chunk processes different files, so one chunk finishing
+// must not mark the files of the others as done, and a state kept for
+// another -chunk-size covers different files again.
+func (c *Config) chunkStateFile() string {
+	if c.ChunkSize == 0 {
+		return c.StateFile
+	}
+	return fmt.Sprintf("%s-size%d-chunk%d", c.StateFile, c.ChunkSize, c.ChunkIndex)
+}
+
+// outputPath returns the report filename for format, derived from -output.
+func (c *Config) outputPath(format string) string {
+	if format == "excel" {
+		return c.Output
+	}
+	ext := formatExtensions[format]
+	if format == "json" && c.JSONLines {
+		ext = ".jsonl"
+	}
+	return strings.TrimSuffix(c.Output, filepath.Ext(c.Output)) + ext
+}
+
+// loadConfigFile applies a JSON object of flag names to values, e.g.
+// {"retries": 3, "api-token": "${API_TOKEN}"}. Flags already given on the
+// command line are left untouched. String values have $VAR and ${VAR}
+// expanded from the environment; write $$ for a literal $. A "profiles"
+// object holds named sets of values, such as a server's api-url, api-token
+// and concurrency; the one -profile selects overrides the top-level values.
+func loadConfigFile(fs *flag.FlagSet, path string, strictEnv bool, profile string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", jsonErrorPosition(path, data, err), err)
+	}
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	var profiles map[string]interface{}
+	if raw, ok := values["profiles"]; ok {
+		if profiles, ok = raw.(map[string]interface{}); !ok {
+			return fmt.Errorf("config file %s: \"profiles\" must be an object of named profiles", path)
+		}
+		delete(values, "profiles")
+	}
+	var missing []string
+	if profile != "" {
+		raw, ok := profiles[profile]
+		if !ok {
+			return fmt.Errorf("config file %s has no profile %q (profiles: %s)", path, profile, strings.Join(sortedKeys(profiles), ", "))
+		}
+		profileValues, ok := raw.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("config file %s: profile %q must be an object of options", path, profile)
+		}
+		where := fmt.Sprintf("%s (profile %s)", path, profile)
+		if err := applyConfigValues(fs, where, profileValues, explicit, &missing); err != nil {
+			return err
+		}
+		for name := range profileValues {
+			explicit[name] = true
+		}
+	}
+	if err := applyConfigValues(fs, path, values, explicit, &missing); err != nil {
+		return err
+	}
+	if strictEnv && len(missing) > 0 {
+		return fmt.Errorf("config file %s references unset environment variables: %s", path, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// applyConfigValues sets the flags named in values, skipping those in skip.
+func applyConfigValues(fs *flag.FlagSet, where string, values map[string]interface{}, skip map[string]bool, missing *[]string) error {
+	for _, name := range sortedKeys(values) {
+		if name == "config" || name == "profile" || fs.Lookup(name) == nil {
+			return fmt.Errorf("config file %s: unknown option %q", where, name)
+		}
+		if skip[name] {
+			continue
+		}
+		var value string
+		switch v := values[name].(type) {
+		case string:
+			value = expandEnv(v, missing)
+		case float64, bool:
+			value = fmt.Sprint(v)
+		default:
+			return fmt.Errorf("config file %s: option %q must be a string, number or boolean", where, name)
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("config file %s: invalid value for %q: %w", where, name, err)
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// jsonErrorPosition returns path with the line and column a JSON decoding
+// error points at, when it carries an offset.
+func jsonErrorPosition(path string, data []byte, err error) string {
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	default:
+		return path
+	}
+	// The offset counts the bytes read up to and including the bad one.
+	line, col := 1, 1
+	for _, b := range data[:min(max(int(offset)-1, 0), len(data))] {
+		if b == '\n' {
+			line, col = line+1, 1
+		} else {
+			col++
+		}
+	}
+	return fmt.Sprintf("%s:%d:%d", path, line, col)
+}
+
+// expandEnv expands $VAR and ${VAR} in s, treating $$ as a literal $.
+// Names of unset variables are appended to missing.
+func expandEnv(s string, missing *[]string) string {
+	return os.Expand(s, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			*missing = append(*missing, name)
+		}
+		return value
+	})
+}
+
+// apiEndpoint joins the base URL and endpoint path, so servers that mount
+// the API under a prefix only need -api-path changed.
+func apiEndpoint(base, path string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid -api-url %q: expected a base URL such as http://localhost:4407", base)
+	}
+	return url.JoinPath(base, path)
+}
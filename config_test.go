@@ -0,0 +1,144 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseConfigRejectsCombinations(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-per-function", "-functions", "functions.txt", "-batch-size", "2", "-concurrency", "2"}, "-batch-size cannot be used with -per-function"},
+		{[]string{"-batch-size", "4", "-concurrency", "2"}, "needs -concurrency of at least 4"},
+		{[]string{"-by-directory", "-batch-size", "2", "-concurrency", "2"}, "-by-directory reports directories"},
+	} {
+		if _, err := parseConfig(tc.args); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%v: got error %v, want %q", tc.args, err, tc.want)
+		}
+	}
+}
+
+// TestConfigFileEnvExpansion checks that -config values expand environment
+// variables, keep $$ as a literal $, and lose to flags on the command line.
+func TestConfigFileEnvExpansion(t *testing.T) {
+	t.Setenv("METRICS_TOKEN", "secret")
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{"api-token": "${METRICS_TOKEN}", "report-note": "costs $$5", "concurrency": 3, "seed": "$UNSET_METRICS_SEED"}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := parseConfig([]string{"-config", path, "-concurrency", "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.APIToken != "secret" || cfg.ReportNote != "costs $5" || cfg.Concurrency != 2 || cfg.Seed != "" {
+		t.Errorf("got api-token %q, report-note %q, concurrency %d, seed %q; want secret, \"costs $5\", 2 and empty",
+			cfg.APIToken, cfg.ReportNote, cfg.Concurrency, cfg.Seed)
+	}
+
+	_, err = parseConfig([]string{"-config", path, "-strict-env"})
+	if err == nil || !strings.Contains(err.Error(), "UNSET_METRICS_SEED") {
+		t.Errorf("-strict-env: got error %v, want one naming UNSET_METRICS_SEED", err)
+	}
+}
+
+func TestAPIEndpoint(t *testing.T) {
+	for _, tc := range []struct{ base, path, want string }{
+		{"http://localhost:4407", "/api/generate", "http://localhost:4407/api/generate"},
+		{"http://localhost:4407/", "api/generate", "http://localhost:4407/api/generate"},
+		{"https://gateway.example.com/keploy", "/v2/generate", "https://gateway.example.com/keploy/v2/generate"},
+	} {
+		if got, err := apiEndpoint(tc.base, tc.path); err != nil || got != tc.want {
+			t.Errorf("apiEndpoint(%q, %q) = %q, %v; want %q", tc.base, tc.path, got, err, tc.want)
+		}
+	}
+	for _, base := range []string{"localhost:4407", "/api", ""} {
+		if _, err := apiEndpoint(base, "/api/generate"); err == nil {
+			t.Errorf("apiEndpoint(%q) accepted a base without scheme and host", base)
+		}
+	}
+}
+
+// TestColumns checks that -columns sets the report columns in the order
+// given, and names the known columns when one is unknown.
+func TestColumns(t *testing.T) {
+	cfg, err := parseConfig([]string{"-columns", "status, path,final_coverage"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, c := range reportColumns(cfg) {
+		keys = append(keys, c.Key)
+	}
+	if got := strings.Join(keys, ","); got != "status,path,final_coverage" {
+		t.Errorf("got columns %s", got)
+	}
+
+	_, err = parseConfig([]string{"-columns", "path,coverage"})
+	if err == nil || !strings.Contains(err.Error(), `unknown column "coverage"`) || !strings.Contains(err.Error(), "final_coverage") {
+		t.Errorf("got error %v", err)
+	}
+}
+
+// TestDryValidateConfig checks that -dry-validate-config reports bad list
+// files and config JSON by position, and never contacts the server.
+func TestDryValidateConfig(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("server contacted: %s %s", r.Method, r.URL)
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	args := []string{"-dry-validate-config", "-root", dir, "-api-url", server.URL}
+
+	if code := run(append(args, "-tags-file", write("tags.txt", "api/** backend\n"))); code != exitOK {
+		t.Errorf("valid configuration: exit code %d", code)
+	}
+	if code := run(append(args, "-tags-file", write("bad-tags.txt", "api/** backend extra\n"))); code != exitFatal {
+		t.Errorf("invalid tags file: exit code %d, want %d", code, exitFatal)
+	}
+
+	_, err := parseConfig([]string{"-config", write("config.json", "{\n  \"retries\": 3,\n  \"timeout\" \"5s\"\n}\n")})
+	if err == nil || !strings.Contains(err.Error(), "config.json:3:13") {
+		t.Errorf("got error %v, want one pointing at line 3, column 13", err)
+	}
+}
+
+// TestConfigProfiles checks that -profile applies a named profile over the
+// config file's top-level values, that flags still win, and that an unknown
+// profile is an error naming the ones available.
+func TestConfigProfiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{"api-url": "http://localhost:8083", "concurrency": 2, "retries": 1,
+		"profiles": {"staging": {"api-url": "https://staging.example.com", "concurrency": 4}, "prod": {"api-url": "https://example.com"}}}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := parseConfig([]string{"-config", path, "-profile", "staging", "-concurrency", "8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.APIURL != "https://staging.example.com" || cfg.Concurrency != 8 || cfg.Retries != 1 {
+		t.Errorf("got api-url %q, concurrency %d, retries %d; want the staging URL, 8 and 1", cfg.APIURL, cfg.Concurrency, cfg.Retries)
+	}
+
+	_, err = parseConfig([]string{"-config", path, "-profile", "dev"})
+	if err == nil || !strings.Contains(err.Error(), `no profile "dev" (profiles: prod, staging)`) {
+		t.Errorf("unknown profile: got error %v", err)
+	}
+	if _, err := parseConfig([]string{"-profile", "staging"}); err == nil {
+		t.Error("-profile accepted without -config")
+	}
+}
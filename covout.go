@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// writeCovAnnotation writes <dir>/<name>.cov listing each line the server
+// reported as "<line>\tcovered" or "<line>\tuncovered", in line order.
+// Per-function rows add the function to the file name.
+func writeCovAnnotation(dir, name, function string, lines map[int]bool) (string, error) {
+	if function != "" {
+		name += "." + function
+	}
+	path := filepath.Join(dir, filepath.FromSlash(name)+".cov")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create coverage annotation directory: %w", err)
+	}
+
+	numbers := make([]int, 0, len(lines))
+	for n := range lines {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	var b strings.Builder
+	for _, n := range numbers {
+		status := "uncovered"
+		if lines[n] {
+			status = "covered"
+		}
+		fmt.Fprintf(&b, "%d\t%s\n", n, status)
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return "", fmt.Errorf("failed to write coverage annotation: %w", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestCovAnnotation checks that the line ranges a server reports end up in
+// the -cov-out annotation in line order.
+func TestCovAnnotation(t *testing.T) {
+	var lines map[int]bool
+	var warnings []ParseWarning
+	parseLineCoverage(map[string]interface{}{"coveredLines": "3-5, 9", "uncoveredLines": "1,6-7"}, &lines, &warnings)
+	parseLineCoverage(map[string]interface{}{"coveredLines": "7-6"}, &lines, &warnings)
+	if len(warnings) != 1 {
+		t.Errorf("got warnings %v, want one for the reversed range", warnings)
+	}
+
+	path, err := writeCovAnnotation(t.TempDir(), "pkg/a.py", "parse", lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(path) != "a.py.parse.cov" || filepath.Base(filepath.Dir(path)) != "pkg" {
+		t.Errorf("wrote %s", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "1\tuncovered\n3\tcovered\n4\tcovered\n5\tcovered\n6\tuncovered\n7\tuncovered\n9\tcovered\n"
+	if string(data) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", data, want)
+	}
+}
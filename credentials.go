@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// credentialKeys are the flags a credentials file must set.
+var credentialKeys = []string{"api-url", "api-token"}
+
+// loadCredentials applies a credentials file, either JSON
+// ({"api-url": ..., "api-token": ...}) or INI-style "key = value" lines,
+// to the flags not given on the command line. Keeping the token in a file
+// keeps it out of shell history; a warning is printed if others can read it.
+func loadCredentials(fs *flag.FlagSet, path string, commandLine map[string]bool) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to read credentials file: %w", err)
+	}
+	if info.Mode().Perm()&0o044 != 0 {
+		fmt.Printf("Warning: credentials file %s is readable by other users (mode %s); consider chmod 600\n", path, info.Mode().Perm())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read credentials file: %w", err)
+	}
+
+	values := make(map[string]string)
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		if err := json.Unmarshal(data, &values); err != nil {
+			return fmt.Errorf("failed to parse credentials file %s: %w", jsonErrorPosition(path, data, err), err)
+		}
+	} else if values, err = parseINI(data); err != nil {
+		return fmt.Errorf("failed to parse credentials file %s: %w", path, err)
+	}
+
+	for key := range values {
+		if !contains(credentialKeys, key) {
+			return fmt.Errorf("credentials file %s: unknown key %q", path, key)
+		}
+	}
+	for _, key := range credentialKeys {
+		if values[key] == "" {
+			return fmt.Errorf("credentials file %s: missing %q", path, key)
+		}
+		if commandLine[key] {
+			continue
+		}
+		if err := fs.Set(key, values[key]); err != nil {
+			return fmt.Errorf("credentials file %s: invalid value for %q: %w", path, key, err)
+		}
+	}
+	return nil
+}
+
+// parseINI reads "key = value" lines. Section headers and lines starting
+// with # or ; are ignored.
+func parseINI(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "[") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		values[strings.TrimSpace(key)] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	return values, scanner.Err()
+}
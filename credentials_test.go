@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCredentials checks both file formats and that credentials override
+// -config while flags on the command line override them.
+func TestCredentials(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	config := write("config.json", `{"api-url": "http://config:1", "api-token": "config-token"}`)
+	for _, path := range []string{
+		write("credentials.json", `{"api-url": "http://file:2", "api-token": "file-token"}`),
+		write("credentials.ini", "[default]\n; shared server\napi-url = http://file:2\napi-token = \"file-token\"\n"),
+	} {
+		cfg, err := parseConfig([]string{"-config", config, "-credentials", path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.APIURL != "http://file:2" || cfg.APIToken != "file-token" {
+			t.Errorf("%s: got %s and %s", filepath.Base(path), cfg.APIURL, cfg.APIToken)
+		}
+		cfg, err = parseConfig([]string{"-credentials", path, "-api-token", "flag-token"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.APIURL != "http://file:2" || cfg.APIToken != "flag-token" {
+			t.Errorf("%s with -api-token: got %s and %s", filepath.Base(path), cfg.APIURL, cfg.APIToken)
+		}
+	}
+
+	for data, want := range map[string]string{
+		`{"api-url": "http://file:2"}`:                                 `missing "api-token"`,
+		`{"api-url": "http://file:2", "api-token": "t", "proxy": "p"}`: `unknown key "proxy"`,
+	} {
+		_, err := parseConfig([]string{"-credentials", write("bad.json", data)})
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got error %v, want %q", data, err, want)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+package main
+
+import "fmt"
+
+// debugOutput is set by -debug for output that is only useful when
+// diagnosing a run.
+var debugOutput bool
+
+func debugf(format string, args ...interface{}) {
+	if debugOutput {
+		fmt.Printf("[debug] "+format+"\n", args...)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// directoryRequestsUnsupported is set once the server rejects a
+// -by-directory request; every later directory is requested file by file.
+var directoryRequestsUnsupported atomic.Bool
+
+// directoryJobs replaces the files with their directories under
+// -by-directory, returning each directory's files.
+func directoryJobs(cfg *Config, files []string, fileRoots map[string]sourceRoot) ([]string, map[string][]string) {
+	if !cfg.ByDirectory {
+		return files, nil
+	}
+	dirs, dirFiles := groupByDirectory(files, fileRoots)
+	fmt.Printf("Processing %d directories\n", len(dirs))
+	return dirs, dirFiles
+}
+
+// groupByDirectory turns the discovered files into their parent directories,
+// in the order each was first seen. A directory takes its first file's root.
+func groupByDirectory(files []string, fileRoots map[string]sourceRoot) ([]string, map[string][]string) {
+	var dirs []string
+	dirFiles := make(map[string][]string)
+	for _, file := range files {
+		dir := filepath.Dir(file)
+		if _, ok := dirFiles[dir]; !ok {
+			dirs = append(dirs, dir)
+			fileRoots[dir] = fileRoots[file]
+		}
+		dirFiles[dir] = append(dirFiles[dir], file)
+	}
+	return dirs, dirFiles
+}
+
+// runDirectoryJob sends one request for a directory's files. A server that
+// only handles files answers it as unsupported; the files are then
+// requested one by one and their metrics combined into the directory's.
+func runDirectoryJob(cfg *Config, job fileJob) attempt {
+	req := job.requests[0]
+	if !directoryRequestsUnsupported.Load() {
+		a := runRequest(cfg, req)
+		if !errors.Is(a.err, errUnsupported) {
+			return a
+		}
+		if !directoryRequestsUnsupported.Swap(true) {
+			fmt.Printf("Warning: the server does not support directory requests (%v); requesting files one at a time\n", a.err)
+		}
+	}
+
+	requests := make([]GenerateTestRequest, len(job.dirFiles))
+	for i, file := range job.dirFiles {
+		requests[i] = newGenerateTestRequest(cfg, req.RootDir, file, "")
+	}
+	return combineAttempts(req, runRequests(cfg, requests))
+}
+
+// combineAttempts merges the attempts for a directory's files into one.
+// Coverage is weighted by each file's total lines, as in the aggregate;
+// line and test counts add up. Unsupported files are left out, and the
+// first failure fails the directory.
+func combineAttempts(req GenerateTestRequest, attempts []attempt) attempt {
+	combined := attempt{request: req}
+	var initial, final float64
+	supported := 0
+	for _, a := range attempts {
+		if combined.startTime.IsZero() || a.startTime.Before(combined.startTime) {
+			combined.startTime = a.startTime
+		}
+		if a.endTime.After(combined.endTime) {
+			combined.endTime = a.endTime
+		}
+		if errors.Is(a.err, errUnsupported) {
+			continue
+		}
+		if a.err != nil {
+			if combined.err == nil {
+				combined.err = fmt.Errorf("%s: %w", a.request.SrcFilePath, a.err)
+			}
+			continue
+		}
+		supported++
+		m := a.metrics
+		initial += m.InitialCoverage * m.TotalLines
+		final += m.FinalCoverage * m.TotalLines
+		combined.metrics.LinesCovered += m.LinesCovered
+		combined.metrics.TotalLines += m.TotalLines
+		combined.metrics.TestAdded += m.TestAdded
+		combined.metrics.Warnings = append(combined.metrics.Warnings, m.Warnings...)
+		combined.metrics.StoppedEarly = combined.metrics.StoppedEarly || m.StoppedEarly
+		combined.metrics.Incomplete = combined.metrics.Incomplete || m.Incomplete
+		if combined.metrics.Server == (ServerInfo{}) {
+			combined.metrics.Server = m.Server
+		}
+		combined.zeroRetried = combined.zeroRetried || a.zeroRetried
+	}
+	if combined.err == nil && supported == 0 && len(attempts) > 0 {
+		combined.err = fmt.Errorf("%w: no file in %s is supported", errUnsupported, req.SrcFilePath)
+	}
+	if lines := combined.metrics.TotalLines; lines > 0 {
+		combined.metrics.InitialCoverage = initial / lines
+		combined.metrics.FinalCoverage = final / lines
+	}
+	if combined.endTime.IsZero() {
+		combined.endTime = time.Now()
+	}
+	combined.duration = combined.endTime.Sub(combined.startTime)
+	return combined
+}
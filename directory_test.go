@@ -0,0 +1,64 @@
+package main
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// TestByDirectory checks that -by-directory reports one row per directory,
+// and that when the server rejects directory requests each directory's
+// files are requested instead and their coverage combined by lines.
+func TestByDirectory(t *testing.T) {
+	dir := t.TempDir()
+	project := filepath.Join(dir, "project")
+	writeProject(t, project, "pkg/a.py", "pkg/b.py", "other/c.py")
+
+	for _, supported := range []bool{true, false} {
+		directoryRequestsUnsupported.Store(false)
+		var mu sync.Mutex
+		var requested []string
+		server := eventServer(t, func(req GenerateTestRequest) []map[string]string {
+			mu.Lock()
+			requested = append(requested, filepath.Base(req.SrcFilePath))
+			mu.Unlock()
+			if req.Directory != "" && !supported {
+				return []map[string]string{{"dataType": "error", "code": "unsupported", "message": "directories are not supported"}}
+			}
+			final, lines := "60%", "10"
+			if filepath.Base(req.SrcFilePath) == "b.py" {
+				final, lines = "80%", "30"
+			}
+			return []map[string]string{
+				{"dataType": "calculatedCoverage", "calculatedCoverage": "40%"},
+				{"dataType": "summary", "coverageIncreased": "Coverage is now " + final, "linesCovered": "6", "totalLines": lines, "testAdded": "1"},
+			}
+		})
+
+		output := filepath.Join(dir, "report.csv")
+		if code := run([]string{"-root", project, "-api-url", server.URL, "-format", "csv", "-output", output, "-by-directory"}); code != exitOK {
+			t.Errorf("supported %v: got exit code %d", supported, code)
+		}
+		rows, err := readReport(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]string{"pkg": "60", "other": "60"}
+		wantRequests := 2
+		if !supported {
+			// Only the first directory is tried as a whole; both are then
+			// requested file by file.
+			want["pkg"] = "75"
+			wantRequests = 4
+		}
+		for _, row := range rows {
+			if row["final_coverage"] != want[row["path"]] {
+				t.Errorf("supported %v: %s final coverage %q, want %q", supported, row["path"], row["final_coverage"], want[row["path"]])
+			}
+		}
+		if len(rows) != 2 || len(requested) != wantRequests {
+			t.Errorf("supported %v: %d rows after requests for %v, want 2 rows after %d requests", supported, len(rows), requested, wantRequests)
+		}
+	}
+	directoryRequestsUnsupported.Store(false)
+}
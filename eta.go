@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// etaEstimator predicts the time left in a run from each remaining file's
+// duration in the -timings history, or the average of the files finished so
+// far for files without one.
+type etaEstimator struct {
+	history map[string]time.Duration
+	current map[string]time.Duration
+	total   time.Duration
+}
+
+// timingKey identifies a file across runs by root label and relative path.
+func timingKey(root, path string) string {
+	return root + "\x00" + normalizePath(path, "unix")
+}
+
+// loadTimings reads per-file durations from a prior report or timings
+// file, summing the rows of per-function reports. A missing file is an
+// empty history.
+func loadTimings(path string) (map[string]time.Duration, error) {
+	history := make(map[string]time.Duration)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return history, nil
+	}
+	rows, err := readReport(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if d, err := time.ParseDuration(row["duration"]); err == nil {
+			history[timingKey(row["root"], row["path"])] += d
+		}
+	}
+	return history, nil
+}
+
+func newETAEstimator(history map[string]time.Duration) *etaEstimator {
+	return &etaEstimator{history: history, current: make(map[string]time.Duration)}
+}
+
+func (e *etaEstimator) Record(key string, d time.Duration) {
+	e.current[key] += d
+	e.total += d
+}
+
+// Remaining estimates the time the files with the given keys will take on
+// workers parallel workers. It is unknown until every file has either a
+// history or a finished file to average.
+func (e *etaEstimator) Remaining(keys []string, workers int) (time.Duration, bool) {
+	var left time.Duration
+	for _, key := range keys {
+		if d, ok := e.history[key]; ok {
+			left += d
+			continue
+		}
+		if len(e.current) == 0 {
+			return 0, false
+		}
+		left += e.total / time.Duration(len(e.current))
+	}
+	return left / time.Duration(workers), true
+}
+
+// timingColumns are the only columns of a timings file written by Save.
+var timingColumns = map[string]bool{"root": true, "path": true, "duration": true}
+
+// saveTimings records this run's durations to -timings, if asked for.
+func saveTimings(cfg *Config, e *etaEstimator) {
+	if cfg.Timings == "" {
+		return
+	}
+	if err := e.Save(cfg.Timings); err != nil {
+		fmt.Println("Timings not recorded:", err)
+	} else {
+		fmt.Printf("Timings saved as %s\n", cfg.Timings)
+	}
+}
+
+// Save writes the history updated with this run's durations to path as a
+// small CSV report. A full report given as -timings is left untouched.
+func (e *etaEstimator) Save(path string) error {
+	if !strings.EqualFold(filepath.Ext(path), ".csv") {
+		return fmt.Errorf("timings are only recorded to a .csv file, not %s", path)
+	}
+	if keys, _, err := readReportTable(path); err == nil {
+		for _, key := range keys {
+			if !timingColumns[key] {
+				return fmt.Errorf("%s is a full report; not overwriting it with timings", path)
+			}
+		}
+	}
+	merged := make(map[string]time.Duration, len(e.history)+len(e.current))
+	for key, d := range e.history {
+		merged[key] = d
+	}
+	for key, d := range e.current {
+		merged[key] = d
+	}
+	keys := make([]string, 0, len(merged))
+	for key := range merged {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return writeFileAtomic(path, func(out io.Writer) error {
+		w := csv.NewWriter(out)
+		w.Write([]string{columnByKey("root").Header, columnByKey("path").Header, columnByKey("duration").Header})
+		for _, key := range keys {
+			root, path, _ := strings.Cut(key, "\x00")
+			w.Write([]string{root, path, merged[key].String()})
+		}
+		w.Flush()
+		return w.Error()
+	})
+}
+
+// progressBar draws a percentage as a fixed-width text bar.
+func progressBar(percent float64) string {
+	const width = 20
+	filled := int(percent / 100 * width)
+	return "[" + strings.Repeat("#", filled) + strings.Repeat("-", width-filled) + "]"
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestETAEstimator checks that remaining time comes from the history where
+// there is one and the current run's average otherwise, split over workers.
+func TestETAEstimator(t *testing.T) {
+	a, b, c := timingKey("", "a.py"), timingKey("", "b.py"), timingKey("", "c.py")
+	e := newETAEstimator(map[string]time.Duration{a: 4 * time.Second})
+	if left, ok := e.Remaining([]string{a}, 1); !ok || left != 4*time.Second {
+		t.Errorf("history only: %v, %v; want 4s", left, ok)
+	}
+	if _, ok := e.Remaining([]string{a, b}, 1); ok {
+		t.Error("estimate known before any file without history finished")
+	}
+	e.Record(c, 2*time.Second)
+	if left, ok := e.Remaining([]string{a, b}, 2); !ok || left != 3*time.Second {
+		t.Errorf("history and average on 2 workers: %v, %v; want 3s", left, ok)
+	}
+}
+
+// TestTimingsRoundTrip checks that saved timings load back for the next
+// run, and that a full report given as -timings is not overwritten.
+func TestTimingsRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "timings.csv")
+	history, err := loadTimings(path)
+	if err != nil || len(history) != 0 {
+		t.Fatalf("missing file: %v, %v; want an empty history", history, err)
+	}
+	history[timingKey("svc", "a.py")] = time.Second
+	e := newETAEstimator(history)
+	e.Record(timingKey("svc", `pkg\b.py`), 1500*time.Millisecond)
+	if err := e.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadTimings(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 2 || loaded[timingKey("svc", "a.py")] != time.Second || loaded[timingKey("svc", "pkg/b.py")] != 1500*time.Millisecond {
+		t.Errorf("loaded %v", loaded)
+	}
+
+	report := filepath.Join(dir, "report.csv")
+	if err := os.WriteFile(report, []byte("Filepath,Status,Duration\na.py,ok,1s\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Save(report); err == nil {
+		t.Error("a full report was overwritten with timings")
+	}
+	if err := e.Save(filepath.Join(dir, "timings.json")); err == nil {
+		t.Error("timings saved to a non-CSV file")
+	}
+}
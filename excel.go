@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+
+	"github.com/xuri/excelize/v2"
+)
+
+type excelExporter struct {
+	cols      []Column
+	file      *excelize.File
+	sheet     string
+	path      string
+	headerRow int
+	dataRow   int
+	row       int
+	style     *ExcelStyle
+	widths    []int
+	warnings  [][]string
+}
+
+// newExcelExporter writes the optional metadata block, followed by a blank
+// row, and then the header; data rows start right below the header. In
+// append mode an existing workbook is reopened instead and rows continue
+// after its last populated row.
+func newExcelExporter(path string, cols []Column, style *ExcelStyle, meta ReportMetadata, appendMode bool) (*excelExporter, error) {
+	e := &excelExporter{cols: cols, sheet: "Execution Log", path: path, style: style, widths: make([]int, len(cols))}
+	e.setHeaderRow(1)
+	if appendMode {
+		if _, err := os.Stat(path); err == nil {
+			return e, e.reopen()
+		}
+	}
+
+	e.file = excelize.NewFile()
+	e.file.SetSheetName("Sheet1", e.sheet)
+	if meta.Enabled() {
+		for i, pair := range meta.Rows() {
+			e.file.SetCellValue(e.sheet, fmt.Sprintf("A%d", i+1), pair[0])
+			e.file.SetCellValue(e.sheet, fmt.Sprintf("B%d", i+1), pair[1])
+		}
+		e.setHeaderRow(len(meta.Rows()) + 2)
+	}
+	e.writeHeader()
+	return e, nil
+}
+
+// setHeaderRow places the header; everything below it that depends on
+// where the data starts reads dataRow rather than assuming row 2.
+func (e *excelExporter) setHeaderRow(row int) {
+	e.headerRow = row
+	e.dataRow = row + 1
+}
+
+func (e *excelExporter) writeHeader() {
+	for col, c := range e.cols {
+		cell, _ := excelize.CoordinatesToCellName(col+1, e.headerRow)
+		e.file.SetCellValue(e.sheet, cell, c.Header)
+		e.track(col, c.Header)
+	}
+	e.row = e.dataRow
+}
+
+// reopen loads an existing report for appending. The header is located by
+// its first column (A1, or below a metadata block) and is not written again;
+// a header with different columns is rejected rather than mixing schemas.
+func (e *excelExporter) reopen() error {
+	f, err := excelize.OpenFile(e.path)
+	if err != nil {
+		return fmt.Errorf("failed to open existing report: %w", err)
+	}
+	e.file = f
+	if idx, _ := f.GetSheetIndex(e.sheet); idx < 0 {
+		e.sheet = f.GetSheetName(0)
+	}
+	rows, err := f.GetRows(e.sheet)
+	if err != nil {
+		return fmt.Errorf("failed to read existing report: %w", err)
+	}
+	if len(rows) == 0 {
+		e.writeHeader()
+		return nil
+	}
+
+	for i, record := range rows {
+		if len(record) == 0 || record[0] != e.cols[0].Header {
+			continue
+		}
+		for col, c := range e.cols {
+			if col >= len(record) || record[col] != c.Header {
+				return fmt.Errorf("existing report %s has different columns; use a new -output", e.path)
+			}
+			e.track(col, c.Header)
+		}
+		e.setHeaderRow(i + 1)
+		e.row = max(len(rows)+1, e.dataRow)
+		fmt.Printf("Appending to %s after row %d\n", e.path, len(rows))
+		return nil
+	}
+	return fmt.Errorf("existing report %s has no %q header", e.path, e.cols[0].Header)
+}
+
+// Write adds a row and saves the workbook so progress survives a crash.
+func (e *excelExporter) Write(r Result) error {
+	for col, c := range e.cols {
+		cell, _ := excelize.CoordinatesToCellName(col+1, e.row)
+		value := c.Value(r)
+		e.file.SetCellValue(e.sheet, cell, value)
+		e.track(col, value)
+	}
+	e.row++
+	e.warnings = append(e.warnings, warningRecords(r)...)
+	return e.save()
+}
+
+// save replaces the report on disk atomically, so a run interrupted mid-save
+// still leaves the previous complete workbook.
+func (e *excelExporter) save() error {
+	return writeFileAtomic(e.path, func(w io.Writer) error {
+		_, err := e.file.WriteTo(w)
+		return err
+	})
+}
+
+// track records the widest value per column for auto-sizing.
+func (e *excelExporter) track(col int, value interface{}) {
+	if n := utf8.RuneCountInString(fmt.Sprint(value)); n > e.widths[col] {
+		e.widths[col] = n
+	}
+}
+
+func (e *excelExporter) Close() error {
+	if err := e.applyStyle(); err != nil {
+		fmt.Println("Warning: failed to style Excel report:", err)
+	}
+	if columnIndex(e.cols, "tags") >= 0 {
+		if err := e.writeTagSheet(); err != nil {
+			fmt.Println("Warning: failed to write Tags sheet:", err)
+		}
+	}
+	if len(e.warnings) > 0 {
+		if err := e.writeWarningSheet(); err != nil {
+			fmt.Println("Warning: failed to write Warnings sheet:", err)
+		}
+	}
+	if err := e.save(); err != nil {
+		return err
+	}
+	return e.file.Close()
+}
+
+// applyStyle sizes columns to their content and bolds the header, then
+// applies any -excel-style overrides on top.
+func (e *excelExporter) applyStyle() error {
+	style := e.style
+	if style == nil {
+		style = &ExcelStyle{}
+	}
+
+	headerStyle := excelize.Style{Font: &excelize.Font{Bold: true}}
+	if style.Header.Bold != nil {
+		headerStyle.Font.Bold = *style.Header.Bold
+	}
+	if style.Header.FontColor != "" {
+		headerStyle.Font.Color = style.Header.FontColor
+	}
+	if style.Header.Fill != "" {
+		headerStyle.Fill = excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{style.Header.Fill}}
+	}
+	headerID, err := e.file.NewStyle(&headerStyle)
+	if err != nil {
+		return err
+	}
+	firstHeader, _ := excelize.CoordinatesToCellName(1, e.headerRow)
+	lastHeader, _ := excelize.CoordinatesToCellName(len(e.cols), e.headerRow)
+	if err := e.file.SetCellStyle(e.sheet, firstHeader, lastHeader, headerID); err != nil {
+		return err
+	}
+
+	for i, c := range e.cols {
+		name, _ := excelize.ColumnNumberToName(i + 1)
+		width := float64(e.widths[i] + 2)
+		if width > maxAutoColumnWidth {
+			width = maxAutoColumnWidth
+		}
+		colStyle := style.Columns[c.Key]
+		if colStyle.Width > 0 {
+			width = colStyle.Width
+		}
+		if err := e.file.SetColWidth(e.sheet, name, name, width); err != nil {
+			return err
+		}
+
+		if colStyle.NumberFormat != "" && e.row > e.dataRow {
+			numFmt := colStyle.NumberFormat
+			id, err := e.file.NewStyle(&excelize.Style{CustomNumFmt: &numFmt})
+			if err != nil {
+				return err
+			}
+			if err := e.file.SetCellStyle(e.sheet, fmt.Sprintf("%s%d", name, e.dataRow), fmt.Sprintf("%s%d", name, e.row-1), id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeTagSheet adds a Tags sheet with one aggregate row per tag. It is
+// computed from the rows in the workbook, so appended runs are included.
+func (e *excelExporter) writeTagSheet() error {
+	table, err := e.file.GetRows(e.sheet, excelize.Options{RawCellValue: true})
+	if err != nil {
+		return err
+	}
+	_, rows, err := tableToRows(table)
+	if err != nil {
+		return err
+	}
+	var results []Result
+	for _, row := range rows {
+		r, err := rowToResult(row)
+		if err != nil {
+			return err
+		}
+		results = append(results, r)
+	}
+
+	const sheet = "Tags"
+	if idx, _ := e.file.GetSheetIndex(sheet); idx >= 0 {
+		e.file.DeleteSheet(sheet)
+	}
+	if _, err := e.file.NewSheet(sheet); err != nil {
+		return err
+	}
+	e.file.SetSheetRow(sheet, "A1", &[]interface{}{"Tag", "Files", "Initial Coverage", "Final Coverage", "Total Lines", "Tests Added"})
+	names, summaries := tagSummaries(results)
+	for i, tag := range names {
+		s := summaries[tag]
+		cell, _ := excelize.CoordinatesToCellName(1, i+2)
+		e.file.SetSheetRow(sheet, cell, &[]interface{}{tag, s.Processed, roundTo(s.InitialCoverage(), 2), roundTo(s.FinalCoverage(), 2), s.TotalLines, s.TestsAdded})
+	}
+	return nil
+}
+
+// writeWarningSheet lists the run's parse warnings on a Warnings sheet,
+// after any rows an appended report already has there.
+func (e *excelExporter) writeWarningSheet() error {
+	const sheet = "Warnings"
+	next := 2
+	if idx, _ := e.file.GetSheetIndex(sheet); idx >= 0 {
+		rows, err := e.file.GetRows(sheet)
+		if err != nil {
+			return err
+		}
+		next = len(rows) + 1
+	} else {
+		if _, err := e.file.NewSheet(sheet); err != nil {
+			return err
+		}
+		e.file.SetSheetRow(sheet, "A1", &warningHeaders)
+	}
+	for i, record := range e.warnings {
+		cell, _ := excelize.CoordinatesToCellName(1, next+i)
+		e.file.SetSheetRow(sheet, cell, &record)
+	}
+	return nil
+}
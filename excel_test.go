@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// TestExcelAppendLayout writes a workbook with a metadata block, then
+// appends to it, and checks that the header and every data row land below
+// the block without overwriting it.
+func TestExcelAppendLayout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "layout.xlsx")
+	cols := []Column{*columnByKey("path"), *columnByKey("status")}
+	meta := ReportMetadata{Title: "Layout", Note: "metadata block"}
+	for i, name := range []string{"first.py", "second.py"} {
+		e, err := newExcelExporter(path, cols, nil, meta, i > 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Write(Result{Path: name, Status: statusOK}); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	headerRow := len(meta.Rows()) + 2
+	for cell, want := range map[string]string{
+		"A1":                            "Title",
+		"B2":                            "metadata block",
+		fmt.Sprintf("A%d", headerRow):   columnByKey("path").Header,
+		fmt.Sprintf("A%d", headerRow+1): "first.py",
+		fmt.Sprintf("A%d", headerRow+2): "second.py",
+	} {
+		if got, _ := f.GetCellValue("Execution Log", cell); got != want {
+			t.Errorf("cell %s is %q, want %q", cell, got, want)
+		}
+	}
+}
+
+// TestExcelStyle checks that columns are sized to their content and that
+// -excel-style widths override that, and that bad colors are rejected.
+func TestExcelStyle(t *testing.T) {
+	dir := t.TempDir()
+	stylePath := filepath.Join(dir, "style.json")
+	if err := os.WriteFile(stylePath, []byte(`{"header": {"fill": "#DDEBF7"}, "columns": {"status": {"width": 30}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	style, err := loadExcelStyle(stylePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "styled.xlsx")
+	e, err := newExcelExporter(path, []Column{*columnByKey("path"), *columnByKey("status")}, style, ReportMetadata{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Write(Result{Path: "a/rather/long/path/to/module.py", Status: statusOK}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for col, want := range map[string]float64{"A": float64(len("a/rather/long/path/to/module.py") + 2), "B": 30} {
+		if got, _ := f.GetColWidth("Execution Log", col); got != want {
+			t.Errorf("column %s is %v wide, want %v", col, got, want)
+		}
+	}
+
+	if err := os.WriteFile(stylePath, []byte(`{"header": {"fill": "blue"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadExcelStyle(stylePath); err == nil {
+		t.Error("invalid fill color accepted")
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+)
+
+const maxAutoColumnWidth = 80
+
+// ExcelStyle is the -excel-style file format, for example:
+//
+//	{
+//	  "header": {"bold": true, "fill": "#DDEBF7", "font_color": "#1F1F1F"},
+//	  "columns": {
+//	    "path": {"width": 60},
+//	    "final_coverage": {"number_format": "0.00"}
+//	  }
+//	}
+//
+// Columns are keyed by column key. Anything left out keeps the defaults:
+// a bold header and widths sized to the content.
+type ExcelStyle struct {
+	Header  HeaderStyle            `json:"header"`
+	Columns map[string]ColumnStyle `json:"columns"`
+}
+
+type HeaderStyle struct {
+	Bold      *bool  `json:"bold"`
+	Fill      string `json:"fill"`
+	FontColor string `json:"font_color"`
+}
+
+type ColumnStyle struct {
+	Width        float64 `json:"width"`
+	NumberFormat string  `json:"number_format"`
+}
+
+var hexColor = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+// loadExcelStyle reads and validates a style file. Unknown keys are reported
+// as warnings so a typo doesn't abort a long run.
+func loadExcelStyle(path string) (*ExcelStyle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Excel style: %w", err)
+	}
+	var style ExcelStyle
+	if err := json.Unmarshal(data, &style); err != nil {
+		return nil, fmt.Errorf("failed to parse Excel style %s: %w", jsonErrorPosition(path, data, err), err)
+	}
+
+	var raw struct {
+		Header  map[string]json.RawMessage            `json:"header"`
+		Columns map[string]map[string]json.RawMessage `json:"columns"`
+	}
+	var top map[string]json.RawMessage
+	json.Unmarshal(data, &top)
+	json.Unmarshal(data, &raw)
+	warnUnknownKeys(top, path, "", "header", "columns")
+	warnUnknownKeys(raw.Header, path, "header.", "bold", "fill", "font_color")
+	for key, col := range raw.Columns {
+		warnUnknownKeys(col, path, "columns."+key+".", "width", "number_format")
+	}
+
+	for _, color := range []string{style.Header.Fill, style.Header.FontColor} {
+		if color != "" && !hexColor.MatchString(color) {
+			return nil, fmt.Errorf("Excel style %s: invalid color %q, expected #RRGGBB", path, color)
+		}
+	}
+	for key, col := range style.Columns {
+		if columnByKey(key) == nil {
+			fmt.Printf("Warning: Excel style %s: unknown column %q\n", path, key)
+		}
+		if col.Width < 0 || col.Width > 255 {
+			return nil, fmt.Errorf("Excel style %s: width of %q must be between 0 and 255", path, key)
+		}
+	}
+	return &style, nil
+}
+
+func warnUnknownKeys(values map[string]json.RawMessage, path, prefix string, known ...string) {
+	var unknown []string
+	for key := range values {
+		if !contains(known, key) {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		fmt.Printf("Warning: Excel style %s: unknown key %q\n", path, prefix+key)
+	}
+}
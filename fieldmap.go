@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseFieldMap reads -field-map entries of the form field=path, where path
+// is a dotted path into the decoded event such as summary.metrics.coverage.
+// Numeric segments index into arrays.
+func parseFieldMap(entries []string) (map[string][]string, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	fieldMap := make(map[string][]string, len(entries))
+	for _, entry := range entries {
+		field, path, ok := strings.Cut(entry, "=")
+		field, path = strings.TrimSpace(field), strings.TrimSpace(path)
+		if !ok || field == "" || path == "" {
+			return nil, fmt.Errorf("invalid -field-map entry %q: expected field=path", entry)
+		}
+		segments := strings.Split(path, ".")
+		for _, segment := range segments {
+			if segment == "" {
+				return nil, fmt.Errorf("invalid -field-map path %q: empty segment", path)
+			}
+		}
+		fieldMap[field] = segments
+	}
+	return fieldMap, nil
+}
+
+// lookupPath walks a dotted path through nested objects and arrays.
+func lookupPath(value interface{}, path []string) (interface{}, bool) {
+	for _, segment := range path {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			next, ok := v[segment]
+			if !ok {
+				return nil, false
+			}
+			value = next
+		case []interface{}:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			value = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// mapFields copies each mapped value to its flat field name, so the parser
+// reads nested payloads exactly like flat ones. Fields whose path is absent
+// from the event are left as they are.
+func mapFields(event map[string]interface{}, fieldMap map[string][]string) {
+	for field, path := range fieldMap {
+		if value, ok := lookupPath(event, path); ok {
+			event[field] = value
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// functionTarget is a function to generate tests for. ID identifies the
+// function itself, so a function re-exported from several files can be
+// recognised; it defaults to "path:function".
+type functionTarget struct {
+	Name string
+	ID   string
+}
+
+// loadFunctionList reads "relative/path.py:function [id]" lines into a map
+// from slash-separated relative path to the functions to target, in file
+// order. Blank lines and lines starting with # are ignored.
+func loadFunctionList(path string) (map[string][]functionTarget, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open function list: %w", err)
+	}
+	defer f.Close()
+
+	functions := make(map[string][]functionTarget)
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		line := fields[0]
+		i := strings.LastIndex(line, ":")
+		if i <= 0 || i == len(line)-1 || len(fields) > 2 {
+			return nil, fmt.Errorf("%s:%d: expected \"path:function [id]\", got %q", path, lineNo, scanner.Text())
+		}
+		file := filepath.ToSlash(filepath.Clean(line[:i]))
+		target := functionTarget{Name: line[i+1:], ID: file + ":" + line[i+1:]}
+		if len(fields) == 2 {
+			target.ID = fields[1]
+		}
+		functions[file] = append(functions[file], target)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read function list: %w", err)
+	}
+	return functions, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoadFunctionList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "functions.txt")
+	data := "# targets\n./pkg/a.py:parse\npkg/a.py:render shared.render\n\nb.py:main\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	functions, err := loadFunctionList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]functionTarget{
+		"pkg/a.py": {{Name: "parse", ID: "pkg/a.py:parse"}, {Name: "render", ID: "shared.render"}},
+		"b.py":     {{Name: "main", ID: "b.py:main"}},
+	}
+	if !reflect.DeepEqual(functions, want) {
+		t.Errorf("got %v, want %v", functions, want)
+	}
+
+	for _, line := range []string{"a.py", "a.py:", ":main", "a.py:main id extra"} {
+		if err := os.WriteFile(path, []byte(line+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadFunctionList(path); err == nil {
+			t.Errorf("%q accepted", line)
+		}
+	}
+}
+
+// functionTransport answers each function's request after delay[function],
+// or 5ms for functions not listed, tracking how many requests are in flight at once.
+type functionTransport struct {
+	delay             map[string]time.Duration
+	inFlight, maxSeen *int32
+}
+
+func (t functionTransport) Stream(ctx context.Context, req GenerateTestRequest) (<-chan StreamEvent, error) {
+	n := atomic.AddInt32(t.inFlight, 1)
+	for {
+		seen := atomic.LoadInt32(t.maxSeen)
+		if n <= seen || atomic.CompareAndSwapInt32(t.maxSeen, seen, n) {
+			break
+		}
+	}
+	delay, ok := t.delay[req.FunctionUnderTest]
+	if !ok {
+		delay = 5 * time.Millisecond
+	}
+	time.Sleep(delay)
+	atomic.AddInt32(t.inFlight, -1)
+	return fakeTransport{[]StreamEvent{{Fields: map[string]interface{}{"dataType": "summary", "coverageIncreased": "Coverage increased to 50%", "testAdded": "1"}}}}.Stream(ctx, req)
+}
+
+// TestRunRequestsOrder checks that a file's per-function requests run at
+// most -function-concurrency at a time and come back in request order.
+func TestRunRequestsOrder(t *testing.T) {
+	transport := functionTransport{
+		delay:    map[string]time.Duration{"slow": 30 * time.Millisecond},
+		inFlight: new(int32),
+		maxSeen:  new(int32),
+	}
+	cfg := &Config{transport: transport, FunctionConcurrency: 2}
+	names := []string{"slow", "a", "b", "c"}
+	var requests []GenerateTestRequest
+	for _, name := range names {
+		requests = append(requests, GenerateTestRequest{SrcFilePath: "a.py", FunctionUnderTest: name})
+	}
+	attempts := runRequests(cfg, requests)
+	for i, a := range attempts {
+		if a.err != nil || a.request.FunctionUnderTest != names[i] {
+			t.Errorf("attempt %d is for %q (error %v), want %q", i, a.request.FunctionUnderTest, a.err, names[i])
+		}
+	}
+	if got := atomic.LoadInt32(transport.maxSeen); got != 2 {
+		t.Errorf("%d requests in flight at once, want 2", got)
+	}
+}
+
+// TestDedupeFunctions checks that -dedupe-functions requests a function ID
+// re-exported from a second file only once.
+func TestDedupeFunctions(t *testing.T) {
+	root := "project"
+	functions := map[string][]functionTarget{
+		"a.py": {{Name: "parse", ID: "shared.parse"}, {Name: "render", ID: "a.py:render"}},
+		"b.py": {{Name: "parse", ID: "shared.parse"}, {Name: "main", ID: "b.py:main"}},
+	}
+	for _, tc := range []struct {
+		dedupe     bool
+		want       []string
+		duplicates int
+	}{
+		{false, []string{"parse", "main"}, 0},
+		{true, []string{"main"}, 1},
+	} {
+		cfg := &Config{PerFunction: true, DedupeFunctions: tc.dedupe}
+		seen := make(map[string]bool)
+		newFileJob(cfg, root, 0, filepath.Join(root, "a.py"), functions, seen, nil)
+		job := newFileJob(cfg, root, 1, filepath.Join(root, "b.py"), functions, seen, nil)
+		var names []string
+		for _, req := range job.requests {
+			names = append(names, req.FunctionUnderTest)
+		}
+		if !reflect.DeepEqual(names, tc.want) || job.duplicates != tc.duplicates {
+			t.Errorf("-dedupe-functions %v: b.py requests %v with %d duplicates, want %v and %d", tc.dedupe, names, job.duplicates, tc.want, tc.duplicates)
+		}
+	}
+}
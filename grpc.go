@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const generateTestsMethod = "/metrics.TestGenerator/GenerateTests"
+
+// grpcTransport calls the GenerateTests server-streaming RPC defined in
+// proto/generator.proto on the -api-url host, using TLS for https URLs.
+type grpcTransport struct {
+	cfg  *Config
+	conn *grpc.ClientConn
+}
+
+func newGRPCTransport(cfg *Config) (*grpcTransport, error) {
+	u, err := url.Parse(cfg.APIURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -api-url %q: %w", cfg.APIURL, err)
+	}
+	creds := insecure.NewCredentials()
+	if u.Scheme == "https" {
+		creds = credentials.NewTLS(&tls.Config{})
+	}
+	conn, err := grpc.NewClient(u.Host, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up gRPC client: %w", err)
+	}
+	return &grpcTransport{cfg: cfg, conn: conn}, nil
+}
+
+func (t *grpcTransport) Stream(ctx context.Context, req GenerateTestRequest) (<-chan StreamEvent, error) {
+	cancel := func() {}
+	if t.cfg.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, t.cfg.Timeout)
+	}
+	if t.cfg.APIToken != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+t.cfg.APIToken)
+	}
+
+	stream, err := t.conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, generateTestsMethod, grpc.ForceCodec(protoCodec{}))
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to start gRPC stream: %w", err)
+	}
+	if err := stream.SendMsg(&req); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to send gRPC request: %w", err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to send gRPC request: %w", err)
+	}
+	fmt.Printf("Streaming response for %s:\n", req.SrcFilePath)
+
+	events := make(chan StreamEvent)
+	go func() {
+		defer close(events)
+		defer cancel()
+		if md, err := stream.Header(); err == nil {
+			if ids := md.Get("x-request-id"); len(ids) > 0 {
+				if !emit(ctx, events, StreamEvent{Fields: map[string]interface{}{"requestId": ids[0]}, Header: true}) {
+					return
+				}
+			}
+		}
+		for {
+			var event StreamEvent
+			err := stream.RecvMsg(&event)
+			if err == io.EOF {
+				fmt.Println("\nStream ended.")
+				return
+			}
+			if err != nil {
+				emit(ctx, events, StreamEvent{Err: fmt.Errorf("error reading gRPC stream: %w", err)})
+				return
+			}
+			if !emit(ctx, events, event) {
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+// streamEventFields maps StreamEvent field numbers to the JSON event keys,
+// so gRPC events are parsed exactly like HTTP ones. Empty fields are left
+// out, as they are absent from HTTP events.
+var streamEventFields = map[protowire.Number]string{
+	1:  "dataType",
+	2:  "calculatedCoverage",
+	3:  "coverageIncreased",
+	4:  "linesCovered",
+	5:  "totalLines",
+	6:  "testAdded",
+	7:  "flakinessDetected",
+	8:  "flakyRuns",
+	9:  "coveredLines",
+	10: "uncoveredLines",
+	11: "schemaVersion",
+	12: "serverVersion",
+	13: "initialCoverage",
+	14: "finalCoverage",
+	15: "unitCoverage",
+	16: "integrationCoverage",
+	17: "sourceFilePath",
+	18: "requestId",
+	19: "message",
+	20: "code",
+	21: "percentage",
+	22: "progress",
+}
+
+// protoCodec encodes the two messages of proto/generator.proto with
+// protowire, which avoids generated code for such small messages. It works
+// in both directions so the self-test can serve the RPC as well.
+type protoCodec struct{}
+
+func (protoCodec) Name() string { return "proto" }
+
+func (protoCodec) Marshal(v interface{}) ([]byte, error) {
+	var b []byte
+	appendString := func(num protowire.Number, s string) {
+		if s != "" {
+			b = protowire.AppendTag(b, num, protowire.BytesType)
+			b = protowire.AppendString(b, s)
+		}
+	}
+	appendVarint := func(num protowire.Number, n uint64) {
+		if n != 0 {
+			b = protowire.AppendTag(b, num, protowire.VarintType)
+			b = protowire.AppendVarint(b, n)
+		}
+	}
+	switch m := v.(type) {
+	case *GenerateTestRequest:
+		appendString(1, m.SrcFilePath)
+		appendString(2, m.RootDir)
+		appendString(3, m.AdditionalPrompt)
+		appendVarint(4, uint64(int64(m.MaxIterations)))
+		appendVarint(5, protowire.EncodeBool(m.Flakiness))
+		appendString(6, m.FunctionUnderTest)
+		if m.ExpectedCoverage != 0 {
+			b = protowire.AppendTag(b, 7, protowire.Fixed64Type)
+			b = protowire.AppendFixed64(b, math.Float64bits(m.ExpectedCoverage))
+		}
+		appendVarint(8, protowire.EncodeBool(m.MeasureOnly))
+		if m.Seed != nil {
+			b = protowire.AppendTag(b, 9, protowire.VarintType)
+			b = protowire.AppendVarint(b, uint64(*m.Seed))
+		}
+		for _, file := range m.Files {
+			b = protowire.AppendTag(b, 10, protowire.BytesType)
+			b = protowire.AppendString(b, file)
+		}
+		appendString(11, m.Directory)
+	case *StreamEvent:
+		for num := protowire.Number(1); num <= protowire.Number(len(streamEventFields)); num++ {
+			value, _ := m.Fields[streamEventFields[num]].(string)
+			appendString(num, value)
+		}
+	default:
+		return nil, fmt.Errorf("cannot encode %T", v)
+	}
+	return b, nil
+}
+
+func (protoCodec) Unmarshal(data []byte, v interface{}) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		n = protowire.ConsumeFieldValue(num, typ, data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		if err := decodeField(v, num, typ, data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// decodeField stores one field of a message. Unknown fields and fields with
+// an unexpected wire type are skipped, as protobuf decoders do.
+func decodeField(v interface{}, num protowire.Number, typ protowire.Type, value []byte) error {
+	str := func() string {
+		s, _ := protowire.ConsumeString(value)
+		return s
+	}
+	varint := func() uint64 {
+		n, _ := protowire.ConsumeVarint(value)
+		return n
+	}
+	switch m := v.(type) {
+	case *StreamEvent:
+		if m.Fields == nil {
+			m.Fields = make(map[string]interface{})
+		}
+		if key, ok := streamEventFields[num]; ok && typ == protowire.BytesType && str() != "" {
+			m.Fields[key] = str()
+		}
+	case *GenerateTestRequest:
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			m.SrcFilePath = str()
+		case num == 2 && typ == protowire.BytesType:
+			m.RootDir = str()
+		case num == 3 && typ == protowire.BytesType:
+			m.AdditionalPrompt = str()
+		case num == 4 && typ == protowire.VarintType:
+			m.MaxIterations = int(int32(varint()))
+		case num == 5 && typ == protowire.VarintType:
+			m.Flakiness = protowire.DecodeBool(varint())
+		case num == 6 && typ == protowire.BytesType:
+			m.FunctionUnderTest = str()
+		case num == 7 && typ == protowire.Fixed64Type:
+			bits, _ := protowire.ConsumeFixed64(value)
+			m.ExpectedCoverage = math.Float64frombits(bits)
+		case num == 8 && typ == protowire.VarintType:
+			m.MeasureOnly = protowire.DecodeBool(varint())
+		case num == 9 && typ == protowire.VarintType:
+			seed := int64(varint())
+			m.Seed = &seed
+		case num == 10 && typ == protowire.BytesType:
+			m.Files = append(m.Files, str())
+		case num == 11 && typ == protowire.BytesType:
+			m.Directory = str()
+		}
+	default:
+		return fmt.Errorf("cannot decode into %T", v)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestProtoCodecEventFields round-trips error and progress events through
+// the gRPC codec and checks their parsers still see the fields.
+func TestProtoCodecEventFields(t *testing.T) {
+	roundTrip := func(fields map[string]interface{}) map[string]interface{} {
+		t.Helper()
+		data, err := protoCodec{}.Marshal(&StreamEvent{Fields: fields})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var event StreamEvent
+		if err := (protoCodec{}).Unmarshal(data, &event); err != nil {
+			t.Fatal(err)
+		}
+		return event.Fields
+	}
+
+	event := roundTrip(map[string]interface{}{"dataType": "error", "code": "unsupported", "message": "language not supported"})
+	if err := unsupportedEvent(event); !errors.Is(err, errUnsupported) {
+		t.Errorf("error event: got %v, want %v", err, errUnsupported)
+	}
+	for _, field := range []string{"percentage", "progress"} {
+		event := roundTrip(map[string]interface{}{"dataType": "progress", field: "40%"})
+		if got, ok := progressPercent(event, new([]ParseWarning)); !ok || got != 40 {
+			t.Errorf("progress event with %s: got %v (ok %v), want 40", field, got, ok)
+		}
+	}
+}
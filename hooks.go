@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// runHook runs a -pre-hook or -post-hook command through the shell with the
+// file in METRICS_FILE and any extra variables. Its output is only shown
+// with -debug, or as part of the error when it fails.
+func runHook(name, command, file string, env ...string) error {
+	if command == "" {
+		return nil
+	}
+	cmd := exec.Command("sh", "-c", command)
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	}
+	cmd.Env = append(append(os.Environ(), "METRICS_FILE="+file), env...)
+	out, err := cmd.CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	if output != "" {
+		debugf("%s output for %s:\n%s", name, file, output)
+	}
+	if err != nil {
+		if output != "" {
+			return fmt.Errorf("%s failed: %w: %s", name, err, output)
+		}
+		return fmt.Errorf("%s failed: %w", name, err)
+	}
+	return nil
+}
+
+// runFileJob runs a file's requests between its hooks. A failing pre-hook
+// fails every request of the file without sending it; a failing post-hook
+// is only reported, as the results are already in.
+func runFileJob(cfg *Config, job fileJob) []attempt {
+	if err := runHook("pre-hook", cfg.PreHook, job.file); err != nil {
+		attempts := make([]attempt, len(job.requests))
+		for i, req := range job.requests {
+			attempts[i] = attempt{request: req, startTime: time.Now(), err: err}
+		}
+		return attempts
+	}
+	var attempts []attempt
+	if job.dirFiles != nil {
+		attempts = []attempt{runDirectoryJob(cfg, job)}
+	} else {
+		attempts = runRequests(cfg, job.requests)
+	}
+	status := statusOK
+	for _, a := range attempts {
+		if a.err != nil {
+			status = statusError
+		}
+	}
+	if err := runHook("post-hook", cfg.PostHook, job.file, "METRICS_STATUS="+status); err != nil {
+		fmt.Printf("Warning: %s: %v\n", job.relativeName, err)
+	}
+	return attempts
+}
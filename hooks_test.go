@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// TestFileHooks checks that the hooks run around a file's requests with its
+// path and status, and that a failing pre-hook fails the file unsent.
+func TestFileHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook commands use sh syntax")
+	}
+	log := filepath.Join(t.TempDir(), "hooks.log")
+	summary := StreamEvent{Fields: map[string]interface{}{"dataType": "summary", "coverageIncreased": "Coverage increased to 50%", "totalLines": "10"}}
+	requests := new(int)
+	cfg := &Config{
+		transport: replayTransport{[][]StreamEvent{{summary}}, requests},
+		PreHook:   `echo "pre $METRICS_FILE" >> ` + log,
+		PostHook:  `echo "post $METRICS_FILE $METRICS_STATUS" >> ` + log,
+	}
+	job := fileJob{file: "pkg/a.py", relativeName: "pkg/a.py", requests: []GenerateTestRequest{{SrcFilePath: "pkg/a.py"}}}
+	if attempts := runFileJob(cfg, job); len(attempts) != 1 || attempts[0].err != nil {
+		t.Fatalf("got attempts %+v", attempts)
+	}
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "pre pkg/a.py\npost pkg/a.py ok\n"; string(data) != want {
+		t.Errorf("hooks logged:\n%s\nwant:\n%s", data, want)
+	}
+
+	cfg.PreHook = "echo locked >&2; exit 3"
+	attempts := runFileJob(cfg, job)
+	if len(attempts) != 1 || attempts[0].err == nil || !strings.Contains(attempts[0].err.Error(), "pre-hook failed") || !strings.Contains(attempts[0].err.Error(), "locked") {
+		t.Errorf("failing pre-hook: got attempts %+v", attempts)
+	}
+	if *requests != 1 {
+		t.Errorf("%d requests sent, want the failing pre-hook's file left unsent", *requests)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LanguageProfile describes how source files of one language are discovered.
+type LanguageProfile struct {
+	Name      string
+	Extension string
+	SkipDirs  []string
+	SkipFiles []string
+
+	// TestFiles are the names of a source file's sibling test files, with
+	// {name} standing for its name without the extension.
+	TestFiles []string
+}
+
+var pythonProfile = LanguageProfile{
+	Name:      "python",
+	Extension: ".py",
+	SkipDirs:  []string{"venv", "migrations", "__pycache__"},
+	SkipFiles: []string{"__init__.py"},
+	TestFiles: []string{"test_{name}.py", "{name}_test.py"},
+}
+
+// languageProfiles lists the known profiles. Their order is the tie-break
+// for files that several profiles match.
+var languageProfiles = []LanguageProfile{pythonProfile}
+
+func profileNames(profiles []LanguageProfile) []string {
+	names := make([]string, len(profiles))
+	for i, p := range profiles {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// resolveProfile returns the profile a file is processed under. A file that
+// several profiles match, such as a header shared by C and C++, goes to the
+// -only-language profile when it is one of them and otherwise to the first
+// in languageProfiles, so the choice never depends on walk order.
+func resolveProfile(path string, profiles []LanguageProfile, only string) (LanguageProfile, bool) {
+	var candidates []LanguageProfile
+	for _, p := range profiles {
+		if filepath.Ext(path) == p.Extension {
+			candidates = append(candidates, p)
+		}
+	}
+	if len(candidates) == 0 {
+		return LanguageProfile{}, false
+	}
+	chosen := candidates[0]
+	if len(candidates) > 1 {
+		for _, p := range candidates {
+			if p.Name == only {
+				chosen = p
+			}
+		}
+		debugf("%s matches languages %s; using %s", path, strings.Join(profileNames(candidates), ", "), chosen.Name)
+	}
+	return chosen, true
+}
+
+// siblingTest returns the path of an existing test file next to file, if
+// any, following the profile's TestFiles convention.
+func (p LanguageProfile) siblingTest(file string) (string, bool) {
+	name := strings.TrimSuffix(filepath.Base(file), p.Extension)
+	for _, pattern := range p.TestFiles {
+		test := filepath.Join(filepath.Dir(file), strings.ReplaceAll(pattern, "{name}", name))
+		if info, err := os.Stat(test); err == nil && !info.IsDir() {
+			return test, true
+		}
+	}
+	return "", false
+}
+
+// isTestFile reports whether file is itself a test, named by one of the
+// profile's TestFiles patterns.
+func (p LanguageProfile) isTestFile(file string) bool {
+	base := filepath.Base(file)
+	for _, pattern := range p.TestFiles {
+		prefix, suffix, _ := strings.Cut(pattern, "{name}")
+		if len(base) > len(prefix)+len(suffix) && strings.HasPrefix(base, prefix) && strings.HasSuffix(base, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// configured applies -skip-files and -process-init to the profile.
+func (p LanguageProfile) configured(cfg *Config) LanguageProfile {
+	p.SkipFiles = []string{}
+	for _, name := range cfg.SkipFiles {
+		if cfg.ProcessInit && name == "__init__.py" {
+			continue
+		}
+		p.SkipFiles = append(p.SkipFiles, name)
+	}
+	return p
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
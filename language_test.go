@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsTestFile(t *testing.T) {
+	for path, want := range map[string]bool{
+		"pkg/test_util.py":       true,
+		"pkg/util_test.py":       true,
+		"pkg/util.py":            false,
+		"pkg/latest_util.py":     false,
+		"test_helpers/util.py":   false,
+		"pkg/test_.py":           false,
+		"pkg/test_util.py.orig":  false,
+		"pkg/contest_results.py": false,
+	} {
+		if got := pythonProfile.isTestFile(path); got != want {
+			t.Errorf("%s: got %v, want %v", path, got, want)
+		}
+	}
+}
+
+// TestResolveProfile checks how files that several profiles match are
+// resolved, with profiles that share the .h extension.
+func TestResolveProfile(t *testing.T) {
+	profiles := []LanguageProfile{{Name: "c", Extension: ".h"}, {Name: "cpp", Extension: ".h"}, {Name: "python", Extension: ".py"}}
+	for _, tc := range []struct {
+		path, only, want string
+	}{
+		{"lib/util.h", "", "c"},
+		{"lib/util.h", "cpp", "cpp"},
+		{"lib/util.h", "python", "c"},
+		{"app.py", "cpp", "python"},
+		{"README.md", "", ""},
+	} {
+		p, ok := resolveProfile(tc.path, profiles, tc.only)
+		if p.Name != tc.want || ok != (tc.want != "") {
+			t.Errorf("%s with -only-language %q: got %q, want %q", tc.path, tc.only, p.Name, tc.want)
+		}
+	}
+}
+
+func TestProfileConfigured(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want []string
+	}{
+		{nil, []string{"__init__.py"}},
+		{[]string{"-process-init"}, []string{}},
+		{[]string{"-skip-files", "__init__.py, conftest.py", "-process-init"}, []string{"conftest.py"}},
+		{[]string{"-skip-files", "setup.py"}, []string{"setup.py"}},
+		{[]string{"-skip-files", ""}, []string{}},
+	} {
+		cfg, err := parseConfig(tc.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := pythonProfile.configured(cfg).SkipFiles; !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%v: skipping %v, want %v", tc.args, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// lastRunState is the -state-file that -since-last-run keeps. LastSuccess
+// is when the last run that processed every file started; Pending is the
+// incremental run in progress, so one that is interrupted or fails picks up
+// where it left off. A nil state, without -since-last-run, records nothing.
+type lastRunState struct {
+	LastSuccess *time.Time  `json:"lastSuccess,omitempty"`
+	Pending     *pendingRun `json:"pending,omitempty"`
+	path        string
+	done        map[string]bool
+}
+
+type pendingRun struct {
+	Started time.Time `json:"started"`
+	Done    []string  `json:"done"`
+}
+
+// loadLastRun reads the state file. A missing file is a first run.
+func loadLastRun(path string) (*lastRunState, error) {
+	state := &lastRunState{path: path, done: make(map[string]bool)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", jsonErrorPosition(path, data, err), err)
+	}
+	if state.Pending != nil {
+		for _, file := range state.Pending.Done {
+			state.done[file] = true
+		}
+	}
+	return state, nil
+}
+
+// wanted reports whether a file needs processing: it changed since the last
+// successful run, and the pending run has not already done it since.
+func (s *lastRunState) wanted(file string, modTime time.Time) (bool, string) {
+	if s.LastSuccess != nil && !modTime.After(*s.LastSuccess) {
+		return false, "unchanged since the last run at " + s.LastSuccess.Format(time.RFC3339)
+	}
+	if s.done[file] && !modTime.After(s.Pending.Started) {
+		return false, "already done by the unfinished run started at " + s.Pending.Started.Format(time.RFC3339)
+	}
+	return true, ""
+}
+
+// Start records a run as pending, unless it resumes one.
+func (s *lastRunState) Start(started time.Time) error {
+	if s == nil {
+		return nil
+	}
+	if s.Pending != nil {
+		fmt.Printf("Resuming the incremental run started at %s: %d files already done\n", s.Pending.Started.Format(time.RFC3339), len(s.Pending.Done))
+		return nil
+	}
+	s.Pending = &pendingRun{Started: started, Done: []string{}}
+	return s.save()
+}
+
+// Done records files the pending run has finished.
+func (s *lastRunState) Done(files ...string) error {
+	if s == nil {
+		return nil
+	}
+	for _, file := range files {
+		if !s.done[file] {
+			s.done[file] = true
+			s.Pending.Done = append(s.Pending.Done, file)
+		}
+	}
+	return s.save()
+}
+
+// Conclude finishes the pending run if it processed every file, and
+// otherwise leaves it for the next run to resume.
+func (s *lastRunState) Conclude(summary Summary) {
+	if s == nil {
+		return
+	}
+	if summary.Failed > 0 || summary.Unprocessed > 0 {
+		fmt.Printf("Run did not finish every file; the next -since-last-run resumes it from %s\n", s.path)
+		return
+	}
+	if err := s.Finish(); err != nil {
+		fmt.Println("Failed to update state file:", err)
+	} else {
+		fmt.Printf("State file %s updated; the next -since-last-run starts from %s\n", s.path, s.LastSuccess.Format(time.RFC3339))
+	}
+}
+
+// Finish marks the pending run successful. The time it started becomes the
+// cutoff, so files changed while it ran are picked up next time.
+func (s *lastRunState) Finish() error {
+	s.LastSuccess = &s.Pending.Started
+	s.Pending = nil
+	return s.save()
+}
+
+func (s *lastRunState) save() error {
+	return writeFileAtomic(s.path, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(s)
+	})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// TestSinceLastRunChunks checks that finishing one chunk of a
+// -since-last-run does not mark the files of the other chunks as done.
+func TestSinceLastRunChunks(t *testing.T) {
+	dir := t.TempDir()
+	project := filepath.Join(dir, "project")
+	writeProject(t, project, "a.py", "b.py", "c.py", "d.py")
+	var mu sync.Mutex
+	var requested []string
+	server := eventServer(t, func(req GenerateTestRequest) []map[string]string {
+		mu.Lock()
+		requested = append(requested, filepath.Base(req.SrcFilePath))
+		mu.Unlock()
+		return []map[string]string{
+			{"dataType": "calculatedCoverage", "calculatedCoverage": "Current coverage is 40%"},
+			{"dataType": "summary", "coverageIncreased": "Coverage increased from 40% to 75%", "linesCovered": "15", "totalLines": "20", "testAdded": "2"},
+		}
+	})
+	stateFile := filepath.Join(dir, ".lastrun")
+
+	for _, tc := range []struct {
+		chunk string
+		want  []string
+	}{
+		{"0", []string{"a.py", "b.py"}},
+		{"1", []string{"c.py", "d.py"}},
+		{"0", nil},
+		{"1", nil},
+	} {
+		requested = nil
+		code := run([]string{"-root", project, "-api-url", server.URL, "-format", "json", "-output", filepath.Join(dir, "report.json"), "-since-last-run", "-state-file", stateFile, "-chunk-size", "2", "-chunk-index", tc.chunk})
+		if code != exitOK {
+			t.Fatalf("chunk %s: got exit code %d", tc.chunk, code)
+		}
+		sort.Strings(requested)
+		if fmt.Sprint(requested) != fmt.Sprint(tc.want) {
+			t.Errorf("chunk %s: requested %v, want %v", tc.chunk, requested, tc.want)
+		}
+	}
+	for _, name := range []string{".lastrun-size2-chunk0", ".lastrun-size2-chunk1"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -3,18 +3,21 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
-	"regexp"
+	"runtime/debug"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
-
-	"github.com/xuri/excelize/v2"
 )
 
 type GenerateTestRequest struct {
@@ -25,6 +28,15 @@ type GenerateTestRequest struct {
 	Flakiness         bool    `json:"flakiness"`
 	FunctionUnderTest string  `json:"functionUnderTest"`
 	ExpectedCoverage  float64 `json:"expectedCoverage"`
+	MeasureOnly       bool    `json:"measureOnly,omitempty"`
+	Seed              *int64  `json:"seed,omitempty"`
+
+	// Files lists every file of a -batch-size request; sourceFilePath is
+	// the first of them, for servers that don't know about batches.
+	Files []string `json:"sourceFilePaths,omitempty"`
+	// Directory asks for tests for a whole directory under -by-directory;
+	// sourceFilePath is the same directory.
+	Directory string `json:"directory,omitempty"`
 }
 
 type Metrics struct {
@@ -33,272 +45,1268 @@ type Metrics struct {
 	LinesCovered    float64
 	TotalLines      float64
 	TestAdded       float64
+
+	// StoppedEarly is set when -stop-at-expected closed the stream before
+	// the summary, leaving the line and test counts unknown.
+	StoppedEarly bool
+	// Incomplete is set when the stream ended without a summary or done
+	// trailer, so only the initial coverage is known.
+	Incomplete bool
+
+	Flakiness Flakiness
+	Warnings  []ParseWarning
+
+	// Lines maps line numbers to whether they are covered, when the server
+	// reports line-level coverage; nil otherwise.
+	Lines map[int]bool
+
+	Server ServerInfo
+	// FromTrailer is set when a "done" trailer supplied the final numbers
+	// instead of the summary event.
+	FromTrailer bool
+	// RequestID is the server's ID for the request, from an X-Request-ID
+	// header or a requestId event field; empty if it sent none.
+	RequestID string
+
+	// Trajectory is the coverage after each iteration, starting with the
+	// initial coverage; empty unless the server streams interim coverage.
+	Trajectory []float64
+
+	// UnitCoverage and IntegrationCoverage are the final coverage by test
+	// type, nil unless the server's summary reports them.
+	UnitCoverage        *float64
+	IntegrationCoverage *float64
+}
+
+// Flakiness is the server's verdict on the generated tests when the request
+// asked for a flakiness check.
+type Flakiness struct {
+	Reported bool
+	Flaky    bool
+	Runs     float64
 }
 
 func metricsToInterfaceSlice(m Metrics) []interface{} {
 	return []interface{}{m.InitialCoverage, m.FinalCoverage, m.LinesCovered, m.TotalLines, m.TestAdded}
 }
 
-const apiURL = "http://localhost:4407/api/generate"
-
 func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run executes the whole pipeline and returns the process exit code.
+func run(args []string) int {
 	// Start tracking total execution time
 	globalStartTime := time.Now()
+
+	cfg, err := parseConfig(args)
+	if err == flag.ErrHelp {
+		return exitOK
+	}
+	if err != nil {
+		fmt.Println("Error parsing flags:", err)
+		return exitFatal
+	}
+
+	if cfg.Stdout {
+		reportStdout, os.Stdout = os.Stdout, os.Stderr
+		defer func() { os.Stdout = reportStdout }()
+	}
+	setColor(cfg.Color)
+	debugOutput = cfg.Debug
+	coverageMatch = cfg.CoverageMatch
+	profile := pythonProfile.configured(cfg)
+	if cfg.DryValidateConfig {
+		if err := validateListFiles(cfg); err != nil {
+			fmt.Println("Invalid configuration:", err)
+			return exitFatal
+		}
+		fmt.Println("Configuration is valid")
+		return exitOK
+	}
+	if cfg.PrintConfig {
+		if err := printConfig(cfg, profile); err != nil {
+			fmt.Println("Error printing config:", err)
+			return exitFatal
+		}
+		return exitOK
+	}
+	if cfg.SelfTest {
+		return runSelfTest()
+	}
+	if cfg.Merge {
+		return runMerge(cfg, cfg.flags.Args(), globalStartTime)
+	}
+	if cfg.ValidateReport != "" {
+		return runValidateReport(cfg.ValidateReport)
+	}
+
 	fmt.Printf("Execution started at: %s\n", globalStartTime.Format(time.RFC3339))
+	if cfg.CompareURL != "" {
+		fmt.Printf("Comparing servers: A = %s, B = %s\n", cfg.APIURL, cfg.CompareURL)
+	}
 
-	rootDir, err := os.Getwd()
+	roots, err := resolveRoots(cfg.Roots)
 	if err != nil {
 		fmt.Println("Error getting root directory:", err)
-		return
+		return exitFatal
 	}
 
-	var goFiles []string
-	err = filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
+	goFiles, fileRoots, err := discoverFiles(cfg, profile, roots)
+	if err != nil {
+		fmt.Println("Error selecting files:", err)
+		return exitFatal
+	}
+
+	if cfg.Explain {
+		for _, file := range goFiles {
+			relativeName, _ := filepath.Rel(fileRoots[file].dir, file)
+			fmt.Printf("include %s\n", filepath.Join(fileRoots[file].label, relativeName))
+		}
+		fmt.Printf("%d files would be processed; no requests sent (-explain)\n", len(goFiles))
+		return exitOK
+	}
+
+	if cfg.PathBase != "" {
+		checkPathBase(cfg.PathBase, goFiles)
+	}
+	if err := cfg.lastRun.Start(globalStartTime); err != nil {
+		fmt.Println("Error writing state file:", err)
+		return exitFatal
+	}
+	goFiles, dirFiles := directoryJobs(cfg, goFiles, fileRoots)
+
+	baseline, err := loadBaseline(cfg)
+	if err != nil {
+		fmt.Println("Error loading baseline report:", err)
+		return exitFatal
+	}
+
+	rootDirs := make([]string, len(roots))
+	for i, root := range roots {
+		rootDirs[i] = root.dir
+	}
+	summary := Summary{Root: strings.Join(rootDirs, ", ")}
+	var results []Result
+	consecutiveFailures := 0
+	cfg.Output, err = expandTemplate(cfg.chunkOutput(), outputTemplateVars(globalStartTime, profile.Name, len(goFiles), cfg.ChunkIndex))
+	if err != nil {
+		fmt.Println("Error expanding output filename:", err)
+		return exitFatal
+	}
+	runDir, err := openRunDir(cfg, globalStartTime)
+	if err != nil {
+		fmt.Println("Error creating output directory:", err)
+		return exitFatal
+	}
+
+	meta := newReportMetadata(cfg, globalStartTime)
+	resolveCommit(cfg, roots[0].dir, &meta)
+	// -aggregate-only reports are written once the summary is known.
+	var exporters []Exporter
+	if !cfg.AggregateOnly {
+		exporters, err = openExporters(cfg, meta)
 		if err != nil {
-			return err
+			fmt.Println("Error creating report:", err)
+			return exitFatal
 		}
-		if info.IsDir() && (info.Name() == "venv" || info.Name() == "migrations" || info.Name() == "__pycache__") {
-			return filepath.SkipDir
+	}
+
+	var pathRedactor *redactor
+	if cfg.Redact {
+		pathRedactor, err = newRedactor(cfg.RedactSeed)
+		if err != nil {
+			fmt.Println("Error setting up redaction:", err)
+			return exitFatal
 		}
+	}
 
-		if !info.IsDir() && filepath.Ext(path) == ".py" && !isTestFile(path) && info.Name() != "__init__.py" {
-			goFiles = append(goFiles, path)
+	var summaryLogFile *summaryLog
+	if cfg.SummaryLog != "" {
+		summaryLogFile, err = openSummaryLog(cfg.SummaryLog)
+		if err != nil {
+			fmt.Println("Error opening summary log:", err)
+			return exitFatal
 		}
-		return nil
-	})
+		defer summaryLogFile.Close()
+	}
 
-	if err != nil {
-		fmt.Println("Error walking through project files:", err)
-		return
+	var functions map[string][]functionTarget
+	if cfg.PerFunction {
+		functions, err = loadFunctionList(cfg.FunctionsFile)
+		if err != nil {
+			fmt.Println("Error loading function list:", err)
+			return exitFatal
+		}
 	}
 
-	// Create an Excel file
-	excelFile := excelize.NewFile()
-	sheetName := "Execution Log"
-	excelFile.SetSheetName("Sheet1", sheetName)
+	var history map[string]time.Duration
+	if cfg.Timings != "" {
+		history, err = loadTimings(cfg.Timings)
+		if err != nil {
+			fmt.Println("Error loading timings:", err)
+			return exitFatal
+		}
+	}
+	eta := newETAEstimator(history)
 
-	// Set header row
-	headers := []string{"Filepath", "Initial Coverage", "Final Coverage", "Lines Covered", "Total Lines", "Tests Added", "Time Duration", "Start Time", "End Time"}
-	for col, header := range headers {
-		cell := fmt.Sprintf("%s1", string(rune(65+col))) // Column letters start from 'A'
-		excelFile.SetCellValue(sheetName, cell, header)
+	var tagRules []tagRule
+	if cfg.TagsFile != "" {
+		tagRules, err = loadTagRules(cfg.TagsFile)
+		if err != nil {
+			fmt.Println("Error loading tags file:", err)
+			return exitFatal
+		}
 	}
 
-	row := 2 // Start filling data from the second row
+	reports := newReporter(cfg, exporters)
+	// write sends a row to the reports unless -only-regressions leaves it
+	// out; the summary still counts every file.
+	written := 0
+	write := func(result Result) {
+		if cfg.AggregateOnly || cfg.OnlyRegressions && !isRegression(result) {
+			return
+		}
+		written++
+		reports.Write(result)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool := newFilePool(ctx, cfg)
+	defer pool.Close()
+	signals := watchSignals(cfg, cancel)
+	defer signals.Stop()
+	// Files are dispatched ahead of the one being written; only those whose
+	// outcome was received count as processed when a limit stops the run.
+	dispatched, received := 0, 0
+	seenFunctions := make(map[string]bool)
+	budgetSpent := func() bool {
+		return cfg.MaxTotalTests > 0 && summary.TestsAdded >= float64(cfg.MaxTotalTests)
+	}
 
-	// Prepare Excel filename with timestamp
-	excelFilename := "execution_log_2.xlsx"
+	// fileKey identifies a file in -timings before redaction, so timings
+	// match across runs whatever -redact is set to.
+	fileKey := func(file string) string {
+		label := ""
+		if len(roots) > 1 {
+			label = fileRoots[file].label
+		}
+		rel, _ := filepath.Rel(fileRoots[file].dir, file)
+		return timingKey(label, rel)
+	}
 
 	// Iterate through files
+	// With -rewalk, files that appeared while the run was in progress are
+	// appended once the list is exhausted, until a pass finds nothing new.
+	known := make(map[string]bool, len(goFiles))
 	for _, file := range goFiles {
-		requestBody := GenerateTestRequest{
-			SrcFilePath:       file,
-			RootDir:           rootDir,
-			AdditionalPrompt:  "",
-			MaxIterations:     0,
-			Flakiness:         false,
-			FunctionUnderTest: "",
-			ExpectedCoverage:  0.0,
-		}
-
-		// Measure execution time of sendRequest and get coverage values
-		duration, metrics, startTime, endTime, err := measureDuration(requestBody)
-		if err != nil {
-			fmt.Printf("Failed to send request for %s: %v\n", file, err)
-			continue
+		known[file] = true
+	}
+	passes := 1
+
+files:
+	for i := 0; ; i++ {
+		for i == len(goFiles) && cfg.Rewalk && passes < cfg.MaxPasses && !budgetSpent() {
+			passes++
+			found, foundRoots, err := discoverFiles(cfg, profile, roots)
+			if err != nil {
+				fmt.Println("Error rewalking project files:", err)
+				break
+			}
+			added := 0
+			for _, file := range found {
+				if !known[file] {
+					known[file] = true
+					fileRoots[file] = foundRoots[file]
+					goFiles = append(goFiles, file)
+					added++
+				}
+			}
+			fmt.Printf("Rewalk pass %d: %d new files\n", passes, added)
+			if added == 0 {
+				break
+			}
+		}
+		if i == len(goFiles) {
+			break
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		for dispatched < len(goFiles) && pool.Idle() && !budgetSpent() {
+			file := goFiles[dispatched]
+			pool.Dispatch(newFileJob(cfg, fileRoots[file].dir, dispatched, file, functions, seenFunctions, dirFiles))
+			dispatched++
+		}
+		if i == dispatched {
+			summary.Unprocessed = len(goFiles) - received
+			fmt.Printf("Stopping: %.0f tests added reached -max-total-tests %d; %d files left unprocessed\n", summary.TestsAdded, cfg.MaxTotalTests, summary.Unprocessed)
+			break
 		}
 
-		relativeName, err := filepath.Rel(rootDir, file)
-		if err != nil {
-			fmt.Printf("Failed to get relative path for %s: %v\n", file, err)
-			relativeName = file
+		outcome, ok := pool.Next()
+		if !ok {
+			break
+		}
+		received++
+		summary.DuplicateFunctions += outcome.duplicates
+		file, relativeName := outcome.file, outcome.relativeName
+		reportName, absName := relativeName, file
+		if cfg.PathBase != "" {
+			if rel, ok := basePath(cfg.PathBase, file); ok {
+				reportName = rel
+			}
+		}
+		if pathRedactor != nil {
+			reportName, absName = pathRedactor.Redact(reportName), pathRedactor.Redact(file)
+		}
+		reportName = normalizePath(reportName, cfg.PathStyle)
+		rootName := ""
+		if len(roots) > 1 {
+			rootName = fileRoots[file].label
+			if pathRedactor != nil {
+				rootName = pathRedactor.Redact(rootName)
+			}
 		}
 
-		// Store data in Excel
-		data := []interface{}{relativeName, metrics.InitialCoverage, metrics.FinalCoverage, metrics.LinesCovered, metrics.TotalLines, metrics.TestAdded, duration.String(), startTime.Format(time.RFC3339), endTime.Format(time.RFC3339)}
-		for col, value := range data {
-			cell := fmt.Sprintf("%s%d", string(rune(65+col)), row)
-			excelFile.SetCellValue(sheetName, cell, value)
+		var fileDuration time.Duration
+		fileDone := true
+		for _, a := range outcome.attempts {
+			fileDuration += a.duration
+			fileDone = fileDone && (a.err == nil || errors.Is(a.err, errUnsupported))
+		}
+		eta.Record(fileKey(file), fileDuration)
+		if fileDone {
+			doneFiles := []string{file}
+			if files, ok := dirFiles[file]; ok {
+				doneFiles = files
+			}
+			if err := cfg.lastRun.Done(doneFiles...); err != nil {
+				fmt.Println("Failed to update state file:", err)
+			}
 		}
 
-		// Save the Excel file after each iteration
-		if err := excelFile.SaveAs(excelFilename); err != nil {
-			fmt.Printf("Failed to save Excel file after processing %s: %v\n", file, err)
-			// Continue processing even if save fails
-		} else {
-			fmt.Printf("Saved progress after processing %s\n", file)
+		for _, a := range outcome.attempts {
+			rowName := reportName
+			if a.request.FunctionUnderTest != "" {
+				rowName += ":" + a.request.FunctionUnderTest
+			}
+
+			if errors.Is(a.err, errUnsupported) {
+				fmt.Printf("Skipping %s: %v\n", rowName, a.err)
+				consecutiveFailures = 0
+				end := time.Now()
+				result := Result{
+					Root:      rootName,
+					Path:      reportName,
+					AbsPath:   absName,
+					Function:  a.request.FunctionUnderTest,
+					Tags:      resolveTags(tagRules, filepath.ToSlash(relativeName), cfg.TagsMode),
+					Duration:  end.Sub(a.startTime),
+					StartTime: a.startTime,
+					EndTime:   end,
+					Status:    statusUnsupported,
+				}
+				summaryLogFile.Write(rowName, result.Metrics, result.Duration, result.Status)
+				summary.Add(result)
+				results = append(results, result)
+				if cfg.SortBy == "path" {
+					write(result)
+				}
+				continue
+			}
+			if a.err != nil {
+				summaryLogFile.Write(rowName, a.metrics, time.Since(a.startTime), statusError)
+				fmt.Println(red(fmt.Sprintf("Failed to send request for %s: %v", file, a.err)))
+				summary.Failed++
+				if cfg.AutoSkip && isTimeout(a.err) {
+					if err := appendSkipList(cfg.SkipFile, relativeName); err != nil {
+						fmt.Printf("Failed to add %s to skip file: %v\n", relativeName, err)
+					} else {
+						fmt.Printf("Added %s to skip file %s: request timed out\n", relativeName, cfg.SkipFile)
+					}
+				}
+				consecutiveFailures++
+				if cfg.MaxErrors > 0 {
+					errorCount := summary.Failed
+					if cfg.MaxErrorsMode == "consecutive" {
+						errorCount = consecutiveFailures
+					}
+					if errorCount >= cfg.MaxErrors {
+						summary.Unprocessed = len(goFiles) - received
+						fmt.Printf("Aborting run: %d %s file errors reached -max-errors %d; saving progress\n", errorCount, cfg.MaxErrorsMode, cfg.MaxErrors)
+						break files
+					}
+				}
+				continue
+			}
+			consecutiveFailures = 0
+			if summary.Server == (ServerInfo{}) && a.metrics.Server != (ServerInfo{}) {
+				summary.Server = a.metrics.Server
+				if v := summary.Server.SchemaVersion; v != "" && v != expectedSchemaVersion {
+					fmt.Printf("Warning: server schema version %s does not match expected %s; metrics may be misparsed (use -strict to fail instead)\n", v, expectedSchemaVersion)
+				}
+			}
+
+			result := Result{
+				Root:        rootName,
+				Path:        reportName,
+				AbsPath:     absName,
+				Function:    a.request.FunctionUnderTest,
+				Tags:        resolveTags(tagRules, filepath.ToSlash(relativeName), cfg.TagsMode),
+				MeasureOnly: cfg.MeasureOnly,
+				Metrics:     a.metrics.rounded(cfg.Precision),
+				Duration:    a.duration,
+				StartTime:   a.startTime,
+				EndTime:     a.endTime,
+				Status:      resultStatus(a.metrics, cfg.MeasureOnly),
+				MetExpected: metExpected(a.metrics.rounded(cfg.Precision), a.request.ExpectedCoverage, cfg.MeasureOnly),
+				ZeroRetried: a.zeroRetried,
+			}
+			result.ExcludedFromAggregate = excludedFromAggregate(cfg, result.Tags)
+			if b := a.compare; b != nil {
+				result.Compare = &Result{Metrics: b.metrics.rounded(cfg.Precision), Duration: b.duration, Status: statusError, MeasureOnly: cfg.MeasureOnly}
+				if errors.Is(b.err, errUnsupported) {
+					result.Compare.Status = statusUnsupported
+				} else if b.err != nil {
+					fmt.Println(red(fmt.Sprintf("Comparison request for %s failed: %v", file, b.err)))
+				} else {
+					result.Compare.Status = resultStatus(b.metrics, cfg.MeasureOnly)
+				}
+			}
+			summaryLogFile.Write(rowName, result.Metrics, result.Duration, result.Status)
+			if cfg.CovOut != "" && a.metrics.Lines != nil {
+				if path, err := writeCovAnnotation(cfg.CovOut, reportName, result.Function, a.metrics.Lines); err != nil {
+					fmt.Printf("Failed to write coverage annotation for %s: %v\n", rowName, err)
+				} else {
+					fmt.Printf("Coverage annotation for %s written to %s\n", rowName, path)
+				}
+			}
+
+			summary.Add(result)
+			results = append(results, result)
+
+			// Sorted reports are written once all files are done, so per-file
+			// saving only happens in discovery (path) order.
+			if cfg.SortBy == "path" {
+				write(result)
+			}
 		}
 
-		row++
+		done := float64(i+1) / float64(len(goFiles)) * 100
+		progress := fmt.Sprintf("Progress: %d/%d files %s %.0f%%", i+1, len(goFiles), progressBar(done), done)
+		remaining := make([]string, 0, len(goFiles)-i-1)
+		for _, file := range goFiles[i+1:] {
+			remaining = append(remaining, fileKey(file))
+		}
+		if left, ok := eta.Remaining(remaining, cfg.Concurrency); ok && len(remaining) > 0 {
+			progress += fmt.Sprintf(", about %s left", left.Round(time.Second))
+		}
+		fmt.Println(progress)
+	}
+	if signals.Interrupted() {
+		summary.Unprocessed = len(goFiles) - received
+		fmt.Printf("Interrupted: %d files left unprocessed\n", summary.Unprocessed)
 	}
 
+	if cfg.SortBy != "path" {
+		sorted := append([]Result(nil), results...)
+		sortResults(sorted, cfg.SortBy)
+		for _, result := range sorted {
+			write(result)
+		}
+	}
+
+	reports.Close()
+
+	saveTimings(cfg, eta)
+
 	// Compute and log total execution time
 	globalEndTime := time.Now()
 	globalDuration := globalEndTime.Sub(globalStartTime)
-	fmt.Printf("Execution completed at: %s\nTotal Execution Time: %s\nExcel file saved as %s\n",
-		globalEndTime.Format(time.RFC3339), globalDuration, excelFilename)
+	fmt.Printf("Execution completed at: %s\nTotal Execution Time: %s\n",
+		globalEndTime.Format(time.RFC3339), globalDuration)
+	if cfg.AggregateOnly {
+		if err := writeAggregateReport(cfg, meta, &summary, globalDuration); err != nil {
+			fmt.Println("Failed to write aggregate report:", err)
+		}
+	}
+	printSavedReports(cfg)
+	if cfg.OnlyRegressions {
+		fmt.Printf("Rows written: %d of %d (-only-regressions)\n", written, len(results))
+	}
+
+	summary.Print()
+	if cfg.Concurrency > 1 {
+		fmt.Printf("Max result queue depth: %d of %d\n", pool.MaxDepth(), cfg.Concurrency)
+	}
+	if cfg.TagsFile != "" {
+		printTagSummaries(results)
+	}
+	checkCoverageGate(cfg, results, &summary)
+	if cfg.MaxWarnings > 0 && summary.Warnings > cfg.MaxWarnings {
+		summary.TooManyWarnings = true
+		fmt.Println(red(fmt.Sprintf("Too many parse warnings: %d exceed -max-warnings %d; the server's event format may have changed", summary.Warnings, cfg.MaxWarnings)))
+	}
+	if baseline != nil {
+		summary.Regressions = compareBaseline(results, baseline, cfg.RegressionThreshold, cfg.PathStyle)
+	}
+	saveCobertura(cfg, roots, results, &summary, pathRedactor)
+	saveBadge(cfg, &summary)
+	saveTimingsChart(cfg, results)
+	saveManifest(cfg, meta, summary, globalStartTime, globalEndTime, pathRedactor)
+	// Written last, as the Cobertura source and manifest roots are
+	// redacted too.
+	pathRedactor.saveMapping(cfg.RedactMap)
+	closeRunDir(runDir)
+	cfg.lastRun.Conclude(summary)
+	code := exitCode(summary)
+	if signals.Interrupted() {
+		code = exitInterrupted
+	}
+	if cfg.SummaryJSON {
+		e := newExitSummary(summary, len(goFiles), globalDuration, cfg.Precision, code)
+		e.Interrupted = signals.Interrupted()
+		printSummaryJSON(e)
+	}
+	return code
 }
 
-func isTestFile(path string) bool {
-	return strings.Contains(path, "_test.go") || strings.Contains(path, "test_") // Proper Go test file naming convention
+func openExporters(cfg *Config, meta ReportMetadata) ([]Exporter, error) {
+	var exporters []Exporter
+	for _, format := range cfg.Formats {
+		var exporter Exporter
+		var err error
+		if cfg.Stdout {
+			exporter, err = newStdoutExporter(format, cfg, meta)
+		} else {
+			exporter, err = newExporter(format, cfg.outputPath(format), cfg, meta)
+		}
+		if err != nil {
+			closeExporters(cfg, exporters)
+			return nil, err
+		}
+		exporters = append(exporters, exporter)
+	}
+	return exporters, nil
 }
 
-// measureDuration executes sendRequest, logs execution time, and returns coverage data
-func measureDuration(requestBody GenerateTestRequest) (time.Duration, Metrics, time.Time, time.Time, error) {
-	startTime := time.Now()
-	fmt.Printf("Processing file: %s\nStart Time: %s\n", requestBody.SrcFilePath, startTime.Format(time.RFC3339))
+func closeExporters(cfg *Config, exporters []Exporter) {
+	for i, exporter := range exporters {
+		if err := exporter.Close(); err != nil {
+			fmt.Printf("Failed to finalize %s report: %v\n", cfg.Formats[i], err)
+		}
+	}
+}
 
-	metrics, err := sendRequest(requestBody)
-	if err != nil {
-		return 0, Metrics{}, startTime, time.Time{}, err
+// discoverFiles walks the roots and applies the profile, chunk, skip list
+// and -skip-if-tested filters, returning the sorted files to process and
+// the root each belongs to. Under -explain it prints every exclusion.
+func discoverFiles(cfg *Config, profile LanguageProfile, roots []sourceRoot) ([]string, map[string]sourceRoot, error) {
+	// explain prints why a candidate file is excluded under -explain; files
+	// still selected after every filter are listed as included at the end.
+	explain := func(root sourceRoot, path, reason string) {
+		if cfg.Explain {
+			relativeName, _ := filepath.Rel(root.dir, path)
+			fmt.Printf("exclude %s: %s\n", filepath.Join(root.label, relativeName), reason)
+		}
 	}
 
-	endTime := time.Now()
-	duration := endTime.Sub(startTime)
+	var goFiles []string
+	fileRoots := make(map[string]sourceRoot)
+	for _, root := range roots {
+		err := filepath.Walk(root.dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() && contains(profile.SkipDirs, info.Name()) {
+				explain(root, path, "excluded directory "+info.Name())
+				return filepath.SkipDir
+			}
+			if info.IsDir() {
+				return nil
+			}
 
-	fmt.Printf("Finished processing file: %s\nEnd Time: %s\nDuration: %s\n",
-		requestBody.SrcFilePath, endTime.Format(time.RFC3339), duration)
+			resolved, matched := resolveProfile(path, languageProfiles, cfg.OnlyLanguage)
+			switch {
+			case filepath.Ext(path) != profile.Extension:
+				explain(root, path, "extension is not "+profile.Extension)
+			case matched && resolved.Name != profile.Name:
+				explain(root, path, "processed as "+resolved.Name)
+			case profile.isTestFile(path):
+				explain(root, path, "test file")
+			case contains(profile.SkipFiles, info.Name()):
+				explain(root, path, "listed in -skip-files")
+			default:
+				goFiles = append(goFiles, path)
+				fileRoots[path] = root
+			}
+			return nil
+		})
 
-	return duration, metrics, startTime, endTime, nil
-}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to walk project files: %w", err)
+		}
+	}
 
-func sendRequest(requestBody GenerateTestRequest) (Metrics, error) {
-	jsonData, err := json.Marshal(requestBody)
-	if err != nil {
-		return Metrics{}, fmt.Errorf("failed to marshal request body: %w", err)
+	// Chunks are cut from the sorted discovery list before the skip list is
+	// applied, so boundaries stay stable even as -auto-skip grows the list.
+	sort.Strings(goFiles)
+	if cfg.ChunkSize > 0 {
+		chunk := chunkFiles(goFiles, cfg.ChunkSize, cfg.ChunkIndex)
+		if cfg.Explain {
+			for _, file := range goFiles {
+				if !contains(chunk, file) {
+					explain(fileRoots[file], file, fmt.Sprintf("outside chunk %d", cfg.ChunkIndex))
+				}
+			}
+		}
+		goFiles = chunk
 	}
 
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return Metrics{}, fmt.Errorf("failed to create request: %w", err)
+	if cfg.SkipFile != "" {
+		skip, err := loadSkipList(cfg.SkipFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load skip file: %w", err)
+		}
+		var kept []string
+		for _, file := range goFiles {
+			relativeName, err := filepath.Rel(fileRoots[file].dir, file)
+			if err == nil && skip[relativeName] {
+				if cfg.Explain {
+					explain(fileRoots[file], file, "listed in skip file "+cfg.SkipFile)
+				} else {
+					fmt.Printf("Skipping %s: listed in skip file %s\n", relativeName, cfg.SkipFile)
+				}
+				continue
+			}
+			kept = append(kept, file)
+		}
+		goFiles = kept
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{
-		Timeout: 0, // No timeout to allow long-lived streaming
+	if cfg.lastRun != nil {
+		var kept []string
+		for _, file := range goFiles {
+			info, err := os.Stat(file)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to stat %s: %w", file, err)
+			}
+			if ok, reason := cfg.lastRun.wanted(file, info.ModTime()); !ok {
+				explain(fileRoots[file], file, reason)
+				continue
+			}
+			kept = append(kept, file)
+		}
+		switch {
+		case cfg.Explain:
+		case cfg.lastRun.LastSuccess == nil && cfg.lastRun.Pending == nil:
+			fmt.Printf("No state in %s; processing every file (first run)\n", cfg.lastRun.path)
+		default:
+			fmt.Printf("Incremental run: %d of %d files changed or left over since the last run\n", len(kept), len(goFiles))
+		}
+		goFiles = kept
 	}
-	resp, err := client.Do(req)
-	if err != nil {
-		return Metrics{}, fmt.Errorf("failed to send POST request: %w", err)
+
+	if cfg.SkipIfTested {
+		var kept []string
+		for _, file := range goFiles {
+			if test, ok := profile.siblingTest(file); ok {
+				if cfg.Explain {
+					explain(fileRoots[file], file, "already tested by "+filepath.Base(test))
+				} else {
+					relativeName, _ := filepath.Rel(fileRoots[file].dir, file)
+					fmt.Printf("Skipping %s: already tested by %s\n", relativeName, filepath.Base(test))
+				}
+				continue
+			}
+			kept = append(kept, file)
+		}
+		goFiles = kept
 	}
-	defer resp.Body.Close()
+	return goFiles, fileRoots, nil
+}
 
-	// Print response status for debugging
-	fmt.Printf("Response Status: %d\n", resp.StatusCode)
+// validateListFiles loads the skip, function and tag lists the run would
+// use, so -dry-validate-config catches their syntax errors too.
+func validateListFiles(cfg *Config) error {
+	if cfg.SkipFile != "" {
+		if _, err := loadSkipList(cfg.SkipFile); err != nil {
+			return err
+		}
+	}
+	if cfg.PerFunction {
+		if _, err := loadFunctionList(cfg.FunctionsFile); err != nil {
+			return err
+		}
+	}
+	if cfg.TagsFile != "" {
+		if _, err := loadTagRules(cfg.TagsFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return Metrics{}, fmt.Errorf("received non-OK response: %d\nBody: %s", resp.StatusCode, string(bodyBytes))
+// checkCoverageGate marks the summary failed when the aggregate final
+// coverage is below -min-coverage, or with -require-improvement when a
+// processed file's coverage did not go up. "Coverage did not increase"
+// leaves the final coverage at the initial one, so it fails that check.
+func checkCoverageGate(cfg *Config, results []Result, summary *Summary) {
+	if cfg.MinCoverage > 0 && summary.FinalCoverage() < cfg.MinCoverage {
+		summary.GateFailed = true
+		fmt.Println(red(fmt.Sprintf("Coverage gate not met: aggregate final coverage %.2f%% is below %.2f%%", summary.FinalCoverage(), cfg.MinCoverage)))
 	}
+	if !cfg.RequireImprovement {
+		return
+	}
+	var unimproved []Result
+	for _, r := range results {
+		if (r.Status == statusOK || r.Status == statusStopped) && !r.MeasureOnly && !r.ExcludedFromAggregate &&
+			r.Metrics.FinalCoverage <= r.Metrics.InitialCoverage {
+			unimproved = append(unimproved, r)
+		}
+	}
+	if len(unimproved) > 0 {
+		summary.GateFailed = true
+		fmt.Println(red(fmt.Sprintf("Coverage gate not met: %d files did not improve", len(unimproved))))
+		for _, r := range unimproved {
+			fmt.Printf("  %s: %.2f%% -> %.2f%%\n", r.Path, r.Metrics.InitialCoverage, r.Metrics.FinalCoverage)
+		}
+	}
+}
 
-	// Read the response stream line by line
-	reader := bufio.NewReader(resp.Body)
-	fmt.Printf("Streaming response for %s:\n", requestBody.SrcFilePath)
+// writeResult writes the row to every report so progress is saved after each file.
+func writeResult(exporters []Exporter, result Result) {
+	saved := true
+	for _, exporter := range exporters {
+		if err := exporter.Write(result); err != nil {
+			fmt.Printf("Failed to save report after processing %s: %v\n", result.Path, err)
+			saved = false
+			// Continue processing even if save fails
+		}
+	}
+	if saved {
+		fmt.Printf("Saved progress after processing %s\n", result.Path)
+	}
+}
 
-	decoder := json.NewDecoder(reader)
-	var initialCoverage, finalCoverage, linesCovered, totalLines, testAdded float64
+func newGenerateTestRequest(cfg *Config, rootDir, file, function string) GenerateTestRequest {
+	return GenerateTestRequest{
+		SrcFilePath:       file,
+		RootDir:           rootDir,
+		AdditionalPrompt:  "",
+		MaxIterations:     0,
+		Flakiness:         cfg.Flakiness,
+		FunctionUnderTest: function,
+		ExpectedCoverage:  cfg.ExpectedCoverage,
+		MeasureOnly:       cfg.MeasureOnly,
+		Seed:              cfg.seed,
+	}
+}
 
-	for {
-		var event map[string]interface{}
-		err := decoder.Decode(&event)
-		if err == io.EOF {
-			fmt.Println("\nStream ended.")
-			break
-		}
-		if err != nil {
-			return Metrics{}, fmt.Errorf("error reading JSON stream: %w", err)
-		}
+// attempt is the outcome of one generation request.
+type attempt struct {
+	request     GenerateTestRequest
+	duration    time.Duration
+	metrics     Metrics
+	startTime   time.Time
+	endTime     time.Time
+	zeroRetried bool
+	err         error
 
-		if event["dataType"] == "calculatedCoverage" {
-			fmt.Println("Calculated Coverage:", event["calculatedCoverage"])
-			re := regexp.MustCompile(`\d+(\.\d+)?`) // Removed lookahead
-			numbers := re.FindAllString(event["calculatedCoverage"].(string), -1)
+	// compare is the same request's attempt on the -compare-url server.
+	compare *attempt
+}
 
-			if len(numbers) > 0 {
-				initialCoverage = toFloat(numbers[len(numbers)-1]) // Get last match
-			} else {
-				fmt.Println("Warning: calculatedCoverage value missing or invalid")
-			}
-		}
+// runRequest measures a request and, with -compare-url, the same request
+// on the comparison server.
+func runRequest(cfg *Config, requestBody GenerateTestRequest) attempt {
+	if cfg.compare == nil {
+		return measureAttempt(cfg, requestBody)
+	}
+	var a, b attempt
+	if cfg.CompareConcurrent {
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b = measureAttempt(cfg.compare, requestBody)
+		}()
+		a = measureAttempt(cfg, requestBody)
+		wg.Wait()
+	} else {
+		a = measureAttempt(cfg, requestBody)
+		fmt.Printf("Comparing %s on %s\n", requestBody.SrcFilePath, cfg.CompareURL)
+		b = measureAttempt(cfg.compare, requestBody)
+	}
+	a.compare = &b
+	return a
+}
 
-		if event["dataType"] == "summary" {
-			fmt.Println("Final Coverage:", event["coverageIncreased"])
+// measureAttempt measures a single request, re-requesting once under
+// -retry-on-zero when every metric comes back zero.
+func measureAttempt(cfg *Config, requestBody GenerateTestRequest) (a attempt) {
+	a = attempt{request: requestBody, startTime: time.Now()}
+	if cfg.KeepGoingAfterPanic {
+		defer recoverAttempt(&a)
+	}
+	a.duration, a.metrics, a.startTime, a.endTime, a.err = measureDuration(cfg, requestBody)
+	if a.err == nil && cfg.RetryOnZero && a.metrics.allZero() {
+		// All-zero metrics are usually a server-side race; one retry is
+		// enough to tell that apart from a genuinely empty result.
+		fmt.Printf("All metrics for %s are zero; retrying once\n", requestBody.SrcFilePath)
+		a.zeroRetried = true
+		_, a.metrics, _, a.endTime, a.err = measureDuration(cfg, requestBody)
+		a.duration = a.endTime.Sub(a.startTime)
+	}
+	return a
+}
 
-			coverageStr, ok := event["coverageIncreased"].(string)
-			if !ok || coverageStr == "" {
-				fmt.Println("Warning: coverageIncreased value missing or invalid")
-				finalCoverage = 0
-			}
+var errPanic = errors.New("panic while processing")
 
-			if event["coverageIncreased"] == "Coverage did not increase" {
-				finalCoverage = initialCoverage
-			}
+// recoverAttempt turns a panic in a request's processing into the
+// attempt's error, so -keep-going-after-panic records the file as failed
+// instead of ending the run.
+func recoverAttempt(a *attempt) {
+	if r := recover(); r != nil {
+		debugf("panic processing %s: %v\n%s", a.request.SrcFilePath, r, debug.Stack())
+		a.err = fmt.Errorf("%w: %v", errPanic, r)
+	}
+}
 
-			re := regexp.MustCompile(`\d+`)
-			match := re.FindString(event["coverageIncreased"].(string))
+// runRequests issues the requests for one file, up to -function-concurrency
+// at a time, and returns the attempts in request order.
+func runRequests(cfg *Config, requests []GenerateTestRequest) []attempt {
+	attempts := make([]attempt, len(requests))
+	if len(requests) == 1 {
+		attempts[0] = runRequest(cfg, requests[0])
+		return attempts
+	}
 
-			if match != "" {
-				finalCoverage = toFloat(match)
-			} else {
-				fmt.Println("Warning: calculatedCoverage value missing or invalid")
-			}
+	sem := make(chan struct{}, cfg.FunctionConcurrency)
+	var wg sync.WaitGroup
+	for i, req := range requests {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, req GenerateTestRequest) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			attempts[i] = runRequest(cfg, req)
+		}(i, req)
+	}
+	wg.Wait()
+	return attempts
+}
 
-			coverageStr, ok = event["linesCovered"].(string)
-			if !ok || coverageStr == "" {
-				fmt.Println("Warning: linesCovered value missing or invalid")
-				linesCovered = 0
-			}
+// measureDuration executes sendRequest, logs execution time, and returns coverage data
+func measureDuration(cfg *Config, requestBody GenerateTestRequest) (time.Duration, Metrics, time.Time, time.Time, error) {
+	startTime := time.Now()
+	fmt.Printf("Processing file: %s\nStart Time: %s\n", requestBody.SrcFilePath, startTime.Format(time.RFC3339))
+
+	metrics, err := sendRequest(cfg, requestBody)
+	if err != nil {
+		return 0, metrics, startTime, time.Time{}, err
+	}
 
-			match = re.FindString(event["linesCovered"].(string))
+	endTime := time.Now()
+	duration := endTime.Sub(startTime)
 
-			if match != "" {
-				linesCovered = toFloat(match)
-			} else {
-				fmt.Println("Warning: linesCovered value missing or invalid")
-			}
+	fmt.Printf("Finished processing file: %s\nEnd Time: %s\nDuration: %s\n",
+		requestBody.SrcFilePath, endTime.Format(time.RFC3339), duration)
 
-			coverageStr, ok = event["totalLines"].(string)
-			if !ok || coverageStr == "" {
-				fmt.Println("Warning: totalLines value missing or invalid")
-				totalLines = 0
-			}
+	return duration, metrics, startTime, endTime, nil
+}
 
-			match = re.FindString(event["totalLines"].(string))
+// streamMetrics makes a single generation request over -transport and
+// parses its event stream.
+func streamMetrics(cfg *Config, requestBody GenerateTestRequest) (Metrics, error) {
+	// Returning early cancels the stream, which is all the server needs to
+	// notice; it does not have to support stopping itself.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-			if match != "" {
-				totalLines = toFloat(match)
-			} else {
-				fmt.Println("Warning: totalLines value missing or invalid")
+	events, err := cfg.transport.Stream(ctx, requestBody)
+	if err != nil {
+		return Metrics{}, err
+	}
+	return accumulateMetrics(cfg, requestBody, events)
+}
+
+// accumulateMetrics builds a file's metrics from its events, independent of
+// the transport that delivered them.
+func accumulateMetrics(cfg *Config, requestBody GenerateTestRequest, events <-chan StreamEvent) (Metrics, error) {
+	var initialCoverage, finalCoverage, linesCovered, totalLines, testAdded float64
+	var flakiness Flakiness
+	var warnings []ParseWarning
+	var lines map[int]bool
+	var server ServerInfo
+	var trailer map[string]float64
+	var trajectory []float64
+	var unitCoverage, integrationCoverage *float64
+	var requestID string
+	seenCoverage, seenSummary := false, false
+	count := 0
+
+	for e := range events {
+		if e.Err != nil {
+			if requestID != "" {
+				return Metrics{}, fmt.Errorf("%w (request ID %s)", e.Err, requestID)
 			}
+			return Metrics{}, e.Err
+		}
+		// The idle timeout can't catch a server that keeps sending, so the
+		// stream is cut off after -max-events with what was parsed so far.
+		if count++; cfg.MaxEvents > 0 && count > cfg.MaxEvents {
+			partial := Metrics{
+				Incomplete:      true,
+				InitialCoverage: initialCoverage,
+				FinalCoverage:   finalCoverage,
+				LinesCovered:    linesCovered,
+				TotalLines:      totalLines,
+				TestAdded:       testAdded,
+				Warnings:        warnings,
+				Server:          server,
+				Trajectory:      trajectory,
+				RequestID:       requestID,
+			}
+			return partial, fmt.Errorf("%w: more than %d events", errTooManyEvents, cfg.MaxEvents)
+		}
+		event := e.Fields
+		mapFields(event, cfg.fieldMap)
+		if id := eventString(event, "requestId"); id != "" {
+			requestID = id
+		}
+		if err := parseServerInfo(event, &server, cfg.Strict); err != nil {
+			return Metrics{}, err
+		}
+		if err := unsupportedEvent(event); err != nil {
+			return Metrics{}, err
+		}
 
-			coverageStr, ok = event["testAdded"].(string)
-			if !ok || coverageStr == "" {
-				fmt.Println("Warning: testAdded value missing or invalid")
-				testAdded = 0
+		// The first coverage event is the initial coverage; later ones are
+		// interim measurements taken between generation iterations.
+		if event["dataType"] == "calculatedCoverage" && !seenCoverage {
+			fmt.Println("Calculated Coverage:", event["calculatedCoverage"])
+			if coverage, ok := parseMetric(event, "calculatedCoverage", &warnings); ok {
+				initialCoverage = coverage
+				seenCoverage = true
+				trajectory = append(trajectory, coverage)
+			}
+		} else if event["dataType"] == "calculatedCoverage" {
+			fmt.Println("Interim Coverage:", event["calculatedCoverage"])
+			coverage, ok := parseMetric(event, "calculatedCoverage", &warnings)
+			if ok {
+				trajectory = append(trajectory, coverage)
+			}
+			if ok && cfg.StopAtExpected && coverage >= requestBody.ExpectedCoverage {
+				fmt.Printf("Expected coverage %.2f%% reached (%.2f%%); closing the stream\n", requestBody.ExpectedCoverage, coverage)
+				return Metrics{InitialCoverage: initialCoverage, FinalCoverage: coverage, StoppedEarly: true, Warnings: warnings, Server: server, Trajectory: trajectory, RequestID: requestID}, nil
 			}
+		}
+
+		if percent, ok := progressPercent(event, &warnings); ok {
+			fmt.Printf("File progress: %s %.0f%% (%s)\n", progressBar(percent), percent, filepath.Base(requestBody.SrcFilePath))
+		}
 
-			match = re.FindString(event["testAdded"].(string))
+		if requestBody.Flakiness {
+			parseFlakiness(event, &flakiness, &warnings)
+		}
+		if cfg.CovOut != "" || cfg.Cobertura != "" {
+			parseLineCoverage(event, &lines, &warnings)
+		}
 
-			if match != "" {
-				testAdded = toFloat(match)
+		if event["dataType"] == "summary" && requestBody.MeasureOnly {
+			return Metrics{}, fmt.Errorf("server ignored measureOnly and generated tests; it does not support -measure-only")
+		}
+
+		if event["dataType"] == "summary" {
+			seenSummary = true
+			if event["coverageIncreased"] == "Coverage did not increase" {
+				finalCoverage = initialCoverage
 			} else {
-				fmt.Println("Warning: testAdded value missing or invalid")
+				finalCoverage, _ = parseMetric(event, "coverageIncreased", &warnings)
 			}
+			fmt.Printf("Final Coverage: %v (%s)\n", event["coverageIncreased"], coverageChange(initialCoverage, finalCoverage))
+			linesCovered, _ = parseMetric(event, "linesCovered", &warnings)
+			totalLines, _ = parseMetric(event, "totalLines", &warnings)
+			testAdded, _ = parseMetric(event, "testAdded", &warnings)
+			unitCoverage = parseOptionalMetric(event, "unitCoverage", &warnings)
+			integrationCoverage = parseOptionalMetric(event, "integrationCoverage", &warnings)
+		}
+
+		if event["dataType"] == "done" {
+			trailer = parseTrailer(event, &warnings)
+		}
+	}
+
+	// A done trailer carries the server's authoritative numbers; they
+	// override whatever was scraped from the earlier events.
+	if trailer != nil {
+		targets := map[string]*float64{
+			"initialCoverage": &initialCoverage,
+			"finalCoverage":   &finalCoverage,
+			"linesCovered":    &linesCovered,
+			"totalLines":      &totalLines,
+			"testAdded":       &testAdded,
 		}
+		for field, value := range trailer {
+			*targets[field] = value
+		}
+		fmt.Println("Using final numbers from the done trailer")
+	}
+
+	// A stream that ends without a summary or trailer was cut short; its
+	// zero final numbers are not a result.
+	incomplete := !seenSummary && trailer == nil && !requestBody.MeasureOnly
+	if incomplete {
+		fmt.Printf("Warning: stream for %s ended without a summary; marking it incomplete\n", requestBody.SrcFilePath)
 	}
 
 	metrics := Metrics{
+		Incomplete:      incomplete,
 		InitialCoverage: initialCoverage,
 		FinalCoverage:   finalCoverage,
 		LinesCovered:    linesCovered,
 		TotalLines:      totalLines,
 		TestAdded:       testAdded,
+		Flakiness:       flakiness,
+		Warnings:        warnings,
+		Lines:           lines,
+		Server:          server,
+		FromTrailer:     trailer != nil,
+		RequestID:       requestID,
+
+		UnitCoverage:        unitCoverage,
+		IntegrationCoverage: integrationCoverage,
+	}
+	if len(trajectory) > 1 {
+		metrics.Trajectory = trajectory
 	}
 
 	fmt.Printf("\nSuccessfully processed events for: %s\n", requestBody.SrcFilePath)
 	return metrics, nil
 }
 
+var (
+	errResponseTooLarge = errors.New("response exceeds -max-response-bytes")
+	errTooManyEvents    = errors.New("stream exceeds -max-events")
+)
+
+// maxEmptyReads bounds how often limitedReader retries a read that returns
+// neither data nor an error.
+const maxEmptyReads = 100
+
+// limitedReader is io.LimitReader that fails instead of reporting a clean
+// EOF, so a truncated stream is not mistaken for a complete one.
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// Only fail if there is actually more to read. A reader may return
+		// no bytes and no error, so probe a few times, as bufio does.
+		var probe [1]byte
+		for i := 0; i < maxEmptyReads; i++ {
+			n, err := l.r.Read(probe[:])
+			if n > 0 {
+				return 0, errResponseTooLarge
+			}
+			if err != nil {
+				return 0, err
+			}
+		}
+		return 0, io.ErrNoProgress
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// dumpRequest prints the request line, headers and pretty-printed body for
+// -dump-requests. The body is indented from a copy of the marshaled bytes,
+// so the request's own reader is untouched, and credentials are redacted.
+func dumpRequest(req *http.Request, body []byte) {
+	fmt.Printf("Request: %s %s\n", req.Method, req.URL)
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := strings.Join(req.Header.Values(name), ", ")
+		if name == "Authorization" {
+			value = "<redacted>"
+		}
+		fmt.Printf("%s: %s\n", name, value)
+	}
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, body, "", "  "); err != nil {
+		fmt.Printf("%s\n", body)
+		return
+	}
+	fmt.Println(pretty.String())
+}
+
+// compactReadBufferSize bounds the reader buffer in -json-compact mode. The
+// decoder's own buffer only grows to the largest single event, so memory
+// stays flat regardless of how many events a stream carries.
+const compactReadBufferSize = 1024
+
+// readBufferSize is -read-buffer, or else bufio's default of 4096 bytes
+// (compactReadBufferSize with -json-compact). The JSON decoder keeps its own
+// buffer sized to the largest event and bufio hands large reads straight
+// through, so in BenchmarkReadBuffer sizes from 1 KiB to 1 MiB stream both
+// 256 KiB events and small ones within noise of each other; decoding and
+// parsing dominate, and a larger buffer only costs memory per worker.
+func readBufferSize(cfg *Config) int {
+	switch {
+	case cfg.ReadBuffer > 0:
+		return cfg.ReadBuffer
+	case cfg.JSONCompact:
+		return compactReadBufferSize
+	}
+	return 4096
+}
+
+// compactEvent holds just the fields the event parsers read: metrics, done
+// trailers, serverInfo, error and progress events, and the sourceFilePath
+// that routes -batch-size events. Decoding into it instead of a map drops
+// every other field, and the raw event text, as soon as the event is
+// decoded. A field a parser starts reading must be added here too.
+type compactEvent struct {
+	DataType            interface{} `json:"dataType"`
+	CalculatedCoverage  interface{} `json:"calculatedCoverage"`
+	CoverageIncreased   interface{} `json:"coverageIncreased"`
+	LinesCovered        interface{} `json:"linesCovered"`
+	TotalLines          interface{} `json:"totalLines"`
+	TestAdded           interface{} `json:"testAdded"`
+	FlakinessDetected   interface{} `json:"flakinessDetected"`
+	FlakyRuns           interface{} `json:"flakyRuns"`
+	CoveredLines        interface{} `json:"coveredLines"`
+	UncoveredLines      interface{} `json:"uncoveredLines"`
+	SchemaVersion       interface{} `json:"schemaVersion"`
+	ServerVersion       interface{} `json:"serverVersion"`
+	InitialCoverage     interface{} `json:"initialCoverage"`
+	FinalCoverage       interface{} `json:"finalCoverage"`
+	UnitCoverage        interface{} `json:"unitCoverage"`
+	IntegrationCoverage interface{} `json:"integrationCoverage"`
+	RequestID           interface{} `json:"requestId"`
+	Message             interface{} `json:"message"`
+	Code                interface{} `json:"code"`
+	Percentage          interface{} `json:"percentage"`
+	Progress            interface{} `json:"progress"`
+	SourceFilePath      interface{} `json:"sourceFilePath"`
+}
+
+// newEventDecoder accepts both framings servers use: a sequence of
+// top-level objects (NDJSON or concatenated) and a single JSON array of
+// events. An array is consumed element by element, so events are still
+// handled as they arrive.
+func newEventDecoder(reader *bufio.Reader) (*json.Decoder, bool, error) {
+	decoder := json.NewDecoder(reader)
+	b, err := reader.Peek(1)
+	if err != nil || b[0] != '[' {
+		return decoder, false, nil
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, false, err
+	}
+	return decoder, true, nil
+}
+
+// nextEvent returns io.EOF once the stream, or the event array, ends.
+func nextEvent(decoder *json.Decoder, inArray, compact bool) (map[string]interface{}, error) {
+	if inArray && !decoder.More() {
+		// The closing bracket is missing if the stream was cut short.
+		if _, err := decoder.Token(); err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, io.EOF
+	}
+	return decodeEvent(decoder, compact)
+}
+
+func decodeEvent(decoder *json.Decoder, compact bool) (map[string]interface{}, error) {
+	if !compact {
+		var event map[string]interface{}
+		err := decoder.Decode(&event)
+		return event, err
+	}
+
+	var e compactEvent
+	if err := decoder.Decode(&e); err != nil {
+		return nil, err
+	}
+	// Only the fields the event carries go into the map, which keeps the
+	// usual two or three per event rather than one per parsed field.
+	event := make(map[string]interface{}, 4)
+	for _, f := range []struct {
+		key   string
+		value interface{}
+	}{
+		{"dataType", e.DataType},
+		{"calculatedCoverage", e.CalculatedCoverage},
+		{"coverageIncreased", e.CoverageIncreased},
+		{"linesCovered", e.LinesCovered},
+		{"totalLines", e.TotalLines},
+		{"testAdded", e.TestAdded},
+		{"flakinessDetected", e.FlakinessDetected},
+		{"flakyRuns", e.FlakyRuns},
+		{"coveredLines", e.CoveredLines},
+		{"uncoveredLines", e.UncoveredLines},
+		{"schemaVersion", e.SchemaVersion},
+		{"serverVersion", e.ServerVersion},
+		{"initialCoverage", e.InitialCoverage},
+		{"finalCoverage", e.FinalCoverage},
+		{"unitCoverage", e.UnitCoverage},
+		{"integrationCoverage", e.IntegrationCoverage},
+		{"requestId", e.RequestID},
+		{"message", e.Message},
+		{"code", e.Code},
+		{"percentage", e.Percentage},
+		{"progress", e.Progress},
+		{"sourceFilePath", e.SourceFilePath},
+	} {
+		if f.value != nil {
+			event[f.key] = f.value
+		}
+	}
+	return event, nil
+}
+
+// skipStreamPreamble discards a UTF-8 byte order mark and any whitespace that
+// some proxies prepend to the body, which json.Decoder rejects. io.EOF is
+// not an error here; the decoder reports the empty stream itself.
+func skipStreamPreamble(reader *bufio.Reader) error {
+	for {
+		b, err := reader.Peek(1)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case b[0] == ' ' || b[0] == '\t' || b[0] == '\r' || b[0] == '\n':
+			reader.Discard(1)
+		case b[0] == 0xEF:
+			bom, _ := reader.Peek(3)
+			if !bytes.Equal(bom, []byte{0xEF, 0xBB, 0xBF}) {
+				return nil
+			}
+			reader.Discard(3)
+		default:
+			return nil
+		}
+	}
+}
+
 func toFloat(s string) float64 {
 	num, err := strconv.ParseFloat(s, 64)
 	if err != nil {
@@ -306,12 +1314,3 @@ func toFloat(s string) float64 {
 	}
 	return num
 }
-
-func extractNumbers(s string) string {
-	re := regexp.MustCompile(`\d+(\.\d+)?`)
-	numbers := re.FindAllString(s, -1)
-	if len(numbers) > 0 {
-		return numbers[len(numbers)-1]
-	}
-	return ""
-}
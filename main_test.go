@@ -0,0 +1,854 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// writeProject creates a project of Python files under dir.
+func writeProject(t *testing.T, dir string, paths ...string) {
+	t.Helper()
+	for _, path := range paths {
+		file := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte("def f():\n    return 1\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// eventServer streams the events that events returns for each requested
+// file over HTTP; a nil slice answers with a server error.
+func eventServer(t *testing.T, events func(req GenerateTestRequest) []map[string]string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req GenerateTestRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fileEvents := events(req)
+		if fileEvents == nil {
+			http.Error(w, "generation failed", http.StatusInternalServerError)
+			return
+		}
+		encoder := json.NewEncoder(w)
+		for _, event := range fileEvents {
+			encoder.Encode(event)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// readManifest reads a -manifest written by a run.
+func readManifest(t *testing.T, path string) Manifest {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// TestPipeline runs the whole pipeline against the self-test's mock
+// servers, once per transport, and checks every report format it writes.
+// Runs use several workers, so go test -race also checks the pipeline for
+// data races.
+func TestPipeline(t *testing.T) {
+	dir := t.TempDir()
+	project := filepath.Join(dir, "project")
+	for _, f := range selfTestFiles {
+		writeProject(t, project, f.path)
+	}
+	servers, stop, err := startSelfTestServers(project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	for _, server := range servers {
+		t.Run(server.transport, func(t *testing.T) {
+			output := filepath.Join(dir, "report-"+server.transport+".xlsx")
+			code := run([]string{"-root", project, "-api-url", server.url, "-transport", server.transport, "-format", "excel,csv,json", "-output", output, "-concurrency", "2"})
+			if code != exitOK {
+				t.Fatalf("pipeline exited with code %d", code)
+			}
+			for _, ext := range []string{".xlsx", ".csv", ".json"} {
+				if err := checkSelfTestReport(strings.TrimSuffix(output, ".xlsx") + ext); err != nil {
+					t.Errorf("%s report: %v", ext, err)
+				}
+			}
+		})
+	}
+}
+
+// TestExitCodes checks the exit code of each kind of outcome.
+func TestExitCodes(t *testing.T) {
+	coverage := map[string]string{"dataType": "calculatedCoverage", "calculatedCoverage": "Current coverage is 40%"}
+	summary := func(final, linesCovered, testAdded string) []map[string]string {
+		return []map[string]string{coverage, {"dataType": "summary", "coverageIncreased": "Coverage increased from 40% to " + final + "%", "linesCovered": linesCovered, "totalLines": "20", "testAdded": testAdded}}
+	}
+
+	dir := t.TempDir()
+	project := filepath.Join(dir, "project")
+	writeProject(t, project, "app.py")
+	var events []map[string]string
+	server := eventServer(t, func(GenerateTestRequest) []map[string]string { return events })
+
+	baseline := filepath.Join(dir, "baseline.json")
+	events = summary("90", "18", "2")
+	if code := run([]string{"-root", project, "-api-url", server.URL, "-format", "json", "-output", baseline}); code != exitOK {
+		t.Fatalf("baseline run exited with code %d", code)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		events []map[string]string
+		args   []string
+		want   int
+	}{
+		{"success", summary("75", "15", "2"), nil, exitOK},
+		{"file error", nil, nil, exitFileErrors},
+		{"coverage gate", summary("75", "15", "2"), []string{"-min-coverage", "80"}, exitCoverageGate},
+		{"fatal startup error", summary("75", "15", "2"), []string{"-concurrency", "none"}, exitFatal},
+		{"regression", summary("75", "15", "2"), []string{"-baseline", baseline}, exitRegression},
+		{"too many warnings", summary("75", "n/a", "several"), []string{"-max-warnings", "1"}, exitWarnings},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			events = tc.events
+			args := append([]string{"-root", project, "-api-url", server.URL, "-format", "json", "-output", filepath.Join(dir, "report.json")}, tc.args...)
+			if code := run(args); code != tc.want {
+				t.Errorf("got exit code %d, want %d", code, tc.want)
+			}
+		})
+	}
+}
+
+// TestStreamMetrics checks interim events, -stop-at-expected, done
+// trailers, -field-map paths into nested events, -max-events and mid-stream
+// failures against a fake transport.
+func TestStreamMetrics(t *testing.T) {
+	summary := StreamEvent{Fields: map[string]interface{}{"dataType": "summary", "coverageIncreased": "Coverage increased from 10% to 80%", "linesCovered": "8", "totalLines": "10", "testAdded": "3"}}
+	req := GenerateTestRequest{SrcFilePath: "fake.py", ExpectedCoverage: 50}
+
+	t.Run("full stream", func(t *testing.T) {
+		cfg := &Config{transport: fakeTransport{[]StreamEvent{coverageEvent("10%"), coverageEvent("60%"), summary}}}
+		metrics, err := streamMetrics(cfg, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if metrics.InitialCoverage != 10 || metrics.FinalCoverage != 80 || metrics.TestAdded != 3 || metrics.StoppedEarly || metrics.FromTrailer {
+			t.Errorf("got %+v", metrics)
+		}
+		if got := formatTrajectory(metrics.Trajectory); got != "10,60" {
+			t.Errorf("trajectory is %q, want \"10,60\"", got)
+		}
+	})
+
+	t.Run("stop at expected", func(t *testing.T) {
+		cfg := &Config{transport: fakeTransport{[]StreamEvent{coverageEvent("10%"), coverageEvent("60%"), summary}}, StopAtExpected: true}
+		metrics, err := streamMetrics(cfg, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if metrics.FinalCoverage != 60 || !metrics.StoppedEarly {
+			t.Errorf("got %+v", metrics)
+		}
+	})
+
+	t.Run("done trailer", func(t *testing.T) {
+		done := StreamEvent{Fields: map[string]interface{}{"dataType": "done", "finalCoverage": 85.0, "testAdded": "4"}}
+		cfg := &Config{transport: fakeTransport{[]StreamEvent{coverageEvent("10%"), summary, done}}}
+		metrics, err := streamMetrics(cfg, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if metrics.InitialCoverage != 10 || metrics.FinalCoverage != 85 || metrics.TestAdded != 4 || metrics.TotalLines != 10 || !metrics.FromTrailer {
+			t.Errorf("got %+v", metrics)
+		}
+	})
+
+	t.Run("partial stream", func(t *testing.T) {
+		cfg := &Config{transport: fakeTransport{[]StreamEvent{coverageEvent("10%"), coverageEvent("30%")}}}
+		metrics, err := streamMetrics(cfg, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !metrics.Incomplete || metrics.InitialCoverage != 10 || resultStatus(metrics, false) != statusIncomplete {
+			t.Errorf("got %+v", metrics)
+		}
+	})
+
+	t.Run("field map", func(t *testing.T) {
+		nested := StreamEvent{Fields: map[string]interface{}{"dataType": "summary", "result": map[string]interface{}{
+			"coverage": map[string]interface{}{"after": "Coverage increased to 70%"},
+			"lines":    []interface{}{map[string]interface{}{"covered": "7"}, map[string]interface{}{"total": "10"}},
+			"tests":    map[string]interface{}{"added": "2"},
+		}}}
+		fieldMap, err := parseFieldMap([]string{"coverageIncreased=result.coverage.after", "linesCovered=result.lines.0.covered", "totalLines=result.lines.1.total", "testAdded=result.tests.added", "flakyRuns=result.missing.path"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg := &Config{transport: fakeTransport{[]StreamEvent{coverageEvent("10%"), nested}}, fieldMap: fieldMap}
+		metrics, err := streamMetrics(cfg, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if metrics.FinalCoverage != 70 || metrics.LinesCovered != 7 || metrics.TotalLines != 10 || metrics.TestAdded != 2 || len(metrics.Warnings) != 0 {
+			t.Errorf("got %+v", metrics)
+		}
+		if _, err := parseFieldMap([]string{"totalLines=result..total"}); err == nil {
+			t.Error("empty path segment accepted")
+		}
+	})
+
+	t.Run("max events", func(t *testing.T) {
+		repeated := []StreamEvent{coverageEvent("10%"), coverageEvent("20%"), coverageEvent("20%"), coverageEvent("20%"), coverageEvent("20%")}
+		cfg := &Config{transport: fakeTransport{repeated}, MaxEvents: 3}
+		metrics, err := streamMetrics(cfg, req)
+		if !errors.Is(err, errTooManyEvents) || metrics.InitialCoverage != 10 || len(metrics.Trajectory) != 3 {
+			t.Errorf("got %+v, error %v", metrics, err)
+		}
+	})
+
+	t.Run("failed stream", func(t *testing.T) {
+		failure := errors.New("connection reset")
+		cfg := &Config{transport: fakeTransport{[]StreamEvent{coverageEvent("10%"), {Err: failure}}}}
+		if _, err := streamMetrics(cfg, req); !errors.Is(err, failure) {
+			t.Errorf("got error %v", err)
+		}
+	})
+}
+
+// TestPanicRecovery checks that under -keep-going-after-panic a panic fails
+// only its own file and the file's other requests still complete.
+func TestPanicRecovery(t *testing.T) {
+	summary := StreamEvent{Fields: map[string]interface{}{"dataType": "summary", "coverageIncreased": "Coverage increased to 50%", "linesCovered": "5", "totalLines": "10", "testAdded": "1"}}
+	cfg := &Config{
+		transport:           panickingTransport{fakeTransport{[]StreamEvent{coverageEvent("10%"), summary}}, "bad.py"},
+		KeepGoingAfterPanic: true,
+		FunctionConcurrency: 2,
+	}
+	attempts := runRequests(cfg, []GenerateTestRequest{{SrcFilePath: "bad.py"}, {SrcFilePath: "good.py"}})
+	if !errors.Is(attempts[0].err, errPanic) {
+		t.Errorf("panicking file: got error %v", attempts[0].err)
+	}
+	if attempts[1].err != nil || attempts[1].metrics.FinalCoverage != 50 {
+		t.Errorf("other file: got %+v, error %v", attempts[1].metrics, attempts[1].err)
+	}
+}
+
+// syntheticStream is a stream of interim coverage events, each
+// padded with a field the parser ignores, closed by a summary.
+func syntheticStream(events, padding int) string {
+	var stream strings.Builder
+	pad := strings.Repeat("x", padding)
+	for i := 0; i < events; i++ {
+		fmt.Fprintf(&stream, "{\"dataType\": \"calculatedCoverage\", \"calculatedCoverage\": \"Current coverage is %d%%\", \"log\": \"%s\"}\n", i%100, pad)
+	}
+	stream.WriteString(`{"dataType": "summary", "coverageIncreased": "Coverage increased from 0% to 99%", "linesCovered": "99", "totalLines": "100", "testAdded": "5"}` + "\n")
+	return stream.String()
+}
+
+// captureStdout returns what f prints to standard output.
+func captureStdout(t testing.TB, f func()) string {
+	t.Helper()
+	out, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	stdout := os.Stdout
+	os.Stdout = out
+	defer func() { os.Stdout = stdout }()
+	f()
+	data, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// discardStdout silences the pipeline's progress output, which would
+// otherwise dominate a benchmark.
+func discardStdout(b *testing.B) {
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = devNull
+	b.Cleanup(func() {
+		os.Stdout = stdout
+		devNull.Close()
+	})
+}
+
+// BenchmarkAccumulateMetrics streams 100k events over HTTP with and without
+// -json-compact. Memory per operation should stay flat in compact mode as
+// the stream grows; the trajectory is the only state kept per event.
+func BenchmarkAccumulateMetrics(b *testing.B) {
+	stream := syntheticStream(100000, 200)
+	for _, compact := range []bool{false, true} {
+		b.Run(fmt.Sprintf("compact=%v", compact), func(b *testing.B) {
+			cfg := newHTTPTestConfig(b, stream)
+			cfg.JSONCompact = compact
+			discardStdout(b)
+			b.SetBytes(int64(len(stream)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := streamMetrics(cfg, GenerateTestRequest{SrcFilePath: "app.py"}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// TestMaxErrorsUnprocessed checks that files dispatched ahead of the one
+// that trips -max-errors, but not yet written, count as unprocessed.
+func TestMaxErrorsUnprocessed(t *testing.T) {
+	dir := t.TempDir()
+	project := filepath.Join(dir, "project")
+	writeProject(t, project, "a.py", "b.py", "c.py", "d.py", "e.py")
+	server := eventServer(t, func(GenerateTestRequest) []map[string]string { return nil })
+
+	manifest := filepath.Join(dir, "manifest.json")
+	code := run([]string{"-root", project, "-api-url", server.URL, "-format", "json", "-output", filepath.Join(dir, "report.json"), "-concurrency", "3", "-max-errors", "2", "-manifest", manifest})
+	if code != exitFileErrors {
+		t.Errorf("got exit code %d, want %d", code, exitFileErrors)
+	}
+	data, err := os.ReadFile(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m struct{ Failed, Unprocessed int }
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Failed != 2 || m.Unprocessed != 3 {
+		t.Errorf("manifest counts %d failed and %d unprocessed, want 2 and 3", m.Failed, m.Unprocessed)
+	}
+}
+
+// TestJSONCompactKeepsParsedFields decodes the events each feature reads
+// with -json-compact and checks their parsers still see the fields.
+func TestJSONCompactKeepsParsedFields(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		event string
+		check func(event map[string]interface{}) error
+	}{
+		{"unsupported error event", `{"dataType": "error", "code": "unsupported", "message": "language not supported", "log": "x"}`, func(event map[string]interface{}) error {
+			if err := unsupportedEvent(event); !errors.Is(err, errUnsupported) {
+				return fmt.Errorf("got error %v, want %v", err, errUnsupported)
+			}
+			return nil
+		}},
+		{"progress percentage", `{"dataType": "progress", "percentage": "Generating: 40%"}`, func(event map[string]interface{}) error {
+			if got, ok := progressPercent(event, new([]ParseWarning)); !ok || got != 40 {
+				return fmt.Errorf("got %v (ok %v), want 40", got, ok)
+			}
+			return nil
+		}},
+		{"progress field", `{"dataType": "progress", "progress": 65}`, func(event map[string]interface{}) error {
+			if got, ok := progressPercent(event, new([]ParseWarning)); !ok || got != 65 {
+				return fmt.Errorf("got %v (ok %v), want 65", got, ok)
+			}
+			return nil
+		}},
+		{"batched source file", `{"dataType": "summary", "sourceFilePath": "pkg/a.py", "coverageIncreased": "Coverage increased to 60%"}`, func(event map[string]interface{}) error {
+			if got := eventString(event, "sourceFilePath"); got != "pkg/a.py" {
+				return fmt.Errorf("sourceFilePath is %q, want pkg/a.py", got)
+			}
+			return nil
+		}},
+		{"done trailer", `{"dataType": "done", "initialCoverage": 10, "finalCoverage": 85, "linesCovered": "17", "totalLines": 20, "testAdded": "4"}`, func(event map[string]interface{}) error {
+			got := parseTrailer(event, new([]ParseWarning))
+			want := map[string]float64{"initialCoverage": 10, "finalCoverage": 85, "linesCovered": 17, "totalLines": 20, "testAdded": 4}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				return fmt.Errorf("got trailer %v, want %v", got, want)
+			}
+			return nil
+		}},
+		{"strict schema version", `{"dataType": "serverInfo", "schemaVersion": "2", "serverVersion": "1.4.0"}`, func(event map[string]interface{}) error {
+			var info ServerInfo
+			if err := parseServerInfo(event, &info, true); !errors.Is(err, errSchemaMismatch) {
+				return fmt.Errorf("got error %v, want %v", err, errSchemaMismatch)
+			}
+			if info.ServerVersion != "1.4.0" {
+				return fmt.Errorf("server version is %q, want 1.4.0", info.ServerVersion)
+			}
+			return nil
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			event, err := decodeEvent(json.NewDecoder(strings.NewReader(tc.event)), true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tc.check(event); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// TestMeasureOnly checks that a -measure-only stream ending after the
+// initial coverage is a complete result with blank generation columns, and
+// that a server answering with generated tests fails the file.
+func TestMeasureOnly(t *testing.T) {
+	req := GenerateTestRequest{SrcFilePath: "fake.py", MeasureOnly: true}
+	cfg := &Config{transport: fakeTransport{[]StreamEvent{coverageEvent("35%")}}, MeasureOnly: true}
+	metrics, err := streamMetrics(cfg, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := Result{Metrics: metrics, MeasureOnly: true, Status: resultStatus(metrics, true)}
+	if r.Status != statusOK || metrics.InitialCoverage != 35 {
+		t.Fatalf("got status %q, %+v", r.Status, metrics)
+	}
+	for _, key := range []string{"final_coverage", "tests_added", "lines_covered"} {
+		if got := columnByKey(key).Value(r); got != "" {
+			t.Errorf("%s is %v, want blank", key, got)
+		}
+	}
+
+	summary := StreamEvent{Fields: map[string]interface{}{"dataType": "summary", "coverageIncreased": "Coverage increased from 35% to 80%"}}
+	cfg.transport = fakeTransport{[]StreamEvent{coverageEvent("35%"), summary}}
+	if _, err := streamMetrics(cfg, req); err == nil || !strings.Contains(err.Error(), "does not support -measure-only") {
+		t.Errorf("got error %v", err)
+	}
+}
+
+// TestMaxTotalTests checks that no file is started once -max-total-tests
+// is reached, and the rest count as unprocessed.
+func TestMaxTotalTests(t *testing.T) {
+	dir := t.TempDir()
+	project := filepath.Join(dir, "project")
+	writeProject(t, project, "a.py", "b.py", "c.py", "d.py", "e.py")
+	server := eventServer(t, func(GenerateTestRequest) []map[string]string {
+		return []map[string]string{{"dataType": "summary", "coverageIncreased": "Coverage increased from 40% to 60%", "linesCovered": "6", "totalLines": "10", "testAdded": "2"}}
+	})
+
+	manifest := filepath.Join(dir, "manifest.json")
+	if code := run([]string{"-root", project, "-api-url", server.URL, "-format", "json", "-output", filepath.Join(dir, "report.json"), "-max-total-tests", "3", "-manifest", manifest}); code != exitOK {
+		t.Errorf("got exit code %d", code)
+	}
+	if m := readManifest(t, manifest); m.Processed != 2 || m.Unprocessed != 3 || m.TestsAdded != 4 {
+		t.Errorf("manifest counts %d processed, %d unprocessed and %v tests added, want 2, 3 and 4", m.Processed, m.Unprocessed, m.TestsAdded)
+	}
+}
+
+// TestSeed checks that -seed is sent with each request and recorded in the
+// manifest, and left out of both when not set.
+func TestSeed(t *testing.T) {
+	dir := t.TempDir()
+	project := filepath.Join(dir, "project")
+	writeProject(t, project, "a.py", "b.py")
+	var mu sync.Mutex
+	var seeds []*int64
+	server := eventServer(t, func(req GenerateTestRequest) []map[string]string {
+		mu.Lock()
+		defer mu.Unlock()
+		seeds = append(seeds, req.Seed)
+		return []map[string]string{{"dataType": "summary", "coverageIncreased": "Coverage increased from 40% to 60%", "linesCovered": "6", "totalLines": "10", "testAdded": "1"}}
+	})
+
+	for _, seed := range []string{"42", ""} {
+		seeds = nil
+		manifest := filepath.Join(dir, "manifest.json")
+		args := []string{"-root", project, "-api-url", server.URL, "-format", "json", "-output", filepath.Join(dir, "report.json"), "-manifest", manifest}
+		if seed != "" {
+			args = append(args, "-seed", seed)
+		}
+		if code := run(args); code != exitOK {
+			t.Fatalf("-seed %q: exit code %d", seed, code)
+		}
+		sent := make([]string, len(seeds))
+		for i, s := range seeds {
+			if s != nil {
+				sent[i] = fmt.Sprint(*s)
+			}
+		}
+		if len(sent) != 2 || sent[0] != seed || sent[1] != seed {
+			t.Errorf("-seed %q: requests sent seeds %q", seed, sent)
+		}
+		if m := readManifest(t, manifest); (m.Seed == nil) != (seed == "") || (m.Seed != nil && fmt.Sprint(*m.Seed) != seed) {
+			t.Errorf("-seed %q: manifest seed %v", seed, m.Seed)
+		}
+	}
+
+	if code := run([]string{"-root", project, "-api-url", server.URL, "-seed", "random"}); code != exitFatal {
+		t.Errorf("-seed random: exit code %d, want %d", code, exitFatal)
+	}
+}
+
+// TestExplain checks that -explain gives the reason for every candidate
+// file and sends no requests.
+func TestExplain(t *testing.T) {
+	dir := t.TempDir()
+	project := filepath.Join(dir, "project")
+	writeProject(t, project, "app.py", "pkg/__init__.py", "pkg/test_app.py", "venv/lib.py", "notes.txt", "legacy.py", "util.py", "util_test.py")
+	skipFile := filepath.Join(dir, "skip.txt")
+	if err := os.WriteFile(skipFile, []byte("legacy.py\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	server := eventServer(t, func(req GenerateTestRequest) []map[string]string {
+		t.Errorf("request sent for %s", req.SrcFilePath)
+		return nil
+	})
+
+	var code int
+	out := captureStdout(t, func() {
+		code = run([]string{"-root", project, "-api-url", server.URL, "-explain", "-skip-file", skipFile, "-skip-if-tested"})
+	})
+	if code != exitOK {
+		t.Errorf("exit code %d", code)
+	}
+	for _, want := range []string{
+		"include " + filepath.Join(project, "app.py"),
+		"exclude " + filepath.Join(project, "pkg", "__init__.py") + ": listed in -skip-files",
+		"exclude " + filepath.Join(project, "pkg", "test_app.py") + ": test file",
+		"exclude " + filepath.Join(project, "venv") + ": excluded directory venv",
+		"exclude " + filepath.Join(project, "notes.txt") + ": extension is not .py",
+		"exclude " + filepath.Join(project, "legacy.py") + ": listed in skip file " + skipFile,
+		"exclude " + filepath.Join(project, "util.py") + ": already tested by util_test.py",
+		"1 files would be processed",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+}
+
+// TestRewalk checks that -rewalk processes files created during the run,
+// such as generated modules, and stops after -max-passes walks.
+func TestRewalk(t *testing.T) {
+	dir := t.TempDir()
+	project := filepath.Join(dir, "project")
+	writeProject(t, project, "a.py")
+	var mu sync.Mutex
+	var requested []string
+	server := eventServer(t, func(req GenerateTestRequest) []map[string]string {
+		mu.Lock()
+		defer mu.Unlock()
+		requested = append(requested, filepath.Base(req.SrcFilePath))
+		// Each file processed creates the next one.
+		writeProject(t, project, fmt.Sprintf("gen%d.py", len(requested)))
+		return []map[string]string{{"dataType": "summary", "coverageIncreased": "Coverage increased from 40% to 60%", "linesCovered": "6", "totalLines": "10", "testAdded": "1"}}
+	})
+
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{nil, "a.py"},
+		{[]string{"-rewalk", "-max-passes", "3"}, "a.py gen1.py gen2.py"},
+	} {
+		for _, name := range []string{"gen1.py", "gen2.py", "gen3.py"} {
+			os.Remove(filepath.Join(project, name))
+		}
+		requested = nil
+		args := append([]string{"-root", project, "-api-url", server.URL, "-format", "json", "-output", filepath.Join(dir, "report.json")}, tc.args...)
+		if code := run(args); code != exitOK {
+			t.Fatalf("%v: exit code %d", tc.args, code)
+		}
+		if got := strings.Join(requested, " "); got != tc.want {
+			t.Errorf("%v: requested %s, want %s", tc.args, got, tc.want)
+		}
+	}
+}
+
+// TestUnsupportedFiles checks that files the server rejects as unsupported,
+// by status 422 or an error event, are reported as such without retries
+// and do not fail the run.
+func TestUnsupportedFiles(t *testing.T) {
+	dir := t.TempDir()
+	project := filepath.Join(dir, "project")
+	writeProject(t, project, "a.py", "b.py", "c.py")
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req GenerateTestRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		name := filepath.Base(req.SrcFilePath)
+		mu.Lock()
+		requests[name]++
+		mu.Unlock()
+		switch name {
+		case "b.py":
+			http.Error(w, "language not supported", http.StatusUnprocessableEntity)
+		case "c.py":
+			fmt.Fprintln(w, `{"dataType": "error", "code": "unsupported", "message": "cannot parse this file"}`)
+		default:
+			fmt.Fprintln(w, `{"dataType": "summary", "coverageIncreased": "Coverage increased from 40% to 60%", "linesCovered": "6", "totalLines": "10", "testAdded": "1"}`)
+		}
+	}))
+	defer server.Close()
+
+	output := filepath.Join(dir, "report.csv")
+	code := run([]string{"-root", project, "-api-url", server.URL, "-format", "csv", "-output", output, "-retries", "2", "-retry-backoff", "1ms"})
+	if code != exitOK {
+		t.Errorf("exit code %d, want %d", code, exitOK)
+	}
+	rows, err := readReport(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		want := statusUnsupported
+		if row["path"] == "a.py" {
+			want = statusOK
+		}
+		if row["status"] != want || requests[row["path"]] != 1 {
+			t.Errorf("%s: status %q after %d requests, want %q after 1", row["path"], row["status"], requests[row["path"]], want)
+		}
+	}
+	if len(rows) != 3 {
+		t.Errorf("got %d rows, want 3", len(rows))
+	}
+}
+
+// TestOnlyRegressions checks that -only-regressions writes just the files
+// whose coverage did not go up, while the manifest still counts every file.
+func TestOnlyRegressions(t *testing.T) {
+	dir := t.TempDir()
+	project := filepath.Join(dir, "project")
+	writeProject(t, project, "a.py", "b.py", "c.py")
+	server := eventServer(t, func(req GenerateTestRequest) []map[string]string {
+		final := "60%"
+		if filepath.Base(req.SrcFilePath) != "a.py" {
+			final = "50%"
+		}
+		return []map[string]string{
+			{"dataType": "calculatedCoverage", "calculatedCoverage": "50%"},
+			{"dataType": "summary", "coverageIncreased": "Coverage is now " + final, "linesCovered": "5", "totalLines": "10", "testAdded": "1"},
+		}
+	})
+
+	output := filepath.Join(dir, "report.csv")
+	manifest := filepath.Join(dir, "manifest.json")
+	if code := run([]string{"-root", project, "-api-url", server.URL, "-format", "csv", "-output", output, "-only-regressions", "-manifest", manifest}); code != exitOK {
+		t.Errorf("got exit code %d", code)
+	}
+	rows, err := readReport(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, row := range rows {
+		paths = append(paths, row["path"])
+	}
+	if strings.Join(paths, ",") != "b.py,c.py" {
+		t.Errorf("report rows %v, want b.py and c.py", paths)
+	}
+	if m := readManifest(t, manifest); m.Processed != 3 {
+		t.Errorf("manifest counts %d processed, want 3", m.Processed)
+	}
+}
+
+// TestMaxWarnings checks that the run fails with exitWarnings only once its
+// parse warnings exceed -max-warnings.
+func TestMaxWarnings(t *testing.T) {
+	dir := t.TempDir()
+	project := filepath.Join(dir, "project")
+	writeProject(t, project, "a.py", "b.py", "c.py")
+	server := eventServer(t, func(GenerateTestRequest) []map[string]string {
+		return []map[string]string{{"dataType": "summary", "coverageIncreased": "Coverage increased from 40% to 60%", "linesCovered": "6", "totalLines": "n/a", "testAdded": "1"}}
+	})
+
+	for _, tc := range []struct {
+		max  string
+		want int
+	}{{"0", exitOK}, {"3", exitOK}, {"2", exitWarnings}} {
+		code := run([]string{"-root", project, "-api-url", server.URL, "-format", "csv", "-output", filepath.Join(dir, "report.csv"), "-max-warnings", tc.max})
+		if code != tc.want {
+			t.Errorf("-max-warnings %s: exit code %d, want %d", tc.max, code, tc.want)
+		}
+	}
+}
+
+// TestAggregateOnly checks that -aggregate-only writes a single row of run
+// totals and no per-file rows.
+func TestAggregateOnly(t *testing.T) {
+	dir := t.TempDir()
+	project := filepath.Join(dir, "project")
+	writeProject(t, project, "a.py", "b.py")
+	server := eventServer(t, func(req GenerateTestRequest) []map[string]string {
+		final := "60%"
+		if filepath.Base(req.SrcFilePath) == "b.py" {
+			final = "80%"
+		}
+		return []map[string]string{
+			{"dataType": "calculatedCoverage", "calculatedCoverage": "40%"},
+			{"dataType": "summary", "coverageIncreased": "Coverage is now " + final, "linesCovered": "7", "totalLines": "10", "testAdded": "2"},
+		}
+	})
+
+	output := filepath.Join(dir, "report.csv")
+	if code := run([]string{"-root", project, "-api-url", server.URL, "-format", "csv", "-output", output, "-aggregate-only"}); code != exitOK {
+		t.Errorf("got exit code %d", code)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || lines[0] != "Files,Initial Coverage,Final Coverage,Tests Added,Total Duration" || !strings.HasPrefix(lines[1], "2,40,70,4,") {
+		t.Errorf("aggregate report:\n%s", data)
+	}
+}
+
+// TestStreamTypeCoverage checks that unit and integration coverage are read
+// from the summary when present, and left unset when missing.
+func TestStreamTypeCoverage(t *testing.T) {
+	summary := StreamEvent{Fields: map[string]interface{}{"dataType": "summary", "coverageIncreased": "Coverage increased from 10% to 80%", "linesCovered": "8", "totalLines": "10", "testAdded": "3", "unitCoverage": "Unit coverage: 72.5%"}}
+	cfg := &Config{transport: fakeTransport{[]StreamEvent{coverageEvent("10%"), summary}}}
+	metrics, err := streamMetrics(cfg, GenerateTestRequest{SrcFilePath: "fake.py"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics.UnitCoverage == nil || *metrics.UnitCoverage != 72.5 || metrics.IntegrationCoverage != nil {
+		t.Errorf("got unit %v, integration %v; want 72.5 and unset", metrics.UnitCoverage, metrics.IntegrationCoverage)
+	}
+	r := Result{Status: statusOK, Metrics: metrics}
+	if got := columnByKey("integration_coverage").Value(r); got != "" {
+		t.Errorf("integration coverage column %v, want blank", got)
+	}
+}
+
+// TestStdout checks that -stdout writes only the report to standard output
+// and refuses formats that cannot be piped.
+func TestStdout(t *testing.T) {
+	dir := t.TempDir()
+	project := filepath.Join(dir, "project")
+	writeProject(t, project, "a.py")
+	server := eventServer(t, func(GenerateTestRequest) []map[string]string {
+		return []map[string]string{{"dataType": "summary", "coverageIncreased": "Coverage increased from 40% to 60%", "linesCovered": "6", "totalLines": "10", "testAdded": "1"}}
+	})
+
+	var code int
+	out := captureStdout(t, func() {
+		code = run([]string{"-root", project, "-api-url", server.URL, "-format", "json", "-columns", "path,status", "-stdout"})
+	})
+	if code != exitOK {
+		t.Errorf("got exit code %d", code)
+	}
+	var rows []map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &rows); err != nil || len(rows) != 1 || rows[0]["path"] != "a.py" {
+		t.Errorf("standard output is not the JSON report (%v):\n%s", err, out)
+	}
+
+	for _, args := range [][]string{{"-format", "excel"}, {"-format", "csv,json"}} {
+		if _, err := parseConfig(append([]string{"-root", project, "-stdout"}, args...)); err == nil {
+			t.Errorf("-stdout %v accepted", args)
+		}
+	}
+}
+
+// TestPathBase checks that -path-base records report paths relative to the
+// given directory rather than the scan root.
+func TestPathBase(t *testing.T) {
+	dir := t.TempDir()
+	project := filepath.Join(dir, "repo", "svc")
+	writeProject(t, project, "a.py")
+	server := eventServer(t, func(GenerateTestRequest) []map[string]string {
+		return []map[string]string{{"dataType": "summary", "coverageIncreased": "Coverage increased from 40% to 60%", "linesCovered": "6", "totalLines": "10", "testAdded": "1"}}
+	})
+
+	output := filepath.Join(dir, "report.csv")
+	if code := run([]string{"-root", project, "-api-url", server.URL, "-format", "csv", "-output", output, "-path-base", filepath.Join(dir, "repo")}); code != exitOK {
+		t.Errorf("got exit code %d", code)
+	}
+	rows, err := readReport(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0]["path"] != "svc/a.py" {
+		t.Errorf("report rows %v, want svc/a.py", rows)
+	}
+}
+
+// TestRequireImprovement checks that -require-improvement fails the run
+// and lists the files whose coverage did not increase, including those the
+// server reports with "Coverage did not increase".
+func TestRequireImprovement(t *testing.T) {
+	dir := t.TempDir()
+	project := filepath.Join(dir, "project")
+	writeProject(t, project, "a.py", "b.py")
+	server := eventServer(t, func(req GenerateTestRequest) []map[string]string {
+		change := "Coverage increased from 40% to 60%"
+		if filepath.Base(req.SrcFilePath) == "b.py" {
+			change = "Coverage did not increase"
+		}
+		return []map[string]string{
+			{"dataType": "calculatedCoverage", "calculatedCoverage": "40%"},
+			{"dataType": "summary", "coverageIncreased": change, "linesCovered": "6", "totalLines": "10", "testAdded": "1"},
+		}
+	})
+
+	var code int
+	out := captureStdout(t, func() {
+		code = run([]string{"-root", project, "-api-url", server.URL, "-format", "csv", "-output", filepath.Join(dir, "report.csv"), "-require-improvement"})
+	})
+	if code != exitCoverageGate {
+		t.Errorf("got exit code %d, want %d", code, exitCoverageGate)
+	}
+	if !strings.Contains(out, "1 files did not improve") || !strings.Contains(out, "  b.py: 40.00% -> 40.00%") || strings.Contains(out, "  a.py:") {
+		t.Errorf("output does not list just b.py:\n%s", out)
+	}
+}
+
+// TestRequestIDColumn checks that -request-id records the X-Request-ID
+// header or requestId event of each file, leaving it blank otherwise.
+func TestRequestIDColumn(t *testing.T) {
+	dir := t.TempDir()
+	project := filepath.Join(dir, "project")
+	writeProject(t, project, "a.py", "b.py", "c.py")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req GenerateTestRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		switch filepath.Base(req.SrcFilePath) {
+		case "a.py":
+			w.Header().Set("X-Request-ID", "req-a")
+		case "b.py":
+			fmt.Fprintln(w, `{"dataType": "status", "requestId": "req-b"}`)
+		}
+		fmt.Fprintln(w, `{"dataType": "summary", "coverageIncreased": "Coverage increased from 40% to 60%", "linesCovered": "6", "totalLines": "10", "testAdded": "1"}`)
+	}))
+	defer server.Close()
+
+	output := filepath.Join(dir, "report.csv")
+	if code := run([]string{"-root", project, "-api-url", server.URL, "-format", "csv", "-output", output, "-request-id"}); code != exitOK {
+		t.Errorf("got exit code %d", code)
+	}
+	rows, err := readReport(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a.py": "req-a", "b.py": "req-b", "c.py": ""}
+	for _, row := range rows {
+		if row["request_id"] != want[row["path"]] {
+			t.Errorf("%s: request ID %q, want %q", row["path"], row["request_id"], want[row["path"]])
+		}
+	}
+	if len(rows) != 3 {
+		t.Errorf("got %d rows, want 3", len(rows))
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Manifest is a machine-readable record of a run, written with -manifest
+// next to the reports.
+type Manifest struct {
+	Version  string   `json:"version"`
+	Started  string   `json:"started"`
+	Finished string   `json:"finished"`
+	Duration string   `json:"duration"`
+	Root     string   `json:"root"`
+	Commit   string   `json:"commit,omitempty"`
+	Dirty    *bool    `json:"dirty,omitempty"`
+	Reports  []string `json:"reports"`
+
+	ServerVersion string `json:"serverVersion,omitempty"`
+	SchemaVersion string `json:"schemaVersion,omitempty"`
+	Seed          *int64 `json:"seed,omitempty"`
+	Profile       string `json:"profile,omitempty"`
+
+	Processed       int     `json:"processed"`
+	Failed          int     `json:"failed"`
+	NoLines         int     `json:"noMeasurableLines"`
+	Unprocessed     int     `json:"unprocessed"`
+	FromTrailer     int     `json:"fromTrailer"`
+	Incomplete      int     `json:"incomplete"`
+	Excluded        int     `json:"excludedFromAggregate"`
+	Warnings        int     `json:"warnings"`
+	InitialCoverage float64 `json:"initialCoverage"`
+	FinalCoverage   float64 `json:"finalCoverage"`
+	TestsAdded      float64 `json:"testsAdded"`
+	ExitCode        int     `json:"exitCode"`
+
+	UnitCoverage        *float64 `json:"unitCoverage,omitempty"`
+	IntegrationCoverage *float64 `json:"integrationCoverage,omitempty"`
+}
+
+// newManifest records the run. Under -redact the root directories are
+// hashed like the report rows.
+func newManifest(cfg *Config, meta ReportMetadata, summary Summary, start, end time.Time, pathRedactor *redactor) Manifest {
+	m := Manifest{
+		Version:         version,
+		Started:         start.Format(time.RFC3339),
+		Finished:        end.Format(time.RFC3339),
+		Duration:        end.Sub(start).String(),
+		Root:            summary.Root,
+		Commit:          meta.Commit,
+		Dirty:           meta.Dirty,
+		ServerVersion:   summary.Server.ServerVersion,
+		SchemaVersion:   summary.Server.SchemaVersion,
+		Seed:            cfg.seed,
+		Profile:         cfg.Profile,
+		Processed:       summary.Processed,
+		Failed:          summary.Failed,
+		NoLines:         summary.NoLines,
+		Unprocessed:     summary.Unprocessed,
+		FromTrailer:     summary.FromTrailer,
+		Incomplete:      summary.Incomplete,
+		Warnings:        summary.Warnings,
+		InitialCoverage: roundTo(summary.InitialCoverage(), cfg.Precision),
+		FinalCoverage:   roundTo(summary.FinalCoverage(), cfg.Precision),
+		TestsAdded:      summary.TestsAdded,
+		ExitCode:        exitCode(summary),
+	}
+	if pathRedactor != nil {
+		dirs := strings.Split(summary.Root, ", ")
+		for i, dir := range dirs {
+			dirs[i] = pathRedactor.Redact(dir)
+		}
+		m.Root = strings.Join(dirs, ", ")
+	}
+	if summary.Excluded != nil {
+		m.Excluded = summary.Excluded.Processed
+	}
+	if v, ok := summary.UnitCoverage(); ok {
+		m.UnitCoverage = roundOptional(&v, cfg.Precision)
+	}
+	if v, ok := summary.IntegrationCoverage(); ok {
+		m.IntegrationCoverage = roundOptional(&v, cfg.Precision)
+	}
+	for _, format := range cfg.Formats {
+		if cfg.Stdout {
+			m.Reports = append(m.Reports, "-")
+			continue
+		}
+		m.Reports = append(m.Reports, cfg.outputPath(format))
+	}
+	return m
+}
+
+// saveManifest writes the -manifest, if asked for.
+func saveManifest(cfg *Config, meta ReportMetadata, summary Summary, start, end time.Time, pathRedactor *redactor) {
+	if cfg.Manifest == "" {
+		return
+	}
+	if err := writeManifest(cfg.Manifest, newManifest(cfg, meta, summary, start, end, pathRedactor)); err != nil {
+		fmt.Println("Failed to write manifest:", err)
+	} else {
+		fmt.Printf("Manifest saved as %s\n", cfg.Manifest)
+	}
+}
+
+func writeManifest(path string, m Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// gitCommit returns the HEAD commit of the repository containing dir and
+// whether its working tree has uncommitted changes.
+func gitCommit(dir string) (string, bool, error) {
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return "", false, fmt.Errorf("%s is not in a git repository", dir)
+	}
+	status, err := exec.Command("git", "-C", dir, "status", "--porcelain").Output()
+	if err != nil {
+		return "", false, fmt.Errorf("git status failed: %w", err)
+	}
+	return strings.TrimSpace(string(out)), len(strings.TrimSpace(string(status))) > 0, nil
+}
+
+// resolveCommit fills in the commit recorded for the run. An explicit
+// -commit wins; otherwise it is detected from the root, and a root outside
+// a git checkout records no commit.
+func resolveCommit(cfg *Config, dir string, meta *ReportMetadata) {
+	if cfg.Commit != "" {
+		meta.Commit = cfg.Commit
+		return
+	}
+	sha, dirty, err := gitCommit(dir)
+	if err != nil {
+		debugf("commit not recorded: %v", err)
+		return
+	}
+	meta.Commit, meta.Dirty = sha, &dirty
+}
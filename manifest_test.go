@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestNewManifestRedactsRoots checks that under -redact every root
+// directory is hashed like the report rows.
+func TestNewManifestRedactsRoots(t *testing.T) {
+	redact, err := newRedactor("seed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary := Summary{Root: "/home/dev/secret-api, /home/dev/secret-web"}
+	m := newManifest(&Config{}, ReportMetadata{}, summary, time.Unix(0, 0), time.Unix(60, 0), redact)
+	if strings.Contains(m.Root, "secret") {
+		t.Errorf("manifest root %q exposes the roots", m.Root)
+	}
+	if want := redact.Redact("/home/dev/secret-api") + ", " + redact.Redact("/home/dev/secret-web"); m.Root != want {
+		t.Errorf("manifest root is %q, want %q", m.Root, want)
+	}
+
+	if m := newManifest(&Config{}, ReportMetadata{}, summary, time.Unix(0, 0), time.Unix(60, 0), nil); m.Root != summary.Root {
+		t.Errorf("without -redact the manifest root is %q, want %q", m.Root, summary.Root)
+	}
+}
+
+// TestResolveCommit checks that the commit is detected without any flag,
+// that -commit overrides it and that a root outside git records none.
+func TestResolveCommit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	repo := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "initial"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	head, err := exec.Command("git", "-C", repo, "rev-parse", "HEAD").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var meta ReportMetadata
+	resolveCommit(&Config{}, repo, &meta)
+	if meta.Commit != strings.TrimSpace(string(head)) || meta.Dirty == nil || *meta.Dirty {
+		t.Errorf("clean checkout: got commit %q, dirty %v", meta.Commit, meta.Dirty)
+	}
+
+	if err := os.WriteFile(filepath.Join(repo, "app.py"), []byte("x = 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	meta = ReportMetadata{}
+	resolveCommit(&Config{}, repo, &meta)
+	if meta.Dirty == nil || !*meta.Dirty {
+		t.Errorf("dirty checkout: got dirty %v", meta.Dirty)
+	}
+
+	meta = ReportMetadata{}
+	resolveCommit(&Config{Commit: "abc123"}, repo, &meta)
+	if meta.Commit != "abc123" || meta.Dirty != nil {
+		t.Errorf("-commit abc123: got commit %q, dirty %v", meta.Commit, meta.Dirty)
+	}
+
+	meta = ReportMetadata{}
+	resolveCommit(&Config{}, t.TempDir(), &meta)
+	if meta.Commit != "" || meta.Dirty != nil {
+		t.Errorf("outside git: got commit %q, dirty %v", meta.Commit, meta.Dirty)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runMerge combines reports from earlier runs, such as the chunks of a
+// -chunk-size run, into the configured reports. Every input must have the
+// same columns. Rows are deduplicated by root, path and function; the row
+// with the later end time wins, and on a tie the one from the later input.
+func runMerge(cfg *Config, inputs []string, start time.Time) int {
+	var schema []string
+	var results []Result
+	index := make(map[string]int)
+	for _, input := range inputs {
+		keys, rows, err := readReportTable(input)
+		if err != nil {
+			fmt.Printf("Error reading report %s: %v\n", input, err)
+			return exitFatal
+		}
+		if schema == nil {
+			schema = keys
+			for _, key := range keys {
+				if columnByKey(key) == nil {
+					fmt.Printf("Error reading report %s: unknown column %q\n", input, key)
+					return exitFatal
+				}
+			}
+		} else if !sameColumns(keys, schema) {
+			fmt.Printf("Error merging reports: %s has columns %s but %s has %s\n",
+				input, strings.Join(keys, ", "), inputs[0], strings.Join(schema, ", "))
+			return exitFatal
+		}
+
+		for _, row := range rows {
+			result, err := rowToResult(row)
+			if err != nil {
+				fmt.Printf("Error reading report %s: row %s: %v\n", input, row["path"], err)
+				return exitFatal
+			}
+			result.Path = normalizePath(result.Path, cfg.PathStyle)
+			result.ExcludedFromAggregate = excludedFromAggregate(cfg, result.Tags)
+			id := result.Root + "\x00" + result.Path + ":" + result.Function
+			if i, ok := index[id]; ok {
+				if !result.EndTime.Before(results[i].EndTime) {
+					results[i] = result
+				}
+				continue
+			}
+			index[id] = len(results)
+			results = append(results, result)
+		}
+		fmt.Printf("Read %d rows from %s\n", len(rows), input)
+	}
+
+	if cfg.columns == nil {
+		for _, key := range schema {
+			cfg.columns = append(cfg.columns, *columnByKey(key))
+		}
+	}
+	var err error
+	cfg.Output, err = expandTemplate(cfg.Output, outputTemplateVars(start, pythonProfile.Name, len(results), cfg.ChunkIndex))
+	if err != nil {
+		fmt.Println("Error expanding output filename:", err)
+		return exitFatal
+	}
+	exporters, err := openExporters(cfg, newReportMetadata(cfg, start))
+	if err != nil {
+		fmt.Println("Error creating report:", err)
+		return exitFatal
+	}
+	reports := newReporter(cfg, exporters)
+
+	summary := Summary{Root: strings.Join(inputs, ", ")}
+	sortResults(results, cfg.SortBy)
+	for _, result := range results {
+		summary.Add(result)
+		reports.Write(result)
+	}
+	reports.Close()
+
+	fmt.Printf("Merged %d reports into %d rows\n", len(inputs), len(results))
+	printSavedReports(cfg)
+	summary.Print()
+	if columnIndex(cfg.columns, "tags") >= 0 {
+		printTagSummaries(results)
+	}
+	checkCoverageGate(cfg, results, &summary)
+	return exitCode(summary)
+}
+
+// sameColumns compares column sets; JSON reports carry no column order.
+func sameColumns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, key := range a {
+		if !contains(b, key) {
+			return false
+		}
+	}
+	return true
+}
+
+// rowToResult turns a report row back into a result. Blank generation
+// columns on a successful row mark a -measure-only result.
+func rowToResult(row ReportRow) (Result, error) {
+	_, hasStatus := row["status"]
+	r := Result{
+		Root:     row["root"],
+		Path:     row["path"],
+		AbsPath:  row["abs_path"],
+		Function: row["function"],
+		Status:   row["status"],
+
+		MetExpected: row["met_expected"],
+	}
+	r.Metrics.RequestID = row["request_id"]
+	if row["tags"] != "" {
+		r.Tags = strings.Split(row["tags"], ",")
+	}
+	// Excel stores booleans as 1 and 0.
+	r.ZeroRetried, _ = strconv.ParseBool(row["zero_retry"])
+	if row["flaky"] != "" || row["flaky_runs"] != "" {
+		r.Metrics.Flakiness.Reported = true
+		r.Metrics.Flakiness.Flaky, _ = strconv.ParseBool(row["flaky"])
+		r.Metrics.Flakiness.Runs, _ = strconv.ParseFloat(row["flaky_runs"], 64)
+	}
+	if r.Status == "" {
+		r.Status = statusOK
+	}
+	_, hasFinal := row["final_coverage"]
+	r.MeasureOnly = hasStatus && hasFinal && row["final_coverage"] == "" && r.Status != statusNoLines && r.Status != statusUnsupported && r.Status != statusIncomplete
+
+	fields := []struct {
+		key   string
+		value *float64
+	}{
+		{"initial_coverage", &r.Metrics.InitialCoverage},
+		{"final_coverage", &r.Metrics.FinalCoverage},
+		{"lines_covered", &r.Metrics.LinesCovered},
+		{"total_lines", &r.Metrics.TotalLines},
+		{"tests_added", &r.Metrics.TestAdded},
+	}
+	for _, f := range fields {
+		if row[f.key] == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(row[f.key], 64)
+		if err != nil {
+			return r, fmt.Errorf("invalid %s %q", f.key, row[f.key])
+		}
+		*f.value = v
+	}
+	for _, f := range []struct {
+		key   string
+		value **float64
+	}{
+		{"unit_coverage", &r.Metrics.UnitCoverage},
+		{"integration_coverage", &r.Metrics.IntegrationCoverage},
+	} {
+		if row[f.key] == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(row[f.key], 64)
+		if err != nil {
+			return r, fmt.Errorf("invalid %s %q", f.key, row[f.key])
+		}
+		*f.value = &v
+	}
+
+	if row["trajectory"] != "" {
+		for _, value := range strings.Split(row["trajectory"], ",") {
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return r, fmt.Errorf("invalid trajectory %q", row["trajectory"])
+			}
+			r.Metrics.Trajectory = append(r.Metrics.Trajectory, v)
+		}
+	}
+
+	var err error
+	if row["duration"] != "" {
+		if r.Duration, err = time.ParseDuration(row["duration"]); err != nil {
+			return r, fmt.Errorf("invalid duration %q", row["duration"])
+		}
+	}
+	if row["start_time"] != "" {
+		if r.StartTime, err = time.Parse(time.RFC3339, row["start_time"]); err != nil {
+			return r, fmt.Errorf("invalid start time %q", row["start_time"])
+		}
+	}
+	if row["end_time"] != "" {
+		if r.EndTime, err = time.Parse(time.RFC3339, row["end_time"]); err != nil {
+			return r, fmt.Errorf("invalid end time %q", row["end_time"])
+		}
+	}
+	if r.Compare, err = rowToCompare(row, r.MeasureOnly); err != nil {
+		return r, err
+	}
+	return r, nil
+}
+
+// rowToCompare reads the -compare-url server's columns back into its
+// result, nil when the row has none. The delta columns are derived from
+// both results, so they are recomputed rather than read.
+func rowToCompare(row ReportRow, measureOnly bool) (*Result, error) {
+	if row["b_status"] == "" {
+		return nil, nil
+	}
+	b := &Result{Status: row["b_status"], MeasureOnly: measureOnly}
+	for _, f := range []struct {
+		key   string
+		value *float64
+	}{
+		{"b_initial_coverage", &b.Metrics.InitialCoverage},
+		{"b_final_coverage", &b.Metrics.FinalCoverage},
+		{"b_tests_added", &b.Metrics.TestAdded},
+	} {
+		if row[f.key] == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(row[f.key], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q", f.key, row[f.key])
+		}
+		*f.value = v
+	}
+	if row["b_duration"] != "" {
+		var err error
+		if b.Duration, err = time.ParseDuration(row["b_duration"]); err != nil {
+			return nil, fmt.Errorf("invalid b_duration %q", row["b_duration"])
+		}
+	}
+	return b, nil
+}
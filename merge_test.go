@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roundTrip writes r to a CSV report with every column and reads it back.
+func roundTrip(t *testing.T, r Result) Result {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "report.csv")
+	e, err := newCSVExporter(path, columns, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Write(r); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := readReport(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("read %d rows, want 1", len(rows))
+	}
+	merged, err := rowToResult(rows[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return merged
+}
+
+// checkColumns compares the values a result writes to the columns whose
+// key starts with one of prefixes.
+func checkColumns(t *testing.T, got, want Result, prefixes ...string) {
+	t.Helper()
+	for _, c := range columns {
+		for _, prefix := range prefixes {
+			if !strings.HasPrefix(c.Key, prefix) {
+				continue
+			}
+			if g, w := fmt.Sprint(c.Value(got)), fmt.Sprint(c.Value(want)); g != w {
+				t.Errorf("%s is %q after merging, want %q", c.Key, g, w)
+			}
+		}
+	}
+}
+
+func TestRowToResultCompare(t *testing.T) {
+	r := Result{
+		Path:     "app.py",
+		Status:   statusOK,
+		Duration: 3 * time.Second,
+		Metrics:  Metrics{InitialCoverage: 40, FinalCoverage: 75, TotalLines: 20, LinesCovered: 15, TestAdded: 2},
+		Compare: &Result{
+			Status:   statusOK,
+			Duration: 5 * time.Second,
+			Metrics:  Metrics{InitialCoverage: 40, FinalCoverage: 82.5, TestAdded: 3},
+		},
+	}
+	checkColumns(t, roundTrip(t, r), r, "b_", "delta_")
+
+	r.Compare = &Result{Status: statusError, Duration: time.Second}
+	checkColumns(t, roundTrip(t, r), r, "b_", "delta_")
+
+	r.Compare = nil
+	if merged := roundTrip(t, r); merged.Compare != nil {
+		t.Errorf("row without -compare-url columns merged with %+v", merged.Compare)
+	}
+}
+
+func TestRowToResultTrajectory(t *testing.T) {
+	r := Result{Path: "app.py", Status: statusOK, Metrics: Metrics{InitialCoverage: 40, FinalCoverage: 62, TotalLines: 20, Trajectory: []float64{40, 55.5, 62}}}
+	merged := roundTrip(t, r)
+	if got := formatTrajectory(merged.Metrics.Trajectory); got != "40,55.5,62" {
+		t.Errorf("trajectory is %q after merging, want \"40,55.5,62\"", got)
+	}
+
+	r.Metrics.Trajectory = nil
+	if merged := roundTrip(t, r); merged.Metrics.Trajectory != nil {
+		t.Errorf("empty trajectory merged as %v", merged.Metrics.Trajectory)
+	}
+	if _, err := rowToResult(ReportRow{"path": "app.py", "trajectory": "40,,62"}); err == nil {
+		t.Error("invalid trajectory accepted")
+	}
+}
+
+// writeReport writes results to a CSV report with cols.
+func writeReport(t *testing.T, path string, cols []Column, results ...Result) {
+	t.Helper()
+	e, err := newCSVExporter(path, cols, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if err := e.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestMerge checks that -merge keeps the row that finished last for a path
+// and refuses reports with different columns.
+func TestMerge(t *testing.T) {
+	dir := t.TempDir()
+	cols := reportColumns(&Config{})
+	end := time.Date(2024, 3, 9, 15, 0, 0, 0, time.UTC)
+	result := func(path string, final float64, end time.Time) Result {
+		return Result{Path: path, Status: statusOK, StartTime: end.Add(-time.Minute), EndTime: end, Duration: time.Minute,
+			Metrics: Metrics{InitialCoverage: 10, FinalCoverage: final, TotalLines: 10}}
+	}
+	first, second := filepath.Join(dir, "chunk0.csv"), filepath.Join(dir, "chunk1.csv")
+	writeReport(t, first, cols, result("a.py", 40, end.Add(time.Hour)), result("b.py", 50, end))
+	writeReport(t, second, cols, result("a.py", 60, end), result("c.py", 70, end))
+
+	output := filepath.Join(dir, "merged.csv")
+	if code := run([]string{"-merge", "-format", "csv", "-output", output, first, second}); code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+	rows, err := readReport(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, row := range rows {
+		got = append(got, row["path"]+"="+row["final_coverage"])
+	}
+	if want := "a.py=40 b.py=50 c.py=70"; strings.Join(got, " ") != want {
+		t.Errorf("merged rows %v, want %s", got, want)
+	}
+
+	other := filepath.Join(dir, "other.csv")
+	writeReport(t, other, cols[:3], result("d.py", 80, end))
+	if code := run([]string{"-merge", "-format", "csv", "-output", output, first, other}); code != exitFatal {
+		t.Errorf("merging different columns: exit code %d, want %d", code, exitFatal)
+	}
+}
+
+// TestMergePathStyle checks that reports written on Windows and Unix merge
+// into one row per file under -path-style unix.
+func TestMergePathStyle(t *testing.T) {
+	if got := normalizePath(`pkg\sub\a.py`, "unix"); got != "pkg/sub/a.py" {
+		t.Errorf("unix style: got %s", got)
+	}
+	if got := normalizePath(`pkg\sub\a.py`, "native"); got != `pkg\sub\a.py` {
+		t.Errorf("native style: got %s", got)
+	}
+
+	dir := t.TempDir()
+	cols := []Column{*columnByKey("path"), *columnByKey("status"), *columnByKey("end_time")}
+	end := time.Date(2024, 3, 9, 15, 0, 0, 0, time.UTC)
+	windows, unix := filepath.Join(dir, "windows.csv"), filepath.Join(dir, "unix.csv")
+	writeReport(t, windows, cols, Result{Path: `pkg\a.py`, Status: statusError, EndTime: end})
+	writeReport(t, unix, cols, Result{Path: "pkg/a.py", Status: statusOK, EndTime: end.Add(time.Minute)})
+
+	output := filepath.Join(dir, "merged.csv")
+	run([]string{"-merge", "-format", "csv", "-output", output, windows, unix})
+	rows, err := readReport(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0]["path"] != "pkg/a.py" || rows[0]["status"] != statusOK {
+		t.Errorf("got rows %v, want pkg/a.py from unix.csv", rows)
+	}
+}
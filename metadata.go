@@ -0,0 +1,64 @@
+package main
+
+import "time"
+
+// version is the tool version recorded in reports; override it at build
+// time with -ldflags "-X main.version=1.2.3".
+var version = "dev"
+
+// ReportMetadata describes a run at the top of a report so archived reports
+// are self-describing.
+type ReportMetadata struct {
+	Title     string `json:"title,omitempty"`
+	Note      string `json:"note,omitempty"`
+	Generated string `json:"generated"`
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Dirty     *bool  `json:"dirty,omitempty"`
+
+	// ServerA and ServerB label the servers of a -compare-url run.
+	ServerA string `json:"serverA,omitempty"`
+	ServerB string `json:"serverB,omitempty"`
+}
+
+func newReportMetadata(cfg *Config, start time.Time) ReportMetadata {
+	m := ReportMetadata{
+		Title:     cfg.ReportTitle,
+		Note:      cfg.ReportNote,
+		Generated: start.Format(time.RFC3339),
+		Version:   version,
+	}
+	if cfg.CompareURL != "" {
+		m.ServerA, m.ServerB = cfg.APIURL, cfg.CompareURL
+	}
+	return m
+}
+
+// Enabled reports whether a metadata block should be written at all; the
+// default report layout is unchanged unless a title, note, commit or
+// comparison server is given.
+func (m ReportMetadata) Enabled() bool {
+	return m.Title != "" || m.Note != "" || m.Commit != "" || m.ServerB != ""
+}
+
+// Rows returns the label/value pairs of the metadata block.
+func (m ReportMetadata) Rows() [][2]string {
+	var rows [][2]string
+	if m.Title != "" {
+		rows = append(rows, [2]string{"Title", m.Title})
+	}
+	if m.Note != "" {
+		rows = append(rows, [2]string{"Note", m.Note})
+	}
+	if m.Commit != "" {
+		commit := m.Commit
+		if m.Dirty != nil && *m.Dirty {
+			commit += " (dirty)"
+		}
+		rows = append(rows, [2]string{"Commit", commit})
+	}
+	if m.ServerB != "" {
+		rows = append(rows, [2]string{"Server A", m.ServerA}, [2]string{"Server B", m.ServerB})
+	}
+	return append(rows, [2]string{"Generated", m.Generated}, [2]string{"Tool Version", m.Version})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestReportMetadata checks the metadata block's rows and that the JSON
+// report only wraps its rows when there is a block to write.
+func TestReportMetadata(t *testing.T) {
+	start := time.Date(2024, 3, 9, 15, 0, 0, 0, time.UTC)
+	dirty := true
+	meta := newReportMetadata(&Config{ReportTitle: "Nightly", ReportNote: "main branch"}, start)
+	meta.Commit, meta.Dirty = "abc123", &dirty
+	want := [][2]string{
+		{"Title", "Nightly"},
+		{"Note", "main branch"},
+		{"Commit", "abc123 (dirty)"},
+		{"Generated", "2024-03-09T15:00:00Z"},
+		{"Tool Version", version},
+	}
+	if got := meta.Rows(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got rows %v, want %v", got, want)
+	}
+
+	cols := []Column{*columnByKey("path")}
+	for _, tc := range []struct {
+		meta    ReportMetadata
+		wrapped bool
+	}{
+		{meta, true},
+		{newReportMetadata(&Config{}, start), false},
+	} {
+		path := filepath.Join(t.TempDir(), "report.json")
+		e, err := newJSONExporter(path, cols, tc.meta, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.Write(Result{Path: "a.py"})
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var report struct {
+			Metadata *ReportMetadata `json:"metadata"`
+			Rows     []interface{}   `json:"rows"`
+		}
+		wrapped := json.Unmarshal(data, &report) == nil
+		if wrapped != tc.wrapped || (wrapped && (report.Metadata.Title != "Nightly" || len(report.Rows) != 1)) {
+			t.Errorf("metadata enabled %v: got report\n%s", tc.meta.Enabled(), data)
+		}
+	}
+}
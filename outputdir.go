@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// createRunDir makes a new directory for this run's artifacts under dir,
+// named after the start time. A single Mkdir creates it, so concurrent runs
+// never share one; a clash gets a numeric suffix.
+func createRunDir(dir string, start time.Time) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create output directory: %w", err)
+	}
+	base := filepath.Join(dir, "run-"+start.Format("20060102-150405"))
+	path := base
+	for n := 2; ; n++ {
+		err := os.Mkdir(path, 0755)
+		if err == nil {
+			return path, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return "", fmt.Errorf("failed to create run directory: %w", err)
+		}
+		path = fmt.Sprintf("%s-%d", base, n)
+	}
+}
+
+// openRunDir creates the -output-dir run directory and moves the run's
+// outputs into it. Without -output-dir it returns "".
+func openRunDir(cfg *Config, start time.Time) (string, error) {
+	if cfg.OutputDir == "" {
+		return "", nil
+	}
+	runDir, err := createRunDir(cfg.OutputDir, start)
+	if err != nil {
+		return "", err
+	}
+	cfg.bundleOutputs(runDir)
+	return runDir, nil
+}
+
+// closeRunDir indexes the artifacts left in a run directory.
+func closeRunDir(runDir string) {
+	if runDir == "" {
+		return
+	}
+	if err := writeIndex(runDir); err != nil {
+		fmt.Println("Failed to write artifact index:", err)
+	} else {
+		fmt.Printf("Run artifacts saved in %s\n", runDir)
+	}
+}
+
+// bundleOutputs moves the run's artifacts into runDir: relative report,
+// manifest, summary log, coverage annotation, Cobertura, badge, timings
+// chart and redaction map paths are resolved inside it, while absolute ones
+// stay where they were asked for. The manifest is always written.
+func (c *Config) bundleOutputs(runDir string) {
+	inDir := func(path string) string {
+		if path == "" || filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(runDir, path)
+	}
+	if c.Manifest == "" {
+		c.Manifest = "manifest.json"
+	}
+	c.Output = inDir(c.Output)
+	c.Manifest = inDir(c.Manifest)
+	c.SummaryLog = inDir(c.SummaryLog)
+	c.CovOut = inDir(c.CovOut)
+	c.Cobertura = inDir(c.Cobertura)
+	c.Badge = inDir(c.Badge)
+	c.TimingsChart = inDir(c.TimingsChart)
+	c.RedactMap = inDir(c.RedactMap)
+}
+
+// writeIndex lists every file the run left in runDir in index.txt.
+func writeIndex(runDir string) error {
+	var files []string
+	err := filepath.WalkDir(runDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(runDir, path)
+		if err != nil {
+			return err
+		}
+		if rel != "index.txt" {
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list run artifacts: %w", err)
+	}
+	sort.Strings(files)
+	return os.WriteFile(filepath.Join(runDir, "index.txt"), []byte(strings.Join(files, "\n")+"\n"), 0644)
+}
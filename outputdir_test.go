@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestOutputDir checks that two runs started in the same second get their
+// own run directory, and that the artifacts are indexed.
+func TestOutputDir(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2024, 3, 9, 15, 0, 0, 0, time.UTC)
+	absoluteLog := filepath.Join(dir, "elsewhere.log")
+	var runDirs []string
+	for i := 0; i < 2; i++ {
+		cfg := &Config{OutputDir: filepath.Join(dir, "out"), Output: "report.xlsx", SummaryLog: absoluteLog}
+		runDir, err := openRunDir(cfg, start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Output != filepath.Join(runDir, "report.xlsx") || cfg.Manifest != filepath.Join(runDir, "manifest.json") || cfg.SummaryLog != absoluteLog {
+			t.Errorf("run %d: output %s, manifest %s, summary log %s", i, cfg.Output, cfg.Manifest, cfg.SummaryLog)
+		}
+		runDirs = append(runDirs, runDir)
+	}
+	if want := filepath.Join(dir, "out", "run-20240309-150000"); runDirs[0] != want || runDirs[1] != want+"-2" {
+		t.Errorf("run directories %v, want %s and its -2 sibling", runDirs, want)
+	}
+
+	for _, name := range []string{"report.xlsx", "manifest.json", filepath.Join("cov", "a.py.cov")} {
+		path := filepath.Join(runDirs[0], name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	closeRunDir(runDirs[0])
+	data, err := os.ReadFile(filepath.Join(runDirs[0], "index.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "cov/a.py.cov\nmanifest.json\nreport.xlsx\n"; string(data) != want {
+		t.Errorf("index.txt:\n%s\nwant:\n%s", data, want)
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// expectedSchemaVersion is the server event schema this parser is written
+// against. Bump it together with parser changes for a new schema.
+const expectedSchemaVersion = "1"
+
+// errSchemaMismatch fails a file under -strict. Retrying cannot help, as the
+// server answers with the same schema every time.
+var errSchemaMismatch = errors.New("server schema version mismatch")
+
+// ServerInfo is what a server reports about itself, in X-Schema-Version and
+// X-Server-Version headers or a serverInfo event.
+type ServerInfo struct {
+	SchemaVersion string
+	ServerVersion string
+}
+
+// parseServerInfo reads a serverInfo event. Under -strict a schema other
+// than expectedSchemaVersion fails the file; otherwise the run warns once.
+func parseServerInfo(event map[string]interface{}, info *ServerInfo, strict bool) error {
+	if event["dataType"] != "serverInfo" {
+		return nil
+	}
+	info.SchemaVersion = eventString(event, "schemaVersion")
+	info.ServerVersion = eventString(event, "serverVersion")
+	if strict && info.SchemaVersion != "" && info.SchemaVersion != expectedSchemaVersion {
+		return fmt.Errorf("%w: %s does not match expected %s", errSchemaMismatch, info.SchemaVersion, expectedSchemaVersion)
+	}
+	return nil
+}
+
+// eventString returns a field as text, accepting numbers as well as strings.
+func eventString(event map[string]interface{}, field string) string {
+	switch v := event[field].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// metricLabels holds, per event field, patterns that pick the wanted number
+// out of the server's phrasing by its label rather than its position, e.g.
+// "Coverage increased from 40.5% to 72%" or "covered 18 of 25 lines". The
+// first capture group of the first matching pattern wins.
+var metricLabels = map[string][]*regexp.Regexp{
+	"calculatedCoverage": {
+		regexp.MustCompile(`(?i)coverage\s*(?:is|of|at|:)?\s*(\d+(?:\.\d+)?)\s*%`),
+		regexp.MustCompile(`(\d+(?:\.\d+)?)\s*%`),
+	},
+	"coverageIncreased": {
+		regexp.MustCompile(`(?i)\bto\s+(\d+(?:\.\d+)?)\s*%`),
+		regexp.MustCompile(`(?i)coverage\s*(?:is|of|at|now|:)?\s*(\d+(?:\.\d+)?)\s*%`),
+		regexp.MustCompile(`(\d+(?:\.\d+)?)\s*%`),
+	},
+	"linesCovered": {
+		regexp.MustCompile(`(?i)covered\s+(\d+)\s+(?:of|/)\s+\d+`),
+		regexp.MustCompile(`(?i)(\d+)\s+(?:of\s+\d+\s+)?lines?\s+covered`),
+	},
+	"totalLines": {
+		regexp.MustCompile(`(?i)(?:of|/)\s+(\d+)\s+lines?`),
+		regexp.MustCompile(`(?i)(\d+)\s+(?:total\s+)?lines?`),
+	},
+	"flakyRuns": {
+		regexp.MustCompile(`(?i)(\d+)\s+runs?`),
+	},
+	"unitCoverage": {
+		regexp.MustCompile(`(\d+(?:\.\d+)?)\s*%`),
+	},
+	"integrationCoverage": {
+		regexp.MustCompile(`(\d+(?:\.\d+)?)\s*%`),
+	},
+	"testAdded": {
+		regexp.MustCompile(`(?i)(\d+)\s+(?:new\s+)?tests?`),
+	},
+}
+
+var numberPattern = regexp.MustCompile(`\d+(\.\d+)?`)
+
+// lastNumber returns the last number in s, or "" if there is none.
+func lastNumber(s string) string {
+	numbers := numberPattern.FindAllString(s, -1)
+	if len(numbers) == 0 {
+		return ""
+	}
+	return numbers[len(numbers)-1]
+}
+
+var thousandsSeparator = regexp.MustCompile(`(\d),(\d{3})(\D|$)`)
+
+// normalizeNumbers strips thousands separators, so "1,234 lines" reads as
+// 1234 rather than 234, and turns non-breaking spaces, as in "87.5\u00a0%",
+// into plain spaces the patterns allow before a percent sign.
+func normalizeNumbers(s string) string {
+	s = strings.NewReplacer("\u00a0", " ", "\u202f", " ").Replace(s)
+	for {
+		// Each pass consumes the character after a group, so "1,234,567"
+		// takes two.
+		next := thousandsSeparator.ReplaceAllString(s, "$1$2$3")
+		if next == s {
+			return s
+		}
+		s = next
+	}
+}
+
+// coverageMatch is set from -coverage-match at startup: how the initial
+// coverage is picked out of a calculatedCoverage message. The default is
+// auto rather than last: auto is the label-aware reading of metricLabels,
+// which replaced the plain last-number rule because that misread messages
+// such as "12.5% of 200 lines", and runs that relied on the old rule can
+// ask for last.
+var coverageMatch = "auto"
+
+var coverageMatchModes = []string{"auto", "first", "last", "labeled"}
+
+// coverageLabels find a number right before or after the word coverage,
+// as in "coverage is 40%" or "40% line coverage".
+var coverageLabels = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)coverage\s*(?:is|of|at|:)?\s*(\d+(?:\.\d+)?)`),
+	regexp.MustCompile(`(?i)(\d+(?:\.\d+)?)\s*%?\s*(?:line\s+)?coverage`),
+}
+
+// matchCoverage picks a number out of s by a -coverage-match mode other
+// than auto. labeled falls back to the last number.
+func matchCoverage(s, mode string) string {
+	switch mode {
+	case "first":
+		return numberPattern.FindString(s)
+	case "labeled":
+		for _, re := range coverageLabels {
+			if m := re.FindStringSubmatch(s); m != nil {
+				return m[1]
+			}
+		}
+	}
+	return lastNumber(s)
+}
+
+// extractMetric returns the number for field in s. Labeled patterns are
+// tried first; otherwise it falls back to the last number for the initial
+// coverage and the first number for everything else. A -coverage-match
+// other than auto replaces this for the initial coverage.
+func extractMetric(field, s string) (float64, bool) {
+	s = normalizeNumbers(s)
+	if field == "calculatedCoverage" && coverageMatch != "auto" {
+		number := matchCoverage(s, coverageMatch)
+		return toFloat(number), number != ""
+	}
+	for _, re := range metricLabels[field] {
+		if m := re.FindStringSubmatch(s); m != nil {
+			return toFloat(m[1]), true
+		}
+	}
+
+	number := numberPattern.FindString(s)
+	if field == "calculatedCoverage" {
+		number = lastNumber(s)
+	}
+	if number == "" {
+		return 0, false
+	}
+	return toFloat(number), true
+}
+
+// errUnsupported marks a file the server rejected as unsupported, by a 422
+// response or an error event, as opposed to a failure to process it.
+var errUnsupported = errors.New("not supported by the server")
+
+// unsupportedEvent returns the error for an "error" event that reports the
+// file as unsupported, by an "unsupported" code or its message. Other error
+// events are left to the events that follow.
+func unsupportedEvent(event map[string]interface{}) error {
+	if event["dataType"] != "error" {
+		return nil
+	}
+	message := eventString(event, "message")
+	if eventString(event, "code") == "unsupported" || strings.Contains(strings.ToLower(message), "not supported") || strings.Contains(strings.ToLower(message), "unsupported") {
+		return fmt.Errorf("%w: %s", errUnsupported, message)
+	}
+	return nil
+}
+
+// ParseWarning records an event field that could not be parsed, with its
+// raw value, so data-quality issues can be audited after the run.
+type ParseWarning struct {
+	Field string `json:"field"`
+	Value string `json:"value"`
+}
+
+// parseMetric reads a string field from an event and extracts its number,
+// printing and recording a warning when the field is missing or holds no
+// number.
+func parseMetric(event map[string]interface{}, field string, warnings *[]ParseWarning) (float64, bool) {
+	value, ok := event[field].(string)
+	if ok && value != "" {
+		if number, ok := extractMetric(field, value); ok {
+			return number, true
+		}
+	}
+	warn(event, field, warnings)
+	return 0, false
+}
+
+// parseOptionalMetric reads a field only some servers send, as a number or
+// a string. An absent field is nil without a warning.
+func parseOptionalMetric(event map[string]interface{}, field string, warnings *[]ParseWarning) *float64 {
+	switch v := event[field].(type) {
+	case nil:
+		return nil
+	case float64:
+		return &v
+	}
+	if n, ok := parseMetric(event, field, warnings); ok {
+		return &n
+	}
+	return nil
+}
+
+// progressPercent reads the percentage of a "progress" event, which some
+// servers send while a long file is being worked on.
+func progressPercent(event map[string]interface{}, warnings *[]ParseWarning) (float64, bool) {
+	if event["dataType"] != "progress" {
+		return 0, false
+	}
+	for _, field := range []string{"percentage", "progress"} {
+		if v := parseOptionalMetric(event, field, warnings); v != nil {
+			return min(max(*v, 0), 100), true
+		}
+	}
+	return 0, false
+}
+
+// trailerFields are the metrics a "done" trailer may carry, as numbers or
+// strings.
+var trailerFields = []string{"initialCoverage", "finalCoverage", "linesCovered", "totalLines", "testAdded"}
+
+// parseTrailer returns the metrics present in a "done" trailer.
+func parseTrailer(event map[string]interface{}, warnings *[]ParseWarning) map[string]float64 {
+	values := make(map[string]float64)
+	for _, field := range trailerFields {
+		switch v := event[field].(type) {
+		case float64:
+			values[field] = v
+		case string:
+			if n, ok := parseMetric(event, field, warnings); ok {
+				values[field] = n
+			}
+		}
+	}
+	return values
+}
+
+func warn(event map[string]interface{}, field string, warnings *[]ParseWarning) {
+	fmt.Printf("Warning: %s value missing or invalid\n", field)
+	raw := ""
+	if v := event[field]; v != nil {
+		raw = fmt.Sprint(v)
+	}
+	*warnings = append(*warnings, ParseWarning{Field: field, Value: raw})
+}
+
+// parseFlakiness reads the flakinessDetected and flakyRuns fields, from
+// whichever event carries them. Each may be a JSON bool or number, or a
+// string.
+func parseFlakiness(event map[string]interface{}, f *Flakiness, warnings *[]ParseWarning) {
+	switch v := event["flakinessDetected"].(type) {
+	case bool:
+		f.Reported, f.Flaky = true, v
+	case string:
+		flaky, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			warn(event, "flakinessDetected", warnings)
+			break
+		}
+		f.Reported, f.Flaky = true, flaky
+	}
+	switch v := event["flakyRuns"].(type) {
+	case float64:
+		f.Reported, f.Runs = true, v
+	case string:
+		if runs, ok := parseMetric(event, "flakyRuns", warnings); ok {
+			f.Reported, f.Runs = true, runs
+		}
+	}
+}
+
+// parseLineCoverage reads the optional coveredLines and uncoveredLines
+// fields, line ranges such as "3-7,10", into lines. Servers that report no
+// line-level data leave lines nil.
+func parseLineCoverage(event map[string]interface{}, lines *map[int]bool, warnings *[]ParseWarning) {
+	for field, covered := range map[string]bool{"coveredLines": true, "uncoveredLines": false} {
+		value, ok := event[field].(string)
+		if !ok {
+			continue
+		}
+		numbers, err := parseLineRanges(value)
+		if err != nil {
+			warn(event, field, warnings)
+			continue
+		}
+		if *lines == nil {
+			*lines = make(map[int]bool)
+		}
+		for _, n := range numbers {
+			(*lines)[n] = covered
+		}
+	}
+}
+
+func parseLineRanges(s string) ([]int, error) {
+	var numbers []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, isRange := strings.Cut(part, "-")
+		first, err := strconv.Atoi(strings.TrimSpace(from))
+		if err != nil || first < 1 {
+			return nil, fmt.Errorf("invalid line range %q", part)
+		}
+		last := first
+		if isRange {
+			last, err = strconv.Atoi(strings.TrimSpace(to))
+			if err != nil || last < first {
+				return nil, fmt.Errorf("invalid line range %q", part)
+			}
+		}
+		for n := first; n <= last; n++ {
+			numbers = append(numbers, n)
+		}
+	}
+	return numbers, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import "testing"
+
+// metricValues are event field values in formats servers have been seen to
+// send, with the number each must parse to.
+var metricValues = []struct {
+	field, value string
+	want         float64
+}{
+	{"linesCovered", "covered 1,234 of 2,000 lines", 1234},
+	{"totalLines", "covered 1,234 of 2,000 lines", 2000},
+	{"totalLines", "1,234,567 lines", 1234567},
+	{"totalLines", "12,34 lines", 34},
+	{"calculatedCoverage", "Current coverage is 87.5 %", 87.5},
+	{"calculatedCoverage", "Current coverage is 87.5\u00a0%", 87.5},
+	{"calculatedCoverage", "Coverage: 1,000.5%", 1000.5},
+	{"calculatedCoverage", "12.5% of 200 lines", 12.5},
+	{"calculatedCoverage", "Run 3: 45 tests", 45},
+	{"coverageIncreased", "Coverage increased from 40 % to 72.25 %", 72.25},
+	{"coverageIncreased", "Coverage increased from 40% to 72%", 72},
+	{"testAdded", "1,024 new tests", 1024},
+}
+
+func TestExtractMetric(t *testing.T) {
+	for _, tc := range metricValues {
+		got, ok := extractMetric(tc.field, tc.value)
+		if !ok || got != tc.want {
+			t.Errorf("%s %q: got %v (ok %v), want %v", tc.field, tc.value, got, ok, tc.want)
+		}
+	}
+}
+
+// coverageMatches pick the initial coverage by each -coverage-match mode.
+var coverageMatches = []struct {
+	mode, value string
+	want        float64
+}{
+	{"auto", "Measured 3 files: coverage at 55% (run 2)", 55},
+	{"first", "Measured 3 files: coverage at 55% (run 2)", 3},
+	{"last", "Measured 3 files: coverage at 55% (run 2)", 2},
+	{"labeled", "Measured 3 files: coverage at 55% (run 2)", 55},
+	{"auto", "40% line coverage across 12 files", 40},
+	{"first", "40% line coverage across 12 files", 40},
+	{"last", "40% line coverage across 12 files", 12},
+	{"labeled", "Across 12 files, 40% line coverage", 40},
+	{"labeled", "Measured 12 files at 40.5", 40.5},
+}
+
+func TestCoverageMatch(t *testing.T) {
+	defer func(mode string) { coverageMatch = mode }(coverageMatch)
+	for _, tc := range coverageMatches {
+		coverageMatch = tc.mode
+		got, ok := extractMetric("calculatedCoverage", tc.value)
+		if !ok || got != tc.want {
+			t.Errorf("-coverage-match %s %q: got %v (ok %v), want %v", tc.mode, tc.value, got, ok, tc.want)
+		}
+	}
+}
+
+func TestProgressPercent(t *testing.T) {
+	var warnings []ParseWarning
+	if got, ok := progressPercent(map[string]interface{}{"dataType": "progress", "percentage": "Generating: 40%"}, &warnings); !ok || got != 40 {
+		t.Errorf("progress event: got %v (ok %v), want 40", got, ok)
+	}
+	if _, ok := progressPercent(map[string]interface{}{"dataType": "progress"}, &warnings); ok || len(warnings) != 0 {
+		t.Errorf("progress event without a percentage: got ok %v, warnings %v", ok, warnings)
+	}
+}
+
+func TestParseFlakiness(t *testing.T) {
+	for _, tc := range []struct {
+		event    map[string]interface{}
+		want     Flakiness
+		warnings int
+	}{
+		{map[string]interface{}{"flakinessDetected": true, "flakyRuns": 3.0}, Flakiness{Reported: true, Flaky: true, Runs: 3}, 0},
+		{map[string]interface{}{"flakinessDetected": " false ", "flakyRuns": "5 runs"}, Flakiness{Reported: true, Runs: 5}, 0},
+		{map[string]interface{}{"flakinessDetected": "maybe"}, Flakiness{}, 1},
+		{map[string]interface{}{"dataType": "summary"}, Flakiness{}, 0},
+	} {
+		var f Flakiness
+		var warnings []ParseWarning
+		parseFlakiness(tc.event, &f, &warnings)
+		if f != tc.want || len(warnings) != tc.warnings {
+			t.Errorf("%v: got %+v with %d warnings, want %+v with %d", tc.event, f, len(warnings), tc.want, tc.warnings)
+		}
+	}
+}
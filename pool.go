@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+)
+
+// fileJob is one discovered file and the requests it fans out to.
+type fileJob struct {
+	index        int
+	file         string
+	relativeName string
+	requests     []GenerateTestRequest
+
+	// dirFiles are the files of a -by-directory job, whose file is their
+	// directory.
+	dirFiles []string
+
+	// duplicates counts functions left out by -dedupe-functions.
+	duplicates int
+}
+
+// newFileJob builds the requests for a file. In per-function mode a file
+// fans out to one request per listed function; files without a listed
+// function are processed whole. A directory in dirFiles gets a single
+// directory request. With -dedupe-functions, functions whose ID
+// is already in seen are left out.
+func newFileJob(cfg *Config, rootDir string, index int, file string, functions map[string][]functionTarget, seen map[string]bool, dirFiles map[string][]string) fileJob {
+	relativeName, err := filepath.Rel(rootDir, file)
+	if err != nil {
+		fmt.Printf("Failed to get relative path for %s: %v\n", file, err)
+		relativeName = file
+	}
+
+	job := fileJob{index: index, file: file, relativeName: relativeName}
+	if files, ok := dirFiles[file]; ok {
+		req := newGenerateTestRequest(cfg, rootDir, file, "")
+		req.Directory = file
+		job.requests, job.dirFiles = []GenerateTestRequest{req}, files
+		return job
+	}
+	targets := functions[filepath.ToSlash(relativeName)]
+	for _, fn := range targets {
+		if cfg.DedupeFunctions && seen[fn.ID] {
+			fmt.Printf("Skipping %s:%s: duplicate of already requested %s\n", relativeName, fn.Name, fn.ID)
+			job.duplicates++
+			continue
+		}
+		seen[fn.ID] = true
+		job.requests = append(job.requests, newGenerateTestRequest(cfg, rootDir, file, fn.Name))
+	}
+	if len(targets) == 0 {
+		job.requests = []GenerateTestRequest{newGenerateTestRequest(cfg, rootDir, file, "")}
+	}
+	return job
+}
+
+type fileOutcome struct {
+	fileJob
+	attempts []attempt
+}
+
+// filePool processes files on -concurrency workers. The caller dispatches
+// at most one job per worker and the results channel holds no more than
+// that, so a report writer that falls behind holds back generation rather
+// than letting finished work pile up in memory.
+type filePool struct {
+	ctx      context.Context
+	cfg      *Config
+	jobs     chan fileJob
+	results  chan fileOutcome
+	inFlight int
+
+	// Outcomes are handed back in dispatch order; ones that finish early
+	// wait here, bounded by the number of workers.
+	pending  map[int]fileOutcome
+	next     int
+	maxDepth int
+}
+
+func newFilePool(ctx context.Context, cfg *Config) *filePool {
+	p := &filePool{
+		ctx:     ctx,
+		cfg:     cfg,
+		jobs:    make(chan fileJob, cfg.Concurrency),
+		results: make(chan fileOutcome, cfg.Concurrency),
+		pending: make(map[int]fileOutcome),
+	}
+	for i := 0; i < cfg.Concurrency; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *filePool) work() {
+	for job := range p.jobs {
+		outcome := fileOutcome{fileJob: job, attempts: runFileJob(p.cfg, job)}
+		select {
+		case p.results <- outcome:
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+// Idle reports whether a worker is free for another job.
+func (p *filePool) Idle() bool {
+	return p.inFlight < p.cfg.Concurrency
+}
+
+func (p *filePool) Dispatch(job fileJob) {
+	p.inFlight++
+	p.jobs <- job
+}
+
+// Next waits for the outcome of the next file in dispatch order. It
+// returns false if the pool's context is cancelled first.
+func (p *filePool) Next() (fileOutcome, bool) {
+	for {
+		if outcome, ok := p.pending[p.next]; ok {
+			delete(p.pending, p.next)
+			p.next++
+			return outcome, true
+		}
+		if depth := len(p.results); depth > p.maxDepth {
+			p.maxDepth = depth
+		}
+		select {
+		case outcome := <-p.results:
+			p.inFlight--
+			p.pending[outcome.index] = outcome
+		case <-p.ctx.Done():
+			return fileOutcome{}, false
+		}
+	}
+}
+
+// MaxDepth is the most finished outcomes observed waiting to be written.
+func (p *filePool) MaxDepth() int {
+	return p.maxDepth
+}
+
+func (p *filePool) Close() {
+	close(p.jobs)
+}
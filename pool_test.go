@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestFilePoolSlowWriter checks that a writer that falls behind holds back
+// the workers instead of letting finished files pile up, and that outcomes
+// still come back in dispatch order.
+func TestFilePoolSlowWriter(t *testing.T) {
+	summary := StreamEvent{Fields: map[string]interface{}{"dataType": "summary", "coverageIncreased": "Coverage increased to 50%", "linesCovered": "5", "totalLines": "10", "testAdded": "1"}}
+	cfg := &Config{transport: fakeTransport{[]StreamEvent{coverageEvent("10%"), summary}}, Concurrency: 3}
+	pool := newFilePool(context.Background(), cfg)
+	defer pool.Close()
+
+	const files = 20
+	var order []int
+	write := func() {
+		outcome, _ := pool.Next()
+		order = append(order, outcome.index)
+		time.Sleep(5 * time.Millisecond)
+	}
+	for i := 0; i < files; i++ {
+		for !pool.Idle() {
+			write()
+		}
+		file := fmt.Sprintf("file%d.py", i)
+		pool.Dispatch(fileJob{index: i, file: file, relativeName: file, requests: []GenerateTestRequest{{SrcFilePath: file}}})
+	}
+	for len(order) < files {
+		write()
+	}
+
+	for i, index := range order {
+		if index != i {
+			t.Fatalf("outcomes came back in order %v", order)
+		}
+	}
+	if depth := pool.MaxDepth(); depth > cfg.Concurrency {
+		t.Errorf("%d outcomes waited to be written, want at most %d", depth, cfg.Concurrency)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"time"
+)
+
+// secretFlags are never printed in clear text.
+var secretFlags = []string{"api-token"}
+
+// printConfig writes the effective configuration, after the config file and
+// command line have been merged, as JSON.
+func printConfig(cfg *Config, profile LanguageProfile) error {
+	options := make(map[string]interface{})
+	cfg.flags.VisitAll(func(f *flag.Flag) {
+		if f.Name == "print-config" {
+			return
+		}
+		var value interface{} = f.Value.String()
+		if getter, ok := f.Value.(flag.Getter); ok {
+			value = getter.Get()
+		}
+		if d, ok := value.(time.Duration); ok {
+			value = d.String()
+		}
+		if contains(secretFlags, f.Name) && f.Value.String() != "" {
+			value = "<redacted>"
+		}
+		options[f.Name] = value
+	})
+
+	out := map[string]interface{}{
+		"options": options,
+		"fileSelection": map[string]interface{}{
+			"language":     profile.Name,
+			"extension":    profile.Extension,
+			"skipDirs":     profile.SkipDirs,
+			"skipFiles":    profile.SkipFiles,
+			"skipList":     cfg.SkipFile,
+			"testFiles":    profile.TestFiles,
+			"siblingTests": profile.TestFiles,
+		},
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestPrintConfig checks that -print-config shows the merged options with
+// typed values and never the API token.
+func TestPrintConfig(t *testing.T) {
+	cfg, err := parseConfig([]string{"-api-token", "secret", "-concurrency", "3", "-timeout", "90s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var printErr error
+	out := captureStdout(t, func() { printErr = printConfig(cfg, pythonProfile) })
+	if printErr != nil {
+		t.Fatal(printErr)
+	}
+	var printed struct {
+		Options       map[string]interface{} `json:"options"`
+		FileSelection map[string]interface{} `json:"fileSelection"`
+	}
+	if err := json.Unmarshal([]byte(out), &printed); err != nil {
+		t.Fatalf("%v in:\n%s", err, out)
+	}
+	for name, want := range map[string]interface{}{"api-token": "<redacted>", "concurrency": 3.0, "timeout": "1m30s", "strict": false} {
+		if got := printed.Options[name]; got != want {
+			t.Errorf("%s is %v, want %v", name, got, want)
+		}
+	}
+	if _, ok := printed.Options["print-config"]; ok {
+		t.Error("print-config itself is listed")
+	}
+	if got := printed.FileSelection["language"]; got != pythonProfile.Name {
+		t.Errorf("language is %v, want %s", got, pythonProfile.Name)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// ReportRow is one row of a previously written report, keyed by column key.
+type ReportRow map[string]string
+
+// readReport loads a report written by any of the exporters, picking the
+// format from the file extension.
+func readReport(path string) ([]ReportRow, error) {
+	_, rows, err := readReportTable(path)
+	return rows, err
+}
+
+// readReportTable also returns the report's column keys in column order.
+// Headers that match no known column are returned as-is.
+func readReportTable(path string) ([]string, []ReportRow, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".xlsx":
+		return readExcelReport(path)
+	case ".csv":
+		return readCSVReport(path)
+	case ".json", ".jsonl":
+		return readJSONReport(path)
+	}
+	return nil, nil, fmt.Errorf("unsupported report format %q", filepath.Ext(path))
+}
+
+func readExcelReport(path string) ([]string, []ReportRow, error) {
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open report: %w", err)
+	}
+	defer f.Close()
+
+	sheet := "Execution Log"
+	if idx, _ := f.GetSheetIndex(sheet); idx < 0 {
+		sheet = f.GetSheetName(0)
+	}
+	rows, err := f.GetRows(sheet, excelize.Options{RawCellValue: true})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read report sheet: %w", err)
+	}
+	return tableToRows(rows)
+}
+
+func readCSVReport(path string) ([]string, []ReportRow, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open report: %w", err)
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse CSV report: %w", err)
+	}
+	return tableToRows(records)
+}
+
+// tableToRows maps a header row of column headers onto column keys. The
+// header is the first row with a Filepath column, which need not come first
+// with -columns. Rows above it, such as a metadata block, are skipped.
+func tableToRows(table [][]string) ([]string, []ReportRow, error) {
+	headerRow := -1
+	for i, record := range table {
+		if contains(record, columnByKey("path").Header) {
+			headerRow = i
+			break
+		}
+	}
+	if headerRow < 0 {
+		return nil, nil, fmt.Errorf("report has no header row")
+	}
+	keys := make([]string, len(table[headerRow]))
+	for i, header := range table[headerRow] {
+		keys[i] = columnKeyForHeader(header)
+		if keys[i] == "" {
+			keys[i] = header
+		}
+	}
+
+	var rows []ReportRow
+	for _, record := range table[headerRow+1:] {
+		row := make(ReportRow, len(keys))
+		for i, value := range record {
+			if i < len(keys) {
+				row[keys[i]] = value
+			}
+		}
+		rows = append(rows, row)
+	}
+	return keys, rows, nil
+}
+
+func columnKeyForHeader(header string) string {
+	for _, c := range columns {
+		if c.Header == header {
+			return c.Key
+		}
+	}
+	return ""
+}
+
+// readJSONReport accepts both the array and the JSON lines form, with or
+// without report metadata and parse warnings.
+func readJSONReport(path string) ([]string, []ReportRow, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open report: %w", err)
+	}
+	defer f.Close()
+
+	var objects []map[string]interface{}
+	decoder := json.NewDecoder(f)
+	for decoder.More() {
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse JSON report: %w", err)
+		}
+		switch v := value.(type) {
+		case []interface{}:
+			for _, item := range v {
+				if obj, ok := item.(map[string]interface{}); ok {
+					objects = append(objects, obj)
+				}
+			}
+		case map[string]interface{}:
+			if _, ok := v["warning"]; ok {
+				continue
+			}
+			_, hasMetadata := v["metadata"]
+			if _, ok := v["rows"]; ok || hasMetadata {
+				rows, _ := v["rows"].([]interface{})
+				for _, item := range rows {
+					if obj, ok := item.(map[string]interface{}); ok {
+						objects = append(objects, obj)
+					}
+				}
+				continue
+			}
+			objects = append(objects, v)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var keys []string
+	rows := make([]ReportRow, 0, len(objects))
+	for _, obj := range objects {
+		row := make(ReportRow, len(obj))
+		for key, value := range obj {
+			row[key] = fmt.Sprint(value)
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return orderKeys(keys), rows, nil
+}
+
+// orderKeys sorts JSON object keys into report column order, with unknown
+// keys last.
+func orderKeys(keys []string) []string {
+	index := func(key string) int {
+		for i, c := range columns {
+			if c.Key == key {
+				return i
+			}
+		}
+		return len(columns)
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		a, b := index(keys[i]), index(keys[j])
+		if a != b {
+			return a < b
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// redactor replaces every path segment with a keyed hash so reports can be
+// shared without exposing the source layout. The same seed always yields the
+// same hashes, which lets redacted reports be correlated with each other.
+type redactor struct {
+	seed    []byte
+	mapping map[string]string
+}
+
+// newRedactor uses seed, or a random one when seed is empty, in which case
+// hashes are only stable within the run.
+func newRedactor(seed string) (*redactor, error) {
+	if seed == "" {
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("failed to generate redaction seed: %w", err)
+		}
+		seed = hex.EncodeToString(buf)
+	}
+	return &redactor{seed: []byte(seed), mapping: make(map[string]string)}, nil
+}
+
+// Redact hashes each segment of path, keeping the file extension.
+func (r *redactor) Redact(path string) string {
+	if path == "" {
+		return ""
+	}
+	slashed := filepath.ToSlash(path)
+	segments := strings.Split(slashed, "/")
+	for i, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." {
+			continue
+		}
+		ext := ""
+		if i == len(segments)-1 {
+			ext = filepath.Ext(segment)
+		}
+		mac := hmac.New(sha256.New, r.seed)
+		mac.Write([]byte(segment))
+		segments[i] = hex.EncodeToString(mac.Sum(nil))[:12] + ext
+	}
+	redacted := strings.Join(segments, "/")
+	r.mapping[redacted] = path
+	return redacted
+}
+
+// saveMapping writes the -redact-map, if paths were redacted.
+func (r *redactor) saveMapping(path string) {
+	if r == nil {
+		return
+	}
+	if err := r.WriteMapping(path); err != nil {
+		fmt.Println("Failed to write redaction map:", err)
+	} else {
+		fmt.Printf("Redaction map saved as %s (keep it private)\n", path)
+	}
+}
+
+// WriteMapping saves the redacted-to-original mapping for local reference.
+func (r *redactor) WriteMapping(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create redaction map: %w", err)
+	}
+	defer f.Close()
+
+	redacted := make([]string, 0, len(r.mapping))
+	for k := range r.mapping {
+		redacted = append(redacted, k)
+	}
+	sort.Strings(redacted)
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"Redacted", "Original"})
+	for _, k := range redacted {
+		w.Write([]string{k, r.mapping[k]})
+	}
+	w.Flush()
+	return w.Error()
+}
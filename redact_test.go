@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRedact checks that segments hash the same way under one seed, keep
+// the file extension, and are listed in the -redact-map.
+func TestRedact(t *testing.T) {
+	r, err := newRedactor("seed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := r.Redact("pkg/sub/a.py"), r.Redact("pkg/b.py")
+	aParts, bParts := strings.Split(a, "/"), strings.Split(b, "/")
+	if len(aParts) != 3 || aParts[0] != bParts[0] || !strings.HasSuffix(a, ".py") || strings.Contains(a, "pkg") {
+		t.Errorf("redacted pkg/sub/a.py as %s and pkg/b.py as %s", a, b)
+	}
+	other, _ := newRedactor("other seed")
+	if other.Redact("pkg/b.py") == b {
+		t.Error("a different seed gave the same hashes")
+	}
+
+	path := filepath.Join(t.TempDir(), "redact-map.csv")
+	if err := r.WriteMapping(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{a + ",pkg/sub/a.py", b + ",pkg/b.py"} {
+		if !strings.Contains(string(data), line) {
+			t.Errorf("redaction map lacks %q:\n%s", line, data)
+		}
+	}
+}
@@ -0,0 +1,685 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Result is the outcome of processing a single source file.
+type Result struct {
+	Root      string
+	Path      string
+	AbsPath   string
+	Function  string
+	Tags      []string
+	Metrics   Metrics
+	Duration  time.Duration
+	StartTime time.Time
+	EndTime   time.Time
+	Status    string
+
+	// MetExpected compares the final coverage with the request's expected
+	// coverage: yes, no or "no target".
+	MetExpected string
+
+	// ZeroRetried is set when an all-zero result was re-requested.
+	ZeroRetried bool
+
+	// MeasureOnly results carry only the initial coverage; the generation
+	// columns are left blank.
+	MeasureOnly bool
+
+	// ExcludedFromAggregate is set for files with an -aggregate-exclude-tags
+	// tag, which the summary keeps apart from the headline figures.
+	ExcludedFromAggregate bool
+
+	// Compare is the same file's result on the -compare-url server (B).
+	Compare *Result
+}
+
+// Column describes one report column shared by every exporter.
+type Column struct {
+	Key    string
+	Header string
+	Value  func(r Result) interface{}
+}
+
+var columns = []Column{
+	{"root", "Root", func(r Result) interface{} { return r.Root }},
+	{"path", "Filepath", func(r Result) interface{} { return r.Path }},
+	{"abs_path", "Absolute Path", func(r Result) interface{} { return r.AbsPath }},
+	{"function", "Function", func(r Result) interface{} { return r.Function }},
+	{"tags", "Tags", func(r Result) interface{} { return strings.Join(r.Tags, ",") }},
+	{"initial_coverage", "Initial Coverage", func(r Result) interface{} { return coverage(r, r.Metrics.InitialCoverage) }},
+	{"final_coverage", "Final Coverage", finalCoverage},
+	{"lines_covered", "Lines Covered", func(r Result) interface{} { return summarized(r, r.Metrics.LinesCovered) }},
+	{"total_lines", "Total Lines", func(r Result) interface{} { return summarized(r, r.Metrics.TotalLines) }},
+	{"tests_added", "Tests Added", testsAdded},
+	{"duration", "Time Duration", func(r Result) interface{} { return r.Duration.String() }},
+	{"start_time", "Start Time", func(r Result) interface{} { return r.StartTime.Format(time.RFC3339) }},
+	{"end_time", "End Time", func(r Result) interface{} { return r.EndTime.Format(time.RFC3339) }},
+	{"status", "Status", func(r Result) interface{} { return r.Status }},
+	{"met_expected", "Met Expected?", func(r Result) interface{} { return r.MetExpected }},
+	{"zero_retry", "Zero Retry", func(r Result) interface{} { return r.ZeroRetried }},
+	{"flaky", "Flaky", func(r Result) interface{} { return flakiness(r, r.Metrics.Flakiness.Flaky) }},
+	{"flaky_runs", "Flakiness Runs", func(r Result) interface{} { return flakiness(r, r.Metrics.Flakiness.Runs) }},
+	{"unit_coverage", "Unit Coverage", func(r Result) interface{} { return optionalCoverage(r, r.Metrics.UnitCoverage) }},
+	{"integration_coverage", "Integration Coverage", func(r Result) interface{} { return optionalCoverage(r, r.Metrics.IntegrationCoverage) }},
+	{"trajectory", "Coverage Trajectory", func(r Result) interface{} { return formatTrajectory(r.Metrics.Trajectory) }},
+	{"request_id", "Request ID", func(r Result) interface{} { return r.Metrics.RequestID }},
+	{"b_initial_coverage", "Initial Coverage (B)", func(r Result) interface{} {
+		return serverB(r, func(b Result) interface{} { return coverage(b, b.Metrics.InitialCoverage) })
+	}},
+	{"b_final_coverage", "Final Coverage (B)", func(r Result) interface{} { return serverB(r, finalCoverage) }},
+	{"b_tests_added", "Tests Added (B)", func(r Result) interface{} { return serverB(r, testsAdded) }},
+	{"b_duration", "Time Duration (B)", func(r Result) interface{} {
+		return serverB(r, func(b Result) interface{} { return b.Duration.String() })
+	}},
+	{"b_status", "Status (B)", func(r Result) interface{} {
+		if r.Compare == nil {
+			return ""
+		}
+		return r.Compare.Status
+	}},
+	{"delta_final_coverage", "Final Coverage B-A", func(r Result) interface{} { return deltaB(r, finalCoverage) }},
+	{"delta_tests_added", "Tests Added B-A", func(r Result) interface{} { return deltaB(r, testsAdded) }},
+	{"delta_duration", "Time Duration B-A", func(r Result) interface{} {
+		return serverB(r, func(b Result) interface{} { return (b.Duration - r.Duration).String() })
+	}},
+}
+
+// optionalCoverage blanks coverage the server did not report.
+func optionalCoverage(r Result, v *float64) interface{} {
+	if v == nil {
+		return ""
+	}
+	return coverage(r, *v)
+}
+
+// formatTrajectory writes the per-iteration coverage as "40,55,62".
+func formatTrajectory(trajectory []float64) string {
+	values := make([]string, len(trajectory))
+	for i, v := range trajectory {
+		values[i] = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return strings.Join(values, ",")
+}
+
+func finalCoverage(r Result) interface{} {
+	return generated(r, coverage(r, r.Metrics.FinalCoverage))
+}
+
+func testsAdded(r Result) interface{} {
+	return summarized(r, r.Metrics.TestAdded)
+}
+
+// serverB reads a value from the -compare-url result, blank when that
+// request failed.
+func serverB(r Result, v func(b Result) interface{}) interface{} {
+	if r.Compare == nil || r.Compare.Status == statusError {
+		return ""
+	}
+	return v(*r.Compare)
+}
+
+// deltaB is server B's value minus server A's, blank unless both have one.
+// Both are already rounded to -precision; rounding the difference drops
+// floating point noise.
+func deltaB(r Result, v func(r Result) interface{}) interface{} {
+	a, okA := v(r).(float64)
+	b, okB := serverB(r, v).(float64)
+	if !okA || !okB {
+		return ""
+	}
+	return roundTo(b-a, 6)
+}
+
+const (
+	statusOK      = "ok"
+	statusError   = "err"
+	statusNoLines = "no measurable lines"
+	statusStopped = "stopped at expected"
+
+	// statusIncomplete marks a stream that ended before its summary.
+	statusIncomplete = "incomplete"
+
+	// statusUnsupported marks files the server cannot generate tests for;
+	// they are neither failures nor part of the coverage figures.
+	statusUnsupported = "unsupported"
+)
+
+// resultStatus classifies a successfully streamed file. A file with no
+// measurable lines has meaningless coverage percentages.
+func resultStatus(m Metrics, measureOnly bool) string {
+	if m.StoppedEarly {
+		return statusStopped
+	}
+	if m.Incomplete {
+		return statusIncomplete
+	}
+	if !measureOnly && m.TotalLines == 0 {
+		return statusNoLines
+	}
+	return statusOK
+}
+
+const (
+	metYes      = "yes"
+	metNo       = "no"
+	metNoTarget = "no target"
+)
+
+// metExpected is blank for -measure-only and incomplete results, which have
+// no final coverage to compare.
+func metExpected(m Metrics, expected float64, measureOnly bool) string {
+	switch {
+	case expected <= 0:
+		return metNoTarget
+	case measureOnly, m.Incomplete:
+		return ""
+	case m.FinalCoverage >= expected:
+		return metYes
+	}
+	return metNo
+}
+
+// isRegression reports whether a result belongs in an -only-regressions
+// report: its coverage did not go up, or it missed its expected coverage.
+func isRegression(r Result) bool {
+	if r.Status != statusOK && r.Status != statusStopped {
+		return false
+	}
+	return r.Metrics.FinalCoverage <= r.Metrics.InitialCoverage || r.MetExpected == metNo
+}
+
+func columnByKey(key string) *Column {
+	for i := range columns {
+		if columns[i].Key == key {
+			return &columns[i]
+		}
+	}
+	return nil
+}
+
+// normalizePath applies -path-style to a relative path. "unix" uses forward
+// slashes whatever the OS, so reports from mixed platforms merge and compare
+// by path; "native" keeps the OS separator.
+func normalizePath(path, style string) string {
+	if style == "unix" {
+		return strings.ReplaceAll(path, `\`, "/")
+	}
+	return path
+}
+
+func allColumnKeys() []string {
+	keys := make([]string, len(columns))
+	for i, c := range columns {
+		keys[i] = c.Key
+	}
+	return keys
+}
+
+func columnIndex(cols []Column, key string) int {
+	for i, c := range cols {
+		if c.Key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// generated blanks values that only exist when tests were generated, and
+// were reported before the stream ended.
+func generated(r Result, v interface{}) interface{} {
+	if r.MeasureOnly || r.Status == statusIncomplete {
+		return ""
+	}
+	return v
+}
+
+// summarized blanks the counts that only the server's final summary carries.
+func summarized(r Result, v float64) interface{} {
+	if r.Status == statusStopped || r.Status == statusUnsupported {
+		return ""
+	}
+	return generated(r, v)
+}
+
+// flakiness blanks the flakiness columns unless the server reported on it.
+func flakiness(r Result, v interface{}) interface{} {
+	if !r.Metrics.Flakiness.Reported {
+		return ""
+	}
+	return v
+}
+
+// coverage blanks percentages for files without measurable lines or that
+// the server does not support, rather than reporting a misleading 0%.
+func coverage(r Result, v float64) interface{} {
+	if r.Status == statusNoLines || r.Status == statusUnsupported {
+		return ""
+	}
+	return v
+}
+
+// reportColumns returns the columns written for this run. The relative path
+// stays first as the primary key; the absolute path is opt-in.
+func reportColumns(cfg *Config) []Column {
+	if cfg.columns != nil {
+		return cfg.columns
+	}
+	var cols []Column
+	for _, c := range columns {
+		if c.Key == "root" && len(cfg.Roots) < 2 {
+			continue
+		}
+		if c.Key == "abs_path" && !cfg.AbsolutePaths {
+			continue
+		}
+		if c.Key == "zero_retry" && !cfg.RetryOnZero {
+			continue
+		}
+		if c.Key == "function" && !cfg.PerFunction {
+			continue
+		}
+		if c.Key == "tags" && cfg.TagsFile == "" {
+			continue
+		}
+		if (c.Key == "flaky" || c.Key == "flaky_runs") && !cfg.Flakiness {
+			continue
+		}
+		if c.Key == "trajectory" && !cfg.Trajectory {
+			continue
+		}
+		if c.Key == "request_id" && !cfg.RequestID {
+			continue
+		}
+		if (c.Key == "unit_coverage" || c.Key == "integration_coverage") && !cfg.CoverageByType {
+			continue
+		}
+		if (strings.HasPrefix(c.Key, "b_") || strings.HasPrefix(c.Key, "delta_")) && cfg.CompareURL == "" {
+			continue
+		}
+		cols = append(cols, c)
+	}
+	return cols
+}
+
+// rounded returns m with its coverage percentages rounded to precision
+// decimal places, so every report format shows the same values.
+func (m Metrics) rounded(precision int) Metrics {
+	m.InitialCoverage = roundTo(m.InitialCoverage, precision)
+	m.FinalCoverage = roundTo(m.FinalCoverage, precision)
+	m.UnitCoverage = roundOptional(m.UnitCoverage, precision)
+	m.IntegrationCoverage = roundOptional(m.IntegrationCoverage, precision)
+	if m.Trajectory != nil {
+		trajectory := make([]float64, len(m.Trajectory))
+		for i, v := range m.Trajectory {
+			trajectory[i] = roundTo(v, precision)
+		}
+		m.Trajectory = trajectory
+	}
+	return m
+}
+
+func roundOptional(v *float64, precision int) *float64 {
+	if v == nil {
+		return nil
+	}
+	rounded := roundTo(*v, precision)
+	return &rounded
+}
+
+func roundTo(v float64, precision int) float64 {
+	scale := math.Pow(10, float64(precision))
+	return math.Round(v*scale) / scale
+}
+
+func (m Metrics) allZero() bool {
+	return m.InitialCoverage == 0 && m.FinalCoverage == 0 && m.TestAdded == 0
+}
+
+// Delta is the coverage gained by generation, in percentage points.
+func (m Metrics) Delta() float64 {
+	return m.FinalCoverage - m.InitialCoverage
+}
+
+// resultOrders lists the -sort-by keys. Each orders the worst performers
+// first: smallest improvement, longest duration or lowest final coverage.
+// A nil order keeps discovery order.
+var resultOrders = map[string]func(a, b Result) bool{
+	"path":           nil,
+	"delta":          func(a, b Result) bool { return a.Metrics.Delta() < b.Metrics.Delta() },
+	"duration":       func(a, b Result) bool { return a.Duration > b.Duration },
+	"final-coverage": func(a, b Result) bool { return a.Metrics.FinalCoverage < b.Metrics.FinalCoverage },
+}
+
+func sortResults(results []Result, key string) {
+	less := resultOrders[key]
+	if less == nil {
+		return
+	}
+	sort.SliceStable(results, func(i, j int) bool { return less(results[i], results[j]) })
+}
+
+var formatExtensions = map[string]string{
+	"excel": ".xlsx",
+	"csv":   ".csv",
+	"json":  ".json",
+
+	"tidy-csv": "-tidy.csv",
+}
+
+// Exporter writes results to a report. Write is called once per file so
+// exporters can persist progress incrementally; Close finalizes the report.
+type Exporter interface {
+	Write(r Result) error
+	Close() error
+}
+
+func newExporter(format, path string, cfg *Config, meta ReportMetadata) (Exporter, error) {
+	cols := reportColumns(cfg)
+	switch format {
+	case "excel":
+		return newExcelExporter(path, cols, cfg.excelStyle, meta, cfg.Append)
+	case "csv":
+		return newCSVExporter(path, cols, cfg.Append)
+	case "tidy-csv":
+		return newTidyCSVExporter(path, cols, cfg.Append)
+	case "json":
+		if cfg.JSONLines {
+			return newJSONLinesExporter(path, cols, meta, cfg.Append)
+		}
+		return newJSONExporter(path, cols, meta, cfg.Append)
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// csvExporter writes parse warnings to a -warnings.csv file next to the
+// report, so the report itself stays a single table.
+type csvExporter struct {
+	cols       []Column
+	file       *os.File
+	writer     *csv.Writer
+	path       string
+	appendMode bool
+	warnings   [][]string
+}
+
+// newCSVExporter writes the header unless it is appending to a non-empty
+// report, whose header must then match the current columns.
+func newCSVExporter(path string, cols []Column, appendMode bool) (*csvExporter, error) {
+	headers := make([]string, len(cols))
+	for i, c := range cols {
+		headers[i] = c.Header
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	writeHeader := true
+	if appendMode {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		existing, err := readCSVHeader(path)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			if strings.Join(existing, ",") != strings.Join(headers, ",") {
+				return nil, fmt.Errorf("existing report %s has different columns; use a new -output", path)
+			}
+			writeHeader = false
+		}
+	}
+
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CSV report: %w", err)
+	}
+	e := &csvExporter{cols: cols, file: f, writer: csv.NewWriter(f), path: path, appendMode: appendMode}
+	if writeHeader {
+		e.writer.Write(headers)
+		e.writer.Flush()
+	}
+	return e, e.writer.Error()
+}
+
+// readCSVHeader returns the first record of an existing CSV file, or nil if
+// the file is missing or empty.
+func readCSVHeader(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open existing report: %w", err)
+	}
+	defer f.Close()
+	header, err := csv.NewReader(f).Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read existing report header: %w", err)
+	}
+	return header, nil
+}
+
+// Write appends a row and flushes it to disk immediately.
+func (e *csvExporter) Write(r Result) error {
+	record := make([]string, len(e.cols))
+	for i, c := range e.cols {
+		record[i] = fmt.Sprint(c.Value(r))
+	}
+	e.writer.Write(record)
+	e.writer.Flush()
+	e.warnings = append(e.warnings, warningRecords(r)...)
+	return e.writer.Error()
+}
+
+func (e *csvExporter) Close() error {
+	if err := e.file.Close(); err != nil {
+		return err
+	}
+	if len(e.warnings) == 0 {
+		return nil
+	}
+	path := strings.TrimSuffix(e.path, filepath.Ext(e.path)) + "-warnings.csv"
+	existing, err := readCSVHeader(path)
+	if err != nil || !e.appendMode {
+		existing = nil
+	}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if existing != nil {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create warnings report: %w", err)
+	}
+	w := csv.NewWriter(f)
+	if existing == nil {
+		w.Write(warningHeaders)
+	}
+	w.WriteAll(e.warnings)
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	fmt.Printf("%d parse warnings saved as %s\n", len(e.warnings), path)
+	return f.Close()
+}
+
+var warningHeaders = []string{"Filepath", "Field", "Raw Value"}
+
+// warningRecords lists a result's parse warnings as report rows.
+func warningRecords(r Result) [][]string {
+	name := r.Path
+	if r.Function != "" {
+		name += ":" + r.Function
+	}
+	var records [][]string
+	for _, w := range r.Metrics.Warnings {
+		records = append(records, []string{name, w.Field, w.Value})
+	}
+	return records
+}
+
+func warningToMap(record []string) map[string]string {
+	return map[string]string{"path": record[0], "field": record[1], "value": record[2]}
+}
+
+func resultToMap(r Result, cols []Column) map[string]interface{} {
+	m := make(map[string]interface{}, len(cols))
+	for _, c := range cols {
+		m[c.Key] = c.Value(r)
+	}
+	return m
+}
+
+// jsonExporter collects rows and writes them as a single array on Close.
+// With report metadata or parse warnings the array is wrapped as
+// {"metadata": ..., "rows": [...], "warnings": [...]}.
+type jsonExporter struct {
+	cols     []Column
+	path     string
+	meta     ReportMetadata
+	rows     []map[string]interface{}
+	warnings []map[string]string
+
+	// unsaved is set by rows written since the last autosave.
+	unsaved bool
+}
+
+// newJSONExporter keeps the rows of an existing report in append mode so
+// they are written back ahead of the new ones.
+func newJSONExporter(path string, cols []Column, meta ReportMetadata, appendMode bool) (*jsonExporter, error) {
+	e := &jsonExporter{path: path, cols: cols, meta: meta}
+	if !appendMode {
+		return e, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && len(bytes.TrimSpace(data)) == 0) {
+		return e, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read existing report: %w", err)
+	}
+	var wrapped struct {
+		Rows     []map[string]interface{} `json:"rows"`
+		Warnings []map[string]string      `json:"warnings"`
+	}
+	if err := json.Unmarshal(data, &e.rows); err != nil {
+		if err := json.Unmarshal(data, &wrapped); err != nil {
+			return nil, fmt.Errorf("failed to parse existing report %s: %w", path, err)
+		}
+		e.rows, e.warnings = wrapped.Rows, wrapped.Warnings
+	}
+	return e, nil
+}
+
+func (e *jsonExporter) Write(r Result) error {
+	e.unsaved = true
+	e.rows = append(e.rows, resultToMap(r, e.cols))
+	for _, record := range warningRecords(r) {
+		e.warnings = append(e.warnings, warningToMap(record))
+	}
+	return nil
+}
+
+func (e *jsonExporter) Close() error {
+	return e.save()
+}
+
+// Save writes the rows so far under -autosave-interval, replacing the
+// report atomically so an interrupted save keeps the previous one.
+func (e *jsonExporter) Save() error {
+	if !e.unsaved {
+		return nil
+	}
+	e.unsaved = false
+	return e.save()
+}
+
+func (e *jsonExporter) save() error {
+	rows := e.rows
+	if rows == nil {
+		rows = []map[string]interface{}{}
+	}
+	var report interface{} = rows
+	if e.meta.Enabled() || len(e.warnings) > 0 {
+		wrapped := map[string]interface{}{"rows": rows}
+		if e.meta.Enabled() {
+			wrapped["metadata"] = e.meta
+		}
+		if len(e.warnings) > 0 {
+			wrapped["warnings"] = e.warnings
+		}
+		report = wrapped
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON report: %w", err)
+	}
+	return writeFileAtomic(e.path, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// jsonLinesExporter writes one JSON object per line as each file finishes.
+// With report metadata the first line is {"metadata": ...}; parse warnings
+// follow their row as {"warning": ...} lines.
+type jsonLinesExporter struct {
+	cols    []Column
+	file    *os.File
+	encoder *json.Encoder
+}
+
+func newJSONLinesExporter(path string, cols []Column, meta ReportMetadata, appendMode bool) (*jsonLinesExporter, error) {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if appendMode {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JSON lines report: %w", err)
+	}
+	e := &jsonLinesExporter{cols: cols, file: f, encoder: json.NewEncoder(f)}
+	// Appended runs don't repeat the metadata line mid-file.
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		return e, nil
+	}
+	if meta.Enabled() {
+		if err := e.encoder.Encode(map[string]interface{}{"metadata": meta}); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+func (e *jsonLinesExporter) Write(r Result) error {
+	if err := e.encoder.Encode(resultToMap(r, e.cols)); err != nil {
+		return err
+	}
+	for _, record := range warningRecords(r) {
+		if err := e.encoder.Encode(map[string]interface{}{"warning": warningToMap(record)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *jsonLinesExporter) Close() error {
+	return e.file.Close()
+}
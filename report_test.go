@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// TestExportersPersistEachRow checks that the CSV and JSON lines reports
+// hold every written row before Close, so a crash keeps the finished files.
+func TestExportersPersistEachRow(t *testing.T) {
+	cols := []Column{*columnByKey("path"), *columnByKey("status")}
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "report.csv")
+	jsonlPath := filepath.Join(dir, "report.jsonl")
+	csvExporter, err := newCSVExporter(csvPath, cols, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer csvExporter.Close()
+	jsonlExporter, err := newJSONLinesExporter(jsonlPath, cols, ReportMetadata{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jsonlExporter.Close()
+
+	for _, e := range []Exporter{csvExporter, jsonlExporter} {
+		if err := e.Write(Result{Path: "a.py", Status: statusOK}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for path, want := range map[string]string{
+		csvPath:   "Filepath,Status\na.py,ok\n",
+		jsonlPath: `{"path":"a.py","status":"ok"}` + "\n",
+	} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.ReplaceAll(string(data), "\r\n", "\n"); got != want {
+			t.Errorf("%s before Close:\n%s\nwant:\n%s", filepath.Base(path), got, want)
+		}
+	}
+}
+
+// TestSortResults checks each -sort-by order puts the worst performer first
+// and keeps discovery order for ties.
+func TestSortResults(t *testing.T) {
+	results := []Result{
+		{Path: "a.py", Duration: time.Second, Metrics: Metrics{InitialCoverage: 10, FinalCoverage: 50}},
+		{Path: "b.py", Duration: 3 * time.Second, Metrics: Metrics{InitialCoverage: 40, FinalCoverage: 45}},
+		{Path: "c.py", Duration: 2 * time.Second, Metrics: Metrics{InitialCoverage: 30, FinalCoverage: 35}},
+	}
+	for key, want := range map[string]string{
+		"path":           "a.py b.py c.py",
+		"delta":          "b.py c.py a.py",
+		"duration":       "b.py c.py a.py",
+		"final-coverage": "c.py b.py a.py",
+	} {
+		sorted := append([]Result(nil), results...)
+		sortResults(sorted, key)
+		var paths []string
+		for _, r := range sorted {
+			paths = append(paths, r.Path)
+		}
+		if got := strings.Join(paths, " "); got != want {
+			t.Errorf("-sort-by %s: got %s, want %s", key, got, want)
+		}
+	}
+}
+
+// TestReportColumnsPaths checks that the relative path stays the first
+// column and that -absolute-paths adds the Absolute Path column after it.
+func TestReportColumnsPaths(t *testing.T) {
+	for _, tc := range []struct {
+		cfg  Config
+		want string
+	}{
+		{Config{}, "path initial_coverage"},
+		{Config{AbsolutePaths: true}, "path abs_path initial_coverage"},
+		{Config{AbsolutePaths: true, Roots: []string{"a", "b"}}, "root path abs_path initial_coverage"},
+	} {
+		var keys []string
+		for _, c := range reportColumns(&tc.cfg)[:len(strings.Fields(tc.want))] {
+			keys = append(keys, c.Key)
+		}
+		if got := strings.Join(keys, " "); got != tc.want {
+			t.Errorf("absolute paths %v, roots %v: columns start %s, want %s", tc.cfg.AbsolutePaths, tc.cfg.Roots, got, tc.want)
+		}
+	}
+}
+
+// TestMetricsRounded checks that -precision rounds every coverage value,
+// including the optional and per-iteration ones, and leaves counts alone.
+func TestMetricsRounded(t *testing.T) {
+	unit := 33.3333
+	m := Metrics{InitialCoverage: 12.345, FinalCoverage: 66.6666, LinesCovered: 7, UnitCoverage: &unit, Trajectory: []float64{12.345, 50.005}}
+	got := m.rounded(1)
+	if got.InitialCoverage != 12.3 || got.FinalCoverage != 66.7 || *got.UnitCoverage != 33.3 || got.IntegrationCoverage != nil || got.LinesCovered != 7 {
+		t.Errorf("got %+v", got)
+	}
+	if formatTrajectory(got.Trajectory) != "12.3,50" || m.Trajectory[0] != 12.345 || unit != 33.3333 {
+		t.Errorf("trajectory %v rounded to %v, or the original changed", m.Trajectory, got.Trajectory)
+	}
+	if got := m.rounded(0); got.FinalCoverage != 67 {
+		t.Errorf("precision 0: final coverage %v, want 67", got.FinalCoverage)
+	}
+}
+
+// TestWarningReports checks that each format lists parse warnings with the
+// file they came from: a Warnings sheet, a -warnings.csv file, or a
+// "warnings" array in the JSON report.
+func TestWarningReports(t *testing.T) {
+	dir := t.TempDir()
+	cols := []Column{*columnByKey("path")}
+	result := Result{Path: "a.py", Function: "parse", Metrics: Metrics{Warnings: []ParseWarning{{Field: "totalLines", Value: "n/a"}}}}
+	want := []string{"a.py:parse", "totalLines", "n/a"}
+
+	excelPath := filepath.Join(dir, "report.xlsx")
+	excelExporter, err := newExcelExporter(excelPath, cols, nil, ReportMetadata{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csvExporter, err := newCSVExporter(filepath.Join(dir, "report.csv"), cols, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonExporter, err := newJSONExporter(filepath.Join(dir, "report.json"), cols, ReportMetadata{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []Exporter{excelExporter, csvExporter, jsonExporter} {
+		if err := e.Write(result); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := excelize.OpenFile(excelPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if rows, _ := f.GetRows("Warnings"); len(rows) != 2 || strings.Join(rows[1], " ") != strings.Join(want, " ") {
+		t.Errorf("Warnings sheet: got %v", rows)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "report-warnings.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != "Filepath,Field,Raw Value\n"+strings.Join(want, ",")+"\n" {
+		t.Errorf("report-warnings.csv:\n%s", got)
+	}
+
+	data, err = os.ReadFile(filepath.Join(dir, "report.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report struct{ Warnings []map[string]string }
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Warnings) != 1 || report.Warnings[0]["path"] != want[0] || report.Warnings[0]["value"] != want[2] {
+		t.Errorf("JSON warnings: got %v", report.Warnings)
+	}
+}
+
+// TestIsRegression checks which results an -only-regressions report keeps.
+func TestIsRegression(t *testing.T) {
+	missed := result(statusOK, 40, 60, 10)
+	missed.MetExpected = metNo
+	for _, tc := range []struct {
+		name string
+		r    Result
+		want bool
+	}{
+		{"increased", result(statusOK, 40, 60, 10), false},
+		{"flat", result(statusOK, 50, 50, 10), true},
+		{"dropped", result(statusOK, 50, 45, 10), true},
+		{"below expected", missed, true},
+		{"stopped flat", result(statusStopped, 50, 50, 10), true},
+		{"failed", result(statusError, 0, 0, 0), false},
+	} {
+		if got := isRegression(tc.r); got != tc.want {
+			t.Errorf("%s: isRegression = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
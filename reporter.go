@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// reporter owns the exporters: one goroutine writes every row, in the order
+// results are sent, and finalizes the reports on Close. Nothing else touches
+// a writer, so reports stay consistent however many workers produce rows.
+type reporter struct {
+	results chan Result
+	done    chan struct{}
+}
+
+// newReporter takes over the exporters. Sends block until the previous row
+// is written, so a slow report holds back the caller rather than queueing.
+// With -autosave-interval the same goroutine also saves the reports on a
+// ticker, so saves never race with writes.
+func newReporter(cfg *Config, exporters []Exporter) *reporter {
+	r := &reporter{results: make(chan Result), done: make(chan struct{})}
+	go func() {
+		defer close(r.done)
+		var tick <-chan time.Time
+		if cfg.AutosaveInterval > 0 {
+			ticker := time.NewTicker(cfg.AutosaveInterval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for {
+			select {
+			case result, ok := <-r.results:
+				if !ok {
+					closeExporters(cfg, exporters)
+					return
+				}
+				writeResult(exporters, result)
+			case <-tick:
+				autosave(cfg, exporters)
+			}
+		}
+	}()
+	return r
+}
+
+// saver is implemented by exporters that keep rows in memory until Close.
+// Save persists the rows written so far.
+type saver interface {
+	Save() error
+}
+
+func autosave(cfg *Config, exporters []Exporter) {
+	for i, exporter := range exporters {
+		if s, ok := exporter.(saver); ok {
+			if err := s.Save(); err != nil {
+				fmt.Printf("Failed to autosave %s report: %v\n", cfg.Formats[i], err)
+			}
+		}
+	}
+}
+
+func (r *reporter) Write(result Result) {
+	r.results <- result
+}
+
+// Close waits for pending rows and finalizes every report.
+func (r *reporter) Close() {
+	close(r.results)
+	<-r.done
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingExporter keeps written paths without any locking of its own,
+// so go test -race flags writes that do not go through one goroutine.
+type recordingExporter struct {
+	paths  []string
+	closed bool
+}
+
+func (e *recordingExporter) Write(r Result) error {
+	e.paths = append(e.paths, r.Path)
+	return nil
+}
+
+func (e *recordingExporter) Close() error {
+	e.closed = true
+	return nil
+}
+
+// TestReporterConcurrentWrites checks that rows sent from several workers
+// are all written, each worker's in the order it sent them, and that Close
+// finalizes the report after the last row.
+func TestReporterConcurrentWrites(t *testing.T) {
+	e := &recordingExporter{}
+	reports := newReporter(&Config{Formats: []string{"csv"}}, []Exporter{e})
+	const workers, rows = 8, 25
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rows; i++ {
+				reports.Write(Result{Path: fmt.Sprintf("%d/%d", w, i)})
+			}
+		}(w)
+	}
+	wg.Wait()
+	reports.Close()
+
+	if len(e.paths) != workers*rows || !e.closed {
+		t.Fatalf("wrote %d rows, closed %v; want %d rows and closed", len(e.paths), e.closed, workers*rows)
+	}
+	next := make(map[int]int)
+	for _, path := range e.paths {
+		var w, i int
+		fmt.Sscanf(path, "%d/%d", &w, &i)
+		if i != next[w] {
+			t.Fatalf("worker %d's row %d written before row %d", w, i, next[w])
+		}
+		next[w]++
+	}
+}
+
+// TestReporterAutosave checks that -autosave-interval saves the JSON report
+// while the run is still going, and that Close writes the final rows.
+func TestReporterAutosave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.json")
+	cols := []Column{*columnByKey("path")}
+	e, err := newJSONExporter(path, cols, ReportMetadata{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{Formats: []string{"json"}, AutosaveInterval: 5 * time.Millisecond}
+	reports := newReporter(cfg, []Exporter{e})
+	reports.Write(Result{Path: "a.py"})
+
+	var rows []map[string]interface{}
+	for deadline := time.Now().Add(5 * time.Second); len(rows) == 0; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			reports.Close()
+			t.Fatal("report not autosaved before Close")
+		}
+		if data, err := os.ReadFile(path); err == nil {
+			json.Unmarshal(data, &rows)
+		}
+	}
+	if len(rows) != 1 || rows[0]["path"] != "a.py" {
+		t.Errorf("autosaved rows %v, want a.py", rows)
+	}
+
+	reports.Write(Result{Path: "b.py"})
+	reports.Close()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows = nil
+	if err := json.Unmarshal(data, &rows); err != nil || len(rows) != 2 {
+		t.Errorf("final report %s, want 2 rows", data)
+	}
+}
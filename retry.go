@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+var (
+	errRetryCountExhausted  = errors.New("retry count exhausted")
+	errRetryBudgetExhausted = errors.New("retry budget exhausted")
+)
+
+// retryClock is the time source of the retry loop, so the self-test can
+// check backoff sequences without sleeping.
+type retryClock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time        { return time.Now() }
+func (realClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// exponentialBackoff doubles the delay after each retry. With jitter each
+// delay is drawn from the upper half of the current backoff, so workers
+// that failed together don't retry in lockstep.
+type exponentialBackoff struct {
+	delay  time.Duration
+	jitter bool
+}
+
+func (b *exponentialBackoff) Next() time.Duration {
+	delay := b.delay
+	b.delay *= 2
+	if b.jitter && delay > 1 {
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	}
+	return delay
+}
+
+// sendRequest streams metrics for a file, retrying failed attempts until
+// either -retries attempts have been made or the time spent retrying would
+// exceed -retry-budget, whichever comes first. A limit of 0 leaves it out,
+// so a budget alone retries until it runs out. The returned error wraps the
+// limit that was hit. Files the server does not support and -strict schema
+// mismatches are not retried, nor are streams cut off by -max-events, which
+// keep their partial metrics.
+func sendRequest(cfg *Config, requestBody GenerateTestRequest) (Metrics, error) {
+	var retryStart time.Time
+	backoff := &exponentialBackoff{delay: cfg.RetryBackoff, jitter: cfg.RetryJitter}
+	for attempt := 1; ; attempt++ {
+		metrics, err := streamMetrics(cfg, requestBody)
+		if err == nil {
+			return metrics, nil
+		}
+		if errors.Is(err, errTooManyEvents) {
+			return metrics, err
+		}
+		if cfg.Retries == 0 && cfg.RetryBudget == 0 || errors.Is(err, errUnsupported) || errors.Is(err, errSchemaMismatch) {
+			return Metrics{}, err
+		}
+		if cfg.Retries > 0 && attempt > cfg.Retries {
+			return Metrics{}, fmt.Errorf("%w after %d attempts: %w", errRetryCountExhausted, attempt, err)
+		}
+		if retryStart.IsZero() {
+			retryStart = cfg.clock.Now()
+		}
+		delay := backoff.Next()
+		if cfg.RetryBudget > 0 && cfg.clock.Now().Sub(retryStart)+delay > cfg.RetryBudget {
+			return Metrics{}, fmt.Errorf("%w (%s) after %d attempts: %w", errRetryBudgetExhausted, cfg.RetryBudget, attempt, err)
+		}
+
+		fmt.Printf("Attempt %d for %s failed: %v\nRetrying in %s\n", attempt, requestBody.SrcFilePath, err, delay)
+		cfg.clock.Sleep(delay)
+	}
+}
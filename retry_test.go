@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// countingTransport fails every stream, counting the attempts.
+type countingTransport struct {
+	err      error
+	attempts *int
+}
+
+func (t countingTransport) Stream(ctx context.Context, req GenerateTestRequest) (<-chan StreamEvent, error) {
+	*t.attempts++
+	return fakeTransport{[]StreamEvent{{Err: t.err}}}.Stream(ctx, req)
+}
+
+func newRetryConfig() (*Config, *fakeClock, *int) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	attempts := new(int)
+	cfg := &Config{
+		transport:    countingTransport{errors.New("connection refused"), attempts},
+		clock:        clock,
+		Retries:      3,
+		RetryBackoff: time.Second,
+	}
+	return cfg, clock, attempts
+}
+
+func TestSendRequestRetries(t *testing.T) {
+	cfg, clock, attempts := newRetryConfig()
+	_, err := sendRequest(cfg, GenerateTestRequest{SrcFilePath: "fake.py"})
+	if !errors.Is(err, errRetryCountExhausted) {
+		t.Errorf("got error %v, want %v", err, errRetryCountExhausted)
+	}
+	if *attempts != 4 {
+		t.Errorf("made %d attempts, want 4", *attempts)
+	}
+	if got := fmt.Sprint(clock.slept); got != "[1s 2s 4s]" {
+		t.Errorf("slept %s, want [1s 2s 4s]", got)
+	}
+}
+
+func TestSendRequestNoRetries(t *testing.T) {
+	cfg, clock, attempts := newRetryConfig()
+	cfg.Retries = 0
+	if _, err := sendRequest(cfg, GenerateTestRequest{SrcFilePath: "fake.py"}); err == nil || errors.Is(err, errRetryCountExhausted) {
+		t.Errorf("got error %v", err)
+	}
+	if *attempts != 1 || len(clock.slept) != 0 {
+		t.Errorf("made %d attempts and slept %v, want 1 attempt", *attempts, clock.slept)
+	}
+}
+
+func TestSendRequestRetryBudget(t *testing.T) {
+	cfg, clock, attempts := newRetryConfig()
+	cfg.RetryBudget = 2500 * time.Millisecond
+	if _, err := sendRequest(cfg, GenerateTestRequest{SrcFilePath: "fake.py"}); !errors.Is(err, errRetryBudgetExhausted) {
+		t.Errorf("got error %v, want %v", err, errRetryBudgetExhausted)
+	}
+	if got := fmt.Sprint(clock.slept); got != "[1s]" || *attempts != 2 {
+		t.Errorf("made %d attempts and slept %s, want 2 attempts and [1s]", *attempts, got)
+	}
+}
+
+func TestSendRequestRetryJitter(t *testing.T) {
+	cfg, clock, _ := newRetryConfig()
+	cfg.RetryJitter = true
+	sendRequest(cfg, GenerateTestRequest{SrcFilePath: "fake.py"})
+	if len(clock.slept) != 3 {
+		t.Fatalf("slept %d times, want 3", len(clock.slept))
+	}
+	step := time.Second
+	for _, d := range clock.slept {
+		if d < step/2 || d > step {
+			t.Errorf("slept %s for a %s backoff", d, step)
+		}
+		step *= 2
+	}
+}
+
+// TestSendRequestRetryBudgetOnly checks that a budget without a retry count
+// retries until the budget runs out.
+func TestSendRequestRetryBudgetOnly(t *testing.T) {
+	cfg, clock, attempts := newRetryConfig()
+	cfg.Retries = 0
+	cfg.RetryBudget = 10 * time.Second
+	if _, err := sendRequest(cfg, GenerateTestRequest{SrcFilePath: "fake.py"}); !errors.Is(err, errRetryBudgetExhausted) {
+		t.Errorf("got error %v, want %v", err, errRetryBudgetExhausted)
+	}
+	if got := fmt.Sprint(clock.slept); got != "[1s 2s 4s]" || *attempts != 4 {
+		t.Errorf("made %d attempts and slept %s, want 4 attempts and [1s 2s 4s]", *attempts, got)
+	}
+}
+
+func TestSendRequestSchemaMismatch(t *testing.T) {
+	cfg, clock, _ := newRetryConfig()
+	serverInfo := StreamEvent{Fields: map[string]interface{}{"dataType": "serverInfo", "schemaVersion": "2"}}
+	cfg.transport = fakeTransport{[]StreamEvent{serverInfo, coverageEvent("10%")}}
+	cfg.Strict = true
+	if _, err := sendRequest(cfg, GenerateTestRequest{SrcFilePath: "fake.py"}); !errors.Is(err, errSchemaMismatch) || errors.Is(err, errRetryCountExhausted) {
+		t.Errorf("got error %v, want %v without retries", err, errSchemaMismatch)
+	}
+	if len(clock.slept) != 0 {
+		t.Errorf("slept %v before failing", clock.slept)
+	}
+}
+
+// replayTransport answers the n'th request with the n'th stream, repeating
+// the last one.
+type replayTransport struct {
+	streams  [][]StreamEvent
+	requests *int
+}
+
+func (t replayTransport) Stream(ctx context.Context, req GenerateTestRequest) (<-chan StreamEvent, error) {
+	stream := t.streams[min(*t.requests, len(t.streams)-1)]
+	*t.requests++
+	return fakeTransport{stream}.Stream(ctx, req)
+}
+
+func TestRetryOnZero(t *testing.T) {
+	zero := []StreamEvent{coverageEvent("0%"), {Fields: map[string]interface{}{"dataType": "summary", "coverageIncreased": "Coverage did not increase", "totalLines": "10", "testAdded": "0"}}}
+	real := []StreamEvent{coverageEvent("20%"), {Fields: map[string]interface{}{"dataType": "summary", "coverageIncreased": "Coverage increased from 20% to 60%", "totalLines": "10", "testAdded": "2"}}}
+	for _, tc := range []struct {
+		name         string
+		retryOnZero  bool
+		streams      [][]StreamEvent
+		wantRequests int
+		wantFinal    float64
+	}{
+		{"zero then real", true, [][]StreamEvent{zero, real}, 2, 60},
+		{"real", true, [][]StreamEvent{real}, 1, 60},
+		{"zero twice", true, [][]StreamEvent{zero}, 2, 0},
+		{"disabled", false, [][]StreamEvent{zero, real}, 1, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			requests := new(int)
+			cfg := &Config{transport: replayTransport{tc.streams, requests}, RetryOnZero: tc.retryOnZero}
+			a := measureAttempt(cfg, GenerateTestRequest{SrcFilePath: "fake.py"})
+			if a.err != nil {
+				t.Fatal(a.err)
+			}
+			if *requests != tc.wantRequests || a.zeroRetried != (tc.wantRequests == 2) || a.metrics.FinalCoverage != tc.wantFinal {
+				t.Errorf("got %d requests, zero retried %v, final coverage %v; want %d requests and %v",
+					*requests, a.zeroRetried, a.metrics.FinalCoverage, tc.wantRequests, tc.wantFinal)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sourceRoot is one directory scanned for source files. label is the root
+// as given on the command line, used for the Root report column.
+type sourceRoot struct {
+	dir   string
+	label string
+}
+
+// listFlag collects a flag that may be repeated or given comma-separated.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// resolveRoots turns the -root values into absolute directories, defaulting
+// to the working directory. Repeated roots and roots inside another root are
+// dropped so no file is processed twice.
+func resolveRoots(paths []string) ([]sourceRoot, error) {
+	if len(paths) == 0 {
+		dir, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		return []sourceRoot{{dir: dir, label: "."}}, nil
+	}
+
+	var roots []sourceRoot
+	for _, p := range paths {
+		dir, err := filepath.Abs(p)
+		if err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(dir)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -root: %w", err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("invalid -root: %s is not a directory", p)
+		}
+		roots = append(roots, sourceRoot{dir: dir, label: filepath.ToSlash(filepath.Clean(p))})
+	}
+
+	var kept []sourceRoot
+	for i, root := range roots {
+		if outer, ok := enclosingRoot(roots, i); ok {
+			fmt.Printf("Skipping root %s: covered by root %s\n", root.label, outer.label)
+			continue
+		}
+		kept = append(kept, root)
+	}
+	return kept, nil
+}
+
+// basePath returns file relative to the -path-base directory, or false when
+// the file lies outside it.
+func basePath(base, file string) (string, bool) {
+	rel, err := filepath.Rel(base, file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// checkPathBase warns about every file outside -path-base.
+func checkPathBase(base string, files []string) {
+	for _, file := range files {
+		if _, ok := basePath(base, file); !ok {
+			fmt.Printf("Warning: %s is outside -path-base %s; its report path stays relative to its root\n", file, base)
+		}
+	}
+}
+
+// enclosingRoot finds a root other than roots[i] that contains it. Of two
+// identical roots the first one is kept.
+func enclosingRoot(roots []sourceRoot, i int) (sourceRoot, bool) {
+	for j, other := range roots {
+		if j == i {
+			continue
+		}
+		if other.dir == roots[i].dir {
+			if j < i {
+				return other, true
+			}
+			continue
+		}
+		if rel, err := filepath.Rel(other.dir, roots[i].dir); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return other, true
+		}
+	}
+	return sourceRoot{}, false
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestResolveRoots checks that repeated -root values and roots inside
+// another root are dropped, so no file is processed twice.
+func TestResolveRoots(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"a/sub", "b", "ab"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var paths listFlag
+	for _, value := range []string{filepath.Join(dir, "a") + "," + filepath.Join(dir, "b"), filepath.Join(dir, "a", "sub"), filepath.Join(dir, "a"), filepath.Join(dir, "ab")} {
+		paths.Set(value)
+	}
+	roots, err := resolveRoots(paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kept []string
+	for _, root := range roots {
+		rel, _ := filepath.Rel(dir, root.dir)
+		kept = append(kept, filepath.ToSlash(rel))
+	}
+	if got := strings.Join(kept, " "); got != "a b ab" {
+		t.Errorf("kept roots %s, want a b ab", got)
+	}
+
+	if _, err := resolveRoots([]string{filepath.Join(dir, "missing")}); err == nil {
+		t.Error("missing root accepted")
+	}
+}
+
+// TestBasePath checks paths are made relative to -path-base only for files
+// inside it.
+func TestBasePath(t *testing.T) {
+	base := filepath.Join(string(filepath.Separator), "repo")
+	for file, want := range map[string]string{
+		filepath.Join(base, "svc", "a.py"):                              filepath.Join("svc", "a.py"),
+		filepath.Join(base, "..", "other", "b.py"):                      "",
+		filepath.Join(string(filepath.Separator), "repository", "c.py"): "",
+		filepath.Join(base, "..foo", "d.py"):                            filepath.Join("..foo", "d.py"),
+	} {
+		got, ok := basePath(base, file)
+		if got != want || ok != (want != "") {
+			t.Errorf("basePath(%s) = %q, %v; want %q", file, got, ok, want)
+		}
+	}
+}
@@ -0,0 +1,650 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc"
+)
+
+// selfTestFiles maps each fake source file to the events the mock server
+// streams for it and the report values those events must produce. With a
+// chunk size the stream is flushed in pieces that split events mid-object,
+// as some servers' chunked transfer encoding does. With logLines the HTTP
+// server writes plain-text log lines between the events.
+var selfTestFiles = []struct {
+	path      string
+	chunkSize int
+	logLines  bool
+	events    []map[string]string
+	expected  map[string]string
+}{
+	{
+		path: "app.py",
+		events: []map[string]string{
+			{"dataType": "calculatedCoverage", "calculatedCoverage": "Current coverage is 40%"},
+			{"dataType": "summary", "coverageIncreased": "Coverage increased from 40% to 75%", "linesCovered": "15", "totalLines": "20", "testAdded": "2"},
+		},
+		expected: map[string]string{"initial_coverage": "40", "final_coverage": "75", "lines_covered": "15", "total_lines": "20", "tests_added": "2", "status": statusOK},
+	},
+	{
+		path: "pkg/util.py",
+		events: []map[string]string{
+			{"dataType": "calculatedCoverage", "calculatedCoverage": "Current coverage is 12.5%"},
+			{"dataType": "summary", "coverageIncreased": "Coverage did not increase", "linesCovered": "1", "totalLines": "8", "testAdded": "0"},
+		},
+		expected: map[string]string{"initial_coverage": "12.5", "final_coverage": "12.5", "lines_covered": "1", "total_lines": "8", "tests_added": "0", "status": statusOK},
+	},
+	{
+		path:      "pkg/chunked.py",
+		chunkSize: 7,
+		events: []map[string]string{
+			{"dataType": "calculatedCoverage", "calculatedCoverage": "Current coverage is 20%"},
+			{"dataType": "summary", "coverageIncreased": "Coverage increased from 20% to 60%", "linesCovered": "6", "totalLines": "10", "testAdded": "4"},
+		},
+		expected: map[string]string{"initial_coverage": "20", "final_coverage": "60", "lines_covered": "6", "total_lines": "10", "tests_added": "4", "status": statusOK},
+	},
+	{
+		path:      "pkg/noisy.py",
+		chunkSize: 5,
+		logLines:  true,
+		events: []map[string]string{
+			{"dataType": "calculatedCoverage", "calculatedCoverage": "Current coverage is 30%"},
+			{"dataType": "summary", "coverageIncreased": "Coverage increased from 30% to 90%", "linesCovered": "9", "totalLines": "10", "testAdded": "3"},
+		},
+		expected: map[string]string{"initial_coverage": "30", "final_coverage": "90", "lines_covered": "9", "total_lines": "10", "tests_added": "3", "status": statusOK},
+	},
+}
+
+// runSelfTest runs the whole pipeline in a temporary project against
+// in-process mock servers, once per transport, and checks every report
+// format it writes. Runs use several workers, so a build with -race also
+// checks the pipeline for data races.
+func runSelfTest() int {
+	dir, err := os.MkdirTemp("", "metrics-self-test")
+	if err != nil {
+		fmt.Println("Self-test failed:", err)
+		return exitFatal
+	}
+	defer os.RemoveAll(dir)
+
+	if err := selfTest(dir); err != nil {
+		fmt.Println("Self-test failed:", err)
+		return exitFatal
+	}
+	fmt.Println("Self-test passed")
+	return exitOK
+}
+
+func selfTest(dir string) error {
+	if err := selfTestParsing(); err != nil {
+		return fmt.Errorf("parsing: %w", err)
+	}
+	if err := selfTestProfiles(); err != nil {
+		return fmt.Errorf("language profiles: %w", err)
+	}
+	if err := selfTestAccumulation(); err != nil {
+		return fmt.Errorf("fake transport: %w", err)
+	}
+
+	if err := selfTestRetries(); err != nil {
+		return fmt.Errorf("retries: %w", err)
+	}
+	if err := selfTestPanicRecovery(); err != nil {
+		return fmt.Errorf("panic recovery: %w", err)
+	}
+	if err := selfTestExcelLayout(dir); err != nil {
+		return fmt.Errorf("excel layout: %w", err)
+	}
+
+	project := filepath.Join(dir, "project")
+	for _, f := range selfTestFiles {
+		file := filepath.Join(project, filepath.FromSlash(f.path))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(file, []byte("def f():\n    return 1\n"), 0644); err != nil {
+			return err
+		}
+	}
+
+	servers, stop, err := startSelfTestServers(project)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	for _, server := range servers {
+		if err := selfTestRun(dir, project, server.transport, server.url); err != nil {
+			return fmt.Errorf("%s transport: %w", server.transport, err)
+		}
+	}
+	return nil
+}
+
+type selfTestServer struct {
+	transport, url string
+}
+
+// startSelfTestServers starts a mock server per transport that streams the
+// events of selfTestFiles for their files under project.
+func startSelfTestServers(project string) ([]selfTestServer, func(), error) {
+	// fileEvents finds the fake file a request is for.
+	fileEvents := func(path string) (int, bool, []map[string]string, bool) {
+		for _, f := range selfTestFiles {
+			if filepath.ToSlash(path) == filepath.ToSlash(filepath.Join(project, f.path)) {
+				return f.chunkSize, f.logLines, f.events, true
+			}
+		}
+		return 0, false, nil, false
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req GenerateTestRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		chunkSize, logLines, events, ok := fileEvents(req.SrcFilePath)
+		if !ok {
+			http.Error(w, "unknown file "+req.SrcFilePath, http.StatusNotFound)
+			return
+		}
+		var stream bytes.Buffer
+		encoder := json.NewEncoder(&stream)
+		for i, event := range events {
+			if logLines {
+				fmt.Fprintf(&stream, "[INFO] generating tests, step %d {\"not\": an event\n", i+1)
+			}
+			encoder.Encode(event)
+		}
+		if logLines {
+			stream.WriteString("done\n")
+		}
+		writeChunked(w, stream.Bytes(), chunkSize)
+	}))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		server.Close()
+		return nil, nil, err
+	}
+	grpcServer := grpc.NewServer(grpc.ForceServerCodec(protoCodec{}), grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+		var req GenerateTestRequest
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		_, _, events, ok := fileEvents(req.SrcFilePath)
+		if !ok {
+			return fmt.Errorf("unknown file %s", req.SrcFilePath)
+		}
+		for _, event := range events {
+			fields := make(map[string]interface{}, len(event))
+			for key, value := range event {
+				fields[key] = value
+			}
+			if err := stream.SendMsg(&StreamEvent{Fields: fields}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	go grpcServer.Serve(listener)
+
+	wsServer := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		var req GenerateTestRequest
+		if err := websocket.JSON.Receive(ws, &req); err != nil {
+			return
+		}
+		_, _, events, _ := fileEvents(req.SrcFilePath)
+		for _, event := range events {
+			if err := websocket.JSON.Send(ws, event); err != nil {
+				return
+			}
+		}
+	}))
+
+	servers := []selfTestServer{
+		{"http", server.URL},
+		{"grpc", "http://" + listener.Addr().String()},
+		{"websocket", wsServer.URL},
+	}
+	stop := func() {
+		server.Close()
+		grpcServer.Stop()
+		wsServer.Close()
+	}
+	return servers, stop, nil
+}
+
+// selfTestRun runs the pipeline over one transport and checks its reports.
+func selfTestRun(dir, project, transport, url string) error {
+	output := filepath.Join(dir, "report-"+transport+".xlsx")
+	code := run([]string{"-root", project, "-api-url", url, "-transport", transport, "-format", "excel,csv,json", "-output", output, "-concurrency", "2"})
+	if code != exitOK {
+		return fmt.Errorf("pipeline exited with code %d", code)
+	}
+
+	for _, ext := range []string{".xlsx", ".csv", ".json"} {
+		report := strings.TrimSuffix(output, ".xlsx") + ext
+		if err := checkSelfTestReport(report); err != nil {
+			return fmt.Errorf("%s report: %w", ext, err)
+		}
+	}
+	return nil
+}
+
+// fakeClock advances only when the retry loop sleeps, recording each delay.
+type fakeClock struct {
+	now   time.Time
+	slept []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.slept = append(c.slept, d)
+	c.now = c.now.Add(d)
+}
+
+// selfTestRetries checks the backoff sequence, the -retries and
+// -retry-budget limits and the -retry-jitter range against a transport
+// that always fails.
+func selfTestRetries() error {
+	failure := errors.New("connection refused")
+	req := GenerateTestRequest{SrcFilePath: "fake.py"}
+	newConfig := func() (*Config, *fakeClock) {
+		clock := &fakeClock{now: time.Unix(0, 0)}
+		return &Config{transport: fakeTransport{[]StreamEvent{{Err: failure}}}, clock: clock, Retries: 3, RetryBackoff: time.Second}, clock
+	}
+
+	cfg, clock := newConfig()
+	if _, err := sendRequest(cfg, req); !errors.Is(err, errRetryCountExhausted) || !errors.Is(err, failure) {
+		return fmt.Errorf("-retries 3: got error %v", err)
+	}
+	if got := fmt.Sprint(clock.slept); got != "[1s 2s 4s]" {
+		return fmt.Errorf("-retries 3: slept %s, want [1s 2s 4s]", got)
+	}
+
+	cfg, clock = newConfig()
+	cfg.RetryBudget = 2500 * time.Millisecond
+	if _, err := sendRequest(cfg, req); !errors.Is(err, errRetryBudgetExhausted) {
+		return fmt.Errorf("-retry-budget: got error %v", err)
+	}
+	if got := fmt.Sprint(clock.slept); got != "[1s]" {
+		return fmt.Errorf("-retry-budget: slept %s, want [1s]", got)
+	}
+
+	cfg, clock = newConfig()
+	cfg.RetryJitter = true
+	sendRequest(cfg, req)
+	step := time.Second
+	for _, d := range clock.slept {
+		if d < step/2 || d > step {
+			return fmt.Errorf("-retry-jitter: slept %s for a %s backoff", d, step)
+		}
+		step *= 2
+	}
+	if len(clock.slept) != 3 {
+		return fmt.Errorf("-retry-jitter: slept %d times, want 3", len(clock.slept))
+	}
+	return nil
+}
+
+// panickingTransport stands in for a parsing bug: it panics on the events
+// of one file and replays fixed events for the others.
+type panickingTransport struct {
+	fakeTransport
+	file string
+}
+
+func (t panickingTransport) Stream(ctx context.Context, req GenerateTestRequest) (<-chan StreamEvent, error) {
+	if req.SrcFilePath == t.file {
+		var event map[string]interface{}
+		event["dataType"] = "summary"
+	}
+	return t.fakeTransport.Stream(ctx, req)
+}
+
+// selfTestPanicRecovery checks that under -keep-going-after-panic a panic
+// fails only its own file and the file's other requests still complete.
+func selfTestPanicRecovery() error {
+	summary := StreamEvent{Fields: map[string]interface{}{"dataType": "summary", "coverageIncreased": "Coverage increased to 50%", "linesCovered": "5", "totalLines": "10", "testAdded": "1"}}
+	cfg := &Config{
+		transport:           panickingTransport{fakeTransport{[]StreamEvent{coverageEvent("10%"), summary}}, "bad.py"},
+		KeepGoingAfterPanic: true,
+		FunctionConcurrency: 2,
+	}
+	attempts := runRequests(cfg, []GenerateTestRequest{{SrcFilePath: "bad.py"}, {SrcFilePath: "good.py"}})
+	if !errors.Is(attempts[0].err, errPanic) {
+		return fmt.Errorf("panicking file: got error %v", attempts[0].err)
+	}
+	if attempts[1].err != nil || attempts[1].metrics.FinalCoverage != 50 {
+		return fmt.Errorf("other file: got %+v, error %v", attempts[1].metrics, attempts[1].err)
+	}
+	return nil
+}
+
+// selfTestExcelLayout writes a workbook with a metadata block, then appends
+// to it, and checks that the header and every data row land below the
+// block without overwriting it.
+func selfTestExcelLayout(dir string) error {
+	path := filepath.Join(dir, "layout.xlsx")
+	cols := []Column{*columnByKey("path"), *columnByKey("status")}
+	meta := ReportMetadata{Title: "Layout", Note: "metadata block"}
+	for i, name := range []string{"first.py", "second.py"} {
+		e, err := newExcelExporter(path, cols, nil, meta, i > 0)
+		if err != nil {
+			return err
+		}
+		if err := e.Write(Result{Path: name, Status: statusOK}); err != nil {
+			return err
+		}
+		if err := e.Close(); err != nil {
+			return err
+		}
+	}
+
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	headerRow := len(meta.Rows()) + 2
+	for cell, want := range map[string]string{
+		"A1":                            "Title",
+		"B2":                            "metadata block",
+		fmt.Sprintf("A%d", headerRow):   columnByKey("path").Header,
+		fmt.Sprintf("A%d", headerRow+1): "first.py",
+		fmt.Sprintf("A%d", headerRow+2): "second.py",
+	} {
+		if got, _ := f.GetCellValue("Execution Log", cell); got != want {
+			return fmt.Errorf("cell %s is %q, want %q", cell, got, want)
+		}
+	}
+	return nil
+}
+
+// selfTestMetrics are event field values in formats servers have been seen
+// to send, with the number each must parse to.
+var selfTestMetrics = []struct {
+	field, value string
+	want         float64
+}{
+	{"linesCovered", "covered 1,234 of 2,000 lines", 1234},
+	{"totalLines", "covered 1,234 of 2,000 lines", 2000},
+	{"totalLines", "1,234,567 lines", 1234567},
+	{"totalLines", "12,34 lines", 34},
+	{"calculatedCoverage", "Current coverage is 87.5 %", 87.5},
+	{"calculatedCoverage", "Current coverage is 87.5\u00a0%", 87.5},
+	{"calculatedCoverage", "Coverage: 1,000.5%", 1000.5},
+	{"coverageIncreased", "Coverage increased from 40 % to 72.25 %", 72.25},
+	{"coverageIncreased", "Coverage increased from 40% to 72%", 72},
+	{"testAdded", "1,024 new tests", 1024},
+}
+
+// selfTestCoverageMatches pick the initial coverage by each
+// -coverage-match mode.
+var selfTestCoverageMatches = []struct {
+	mode, value string
+	want        float64
+}{
+	{"auto", "Measured 3 files: coverage at 55% (run 2)", 55},
+	{"first", "Measured 3 files: coverage at 55% (run 2)", 3},
+	{"last", "Measured 3 files: coverage at 55% (run 2)", 2},
+	{"labeled", "Measured 3 files: coverage at 55% (run 2)", 55},
+	{"auto", "40% line coverage across 12 files", 40},
+	{"first", "40% line coverage across 12 files", 40},
+	{"last", "40% line coverage across 12 files", 12},
+	{"labeled", "Across 12 files, 40% line coverage", 40},
+	{"labeled", "Measured 12 files at 40.5", 40.5},
+}
+
+func selfTestParsing() error {
+	for _, tc := range selfTestMetrics {
+		got, ok := extractMetric(tc.field, tc.value)
+		if !ok || got != tc.want {
+			return fmt.Errorf("%s %q: got %v (ok %v), want %v", tc.field, tc.value, got, ok, tc.want)
+		}
+	}
+	defer func(mode string) { coverageMatch = mode }(coverageMatch)
+	for _, tc := range selfTestCoverageMatches {
+		coverageMatch = tc.mode
+		got, ok := extractMetric("calculatedCoverage", tc.value)
+		if !ok || got != tc.want {
+			return fmt.Errorf("-coverage-match %s %q: got %v (ok %v), want %v", tc.mode, tc.value, got, ok, tc.want)
+		}
+	}
+	var warnings []ParseWarning
+	if got, ok := progressPercent(map[string]interface{}{"dataType": "progress", "percentage": "Generating: 40%"}, &warnings); !ok || got != 40 {
+		return fmt.Errorf("progress event: got %v (ok %v), want 40", got, ok)
+	}
+	if _, ok := progressPercent(map[string]interface{}{"dataType": "progress"}, &warnings); ok || len(warnings) != 0 {
+		return fmt.Errorf("progress event without a percentage: got ok %v, warnings %v", ok, warnings)
+	}
+	return selfTestServerLogs()
+}
+
+// selfTestServerLogStreams interleave log lines with events in each framing
+// the decoder accepts; every stream holds two events of dataType "e".
+var selfTestServerLogStreams = []string{
+	"starting\n{\"dataType\": \"e\"}\nWARN slow\n{\"dataType\": \"e\"}\n",
+	"[INFO] starting\n{\"dataType\": \"e\"}{\"dataType\": \"e\"}\n[INFO] done\n",
+	"{\n  \"note\": \"a \\\" { in a string\",\n  \"dataType\": \"e\"\n}\nlog\n{\"dataType\":\n\"e\"}\n",
+	"[\n{\"dataType\": \"e\"}\nprogress: 50%\n,\n{\"dataType\": \"e\"}\n]\n",
+}
+
+func selfTestServerLogs() error {
+	for _, stream := range selfTestServerLogStreams {
+		reader := bufio.NewReaderSize(newServerLogFilter(bufio.NewReaderSize(strings.NewReader(stream), 16)), 16)
+		decoder, inArray, err := newEventDecoder(reader)
+		if err != nil {
+			return fmt.Errorf("stream %q: %w", stream, err)
+		}
+		events := 0
+		for {
+			event, err := nextEvent(decoder, inArray, false)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("stream %q: %w", stream, err)
+			}
+			if event["dataType"] != "e" {
+				return fmt.Errorf("stream %q: unexpected event %v", stream, event)
+			}
+			events++
+		}
+		if events != 2 {
+			return fmt.Errorf("stream %q: got %d events, want 2", stream, events)
+		}
+	}
+	return nil
+}
+
+// selfTestProfiles checks how files that several profiles match are
+// resolved, with profiles that share the .h extension.
+func selfTestProfiles() error {
+	profiles := []LanguageProfile{{Name: "c", Extension: ".h"}, {Name: "cpp", Extension: ".h"}, {Name: "python", Extension: ".py"}}
+	for _, tc := range []struct {
+		path, only, want string
+	}{
+		{"lib/util.h", "", "c"},
+		{"lib/util.h", "cpp", "cpp"},
+		{"lib/util.h", "python", "c"},
+		{"app.py", "cpp", "python"},
+		{"README.md", "", ""},
+	} {
+		p, ok := resolveProfile(tc.path, profiles, tc.only)
+		if p.Name != tc.want || ok != (tc.want != "") {
+			return fmt.Errorf("%s with -only-language %q: got %q, want %q", tc.path, tc.only, p.Name, tc.want)
+		}
+	}
+	return nil
+}
+
+// fakeTransport replays fixed events, exercising the metric accumulation
+// without a server.
+type fakeTransport struct {
+	events []StreamEvent
+}
+
+func (t fakeTransport) Stream(ctx context.Context, req GenerateTestRequest) (<-chan StreamEvent, error) {
+	events := make(chan StreamEvent)
+	go func() {
+		defer close(events)
+		for _, event := range t.events {
+			if !emit(ctx, events, event) {
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+func coverageEvent(coverage string) StreamEvent {
+	return StreamEvent{Fields: map[string]interface{}{"dataType": "calculatedCoverage", "calculatedCoverage": coverage}}
+}
+
+// selfTestAccumulation checks interim events, -stop-at-expected, done
+// trailers, -field-map paths into nested events, -max-events and mid-stream
+// failures against a fake transport.
+func selfTestAccumulation() error {
+	summary := StreamEvent{Fields: map[string]interface{}{"dataType": "summary", "coverageIncreased": "Coverage increased from 10% to 80%", "linesCovered": "8", "totalLines": "10", "testAdded": "3"}}
+	req := GenerateTestRequest{SrcFilePath: "fake.py", ExpectedCoverage: 50}
+
+	cfg := &Config{transport: fakeTransport{[]StreamEvent{coverageEvent("10%"), coverageEvent("60%"), summary}}}
+	metrics, err := streamMetrics(cfg, req)
+	if err != nil {
+		return err
+	}
+	if metrics.InitialCoverage != 10 || metrics.FinalCoverage != 80 || metrics.TestAdded != 3 || metrics.StoppedEarly || metrics.FromTrailer {
+		return fmt.Errorf("full stream: got %+v", metrics)
+	}
+	if got := formatTrajectory(metrics.Trajectory); got != "10,60" {
+		return fmt.Errorf("full stream: trajectory is %q, want \"10,60\"", got)
+	}
+
+	cfg.StopAtExpected = true
+	metrics, err = streamMetrics(cfg, req)
+	if err != nil {
+		return err
+	}
+	if metrics.FinalCoverage != 60 || !metrics.StoppedEarly {
+		return fmt.Errorf("stop at expected: got %+v", metrics)
+	}
+
+	done := StreamEvent{Fields: map[string]interface{}{"dataType": "done", "finalCoverage": 85.0, "testAdded": "4"}}
+	cfg = &Config{transport: fakeTransport{[]StreamEvent{coverageEvent("10%"), summary, done}}}
+	metrics, err = streamMetrics(cfg, req)
+	if err != nil {
+		return err
+	}
+	if metrics.InitialCoverage != 10 || metrics.FinalCoverage != 85 || metrics.TestAdded != 4 || metrics.TotalLines != 10 || !metrics.FromTrailer {
+		return fmt.Errorf("done trailer: got %+v", metrics)
+	}
+
+	cfg = &Config{transport: fakeTransport{[]StreamEvent{coverageEvent("10%"), coverageEvent("30%")}}}
+	metrics, err = streamMetrics(cfg, req)
+	if err != nil {
+		return err
+	}
+	if !metrics.Incomplete || metrics.InitialCoverage != 10 || resultStatus(metrics, false) != statusIncomplete {
+		return fmt.Errorf("partial stream: got %+v", metrics)
+	}
+
+	nested := StreamEvent{Fields: map[string]interface{}{"dataType": "summary", "result": map[string]interface{}{
+		"coverage": map[string]interface{}{"after": "Coverage increased to 70%"},
+		"lines":    []interface{}{map[string]interface{}{"covered": "7"}, map[string]interface{}{"total": "10"}},
+		"tests":    map[string]interface{}{"added": "2"},
+	}}}
+	fieldMap, err := parseFieldMap([]string{"coverageIncreased=result.coverage.after", "linesCovered=result.lines.0.covered", "totalLines=result.lines.1.total", "testAdded=result.tests.added", "flakyRuns=result.missing.path"})
+	if err != nil {
+		return err
+	}
+	cfg = &Config{transport: fakeTransport{[]StreamEvent{coverageEvent("10%"), nested}}, fieldMap: fieldMap}
+	metrics, err = streamMetrics(cfg, req)
+	if err != nil {
+		return err
+	}
+	if metrics.FinalCoverage != 70 || metrics.LinesCovered != 7 || metrics.TotalLines != 10 || metrics.TestAdded != 2 || len(metrics.Warnings) != 0 {
+		return fmt.Errorf("field map: got %+v", metrics)
+	}
+	if _, err := parseFieldMap([]string{"totalLines=result..total"}); err == nil {
+		return fmt.Errorf("field map: empty path segment accepted")
+	}
+
+	repeated := []StreamEvent{coverageEvent("10%"), coverageEvent("20%"), coverageEvent("20%"), coverageEvent("20%"), coverageEvent("20%")}
+	cfg = &Config{transport: fakeTransport{repeated}, MaxEvents: 3}
+	metrics, err = streamMetrics(cfg, req)
+	if !errors.Is(err, errTooManyEvents) || metrics.InitialCoverage != 10 || len(metrics.Trajectory) != 3 {
+		return fmt.Errorf("-max-events 3: got %+v, error %v", metrics, err)
+	}
+
+	failure := errors.New("connection reset")
+	cfg = &Config{transport: fakeTransport{[]StreamEvent{coverageEvent("10%"), {Err: failure}}}}
+	if _, err := streamMetrics(cfg, req); !errors.Is(err, failure) {
+		return fmt.Errorf("failed stream: got error %v", err)
+	}
+	return nil
+}
+
+// writeChunked flushes data in pieces of size bytes, pausing between them so
+// the client sees each piece as a separate read. A size of 0 sends one event
+// per flush.
+func writeChunked(w http.ResponseWriter, data []byte, size int) {
+	flusher := w.(http.Flusher)
+	if size == 0 {
+		for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+			w.Write(line)
+			flusher.Flush()
+		}
+		return
+	}
+	for len(data) > 0 {
+		n := min(size, len(data))
+		w.Write(data[:n])
+		flusher.Flush()
+		data = data[n:]
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func checkSelfTestReport(path string) error {
+	rows, err := readReport(path)
+	if err != nil {
+		return err
+	}
+	if len(rows) != len(selfTestFiles) {
+		return fmt.Errorf("got %d rows, want %d", len(rows), len(selfTestFiles))
+	}
+	byPath := make(map[string]ReportRow, len(rows))
+	for _, row := range rows {
+		byPath[filepath.ToSlash(row["path"])] = row
+	}
+	for _, f := range selfTestFiles {
+		row, ok := byPath[f.path]
+		if !ok {
+			return fmt.Errorf("no row for %s", f.path)
+		}
+		for key, want := range f.expected {
+			if got := row[key]; got != want {
+				return fmt.Errorf("%s: %s is %q, want %q", f.path, key, got, want)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+package main
+
+import "testing"
+
+// TestSelfTest runs the built-in -self-test mode end to end.
+func TestSelfTest(t *testing.T) {
+	if code := run([]string{"-self-test"}); code != exitOK {
+		t.Errorf("-self-test exited with code %d", code)
+	}
+}
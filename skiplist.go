@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// loadSkipList reads a newline-separated list of paths relative to the root.
+// Blank lines and lines starting with # are ignored. A missing file is
+// treated as an empty list so -auto-skip can create it on first use.
+func loadSkipList(path string) (map[string]bool, error) {
+	skip := make(map[string]bool)
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return skip, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open skip file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		skip[filepath.Clean(line)] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read skip file: %w", err)
+	}
+	return skip, nil
+}
+
+// appendSkipList records a relative path in the skip file for future runs.
+func appendSkipList(path, relativeName string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, relativeName); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// chunkFiles returns the index'th slice of size files.
+func chunkFiles(files []string, size, index int) []string {
+	total := (len(files) + size - 1) / size
+	start := index * size
+	if start >= len(files) {
+		fmt.Printf("Chunk %d is beyond the %d chunk(s) of %d files; nothing to process\n", index, total, len(files))
+		return nil
+	}
+	end := start + size
+	if end > len(files) {
+		end = len(files)
+	}
+	fmt.Printf("Processing chunk %d (of %d, zero-based): files %d-%d of %d\n", index, total, start+1, end, len(files))
+	return files[start:end]
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestSkipList checks that -auto-skip entries are read back by the next
+// run's -skip-file, alongside hand-written comments and blank lines.
+func TestSkipList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "skip.txt")
+	skip, err := loadSkipList(path)
+	if err != nil || len(skip) != 0 {
+		t.Fatalf("missing skip file: got %v, %v; want an empty list", skip, err)
+	}
+
+	if err := os.WriteFile(path, []byte("# known timeouts\n\n  ./pkg/slow.py  \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := appendSkipList(path, "pkg/huge.py"); err != nil {
+		t.Fatal(err)
+	}
+	skip, err = loadSkipList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{"pkg/slow.py": true, "pkg/huge.py": true}
+	if !reflect.DeepEqual(skip, want) {
+		t.Errorf("got %v, want %v", skip, want)
+	}
+}
+
+// TestChunkFiles checks that the chunks of a run cover every file once and
+// that each chunk writes its own report.
+func TestChunkFiles(t *testing.T) {
+	files := []string{"a.py", "b.py", "c.py", "d.py", "e.py"}
+	var covered []string
+	for index := 0; index < 4; index++ {
+		covered = append(covered, chunkFiles(files, 2, index)...)
+	}
+	if !reflect.DeepEqual(covered, files) {
+		t.Errorf("chunks of 2 cover %v, want %v", covered, files)
+	}
+
+	for _, tc := range []struct {
+		cfg  Config
+		want string
+	}{
+		{Config{Output: "report.xlsx"}, "report.xlsx"},
+		{Config{Output: "report.xlsx", ChunkSize: 2}, "report-chunk{chunk}.xlsx"},
+		{Config{Output: "{chunk}/report.xlsx", ChunkSize: 2}, "{chunk}/report.xlsx"},
+	} {
+		if got := tc.cfg.chunkOutput(); got != tc.want {
+			t.Errorf("-output %s with -chunk-size %d: got %s, want %s", tc.cfg.Output, tc.cfg.ChunkSize, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// reportStdout is the real standard output while -stdout routes everything
+// else to standard error.
+var reportStdout *os.File
+
+// stdoutExporter lets a file exporter write to a temporary file and copies
+// the finished report to standard output on Close, so formats that rewrite
+// their file, like the JSON array, still produce one clean document.
+type stdoutExporter struct {
+	Exporter
+	dir, path string
+}
+
+func newStdoutExporter(format string, cfg *Config, meta ReportMetadata) (*stdoutExporter, error) {
+	dir, err := os.MkdirTemp("", "metrics-stdout")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary report: %w", err)
+	}
+	ext := formatExtensions[format]
+	if format == "json" && cfg.JSONLines {
+		ext = ".jsonl"
+	}
+	path := filepath.Join(dir, "report"+ext)
+	exporter, err := newExporter(format, path, cfg, meta)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return &stdoutExporter{Exporter: exporter, dir: dir, path: path}, nil
+}
+
+// Close leaves any sidecar file, such as a CSV report's parse warnings, in
+// the temporary directory where its message points.
+func (e *stdoutExporter) Close() error {
+	defer os.Remove(e.dir)
+	defer os.Remove(e.path)
+	if err := e.Exporter.Close(); err != nil {
+		return err
+	}
+	f, err := os.Open(e.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(reportStdout, f)
+	return err
+}
+
+// printSavedReports lists where the run's reports went.
+func printSavedReports(cfg *Config) {
+	for _, format := range cfg.Formats {
+		if cfg.Stdout {
+			fmt.Printf("%s report written to standard output\n", format)
+			continue
+		}
+		fmt.Printf("%s report saved as %s\n", format, cfg.outputPath(format))
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+)
+
+// serverLogFilter drops the plain-text log lines some servers write into
+// the event stream, logging them with -debug instead. The stream is read a
+// line at a time; a line counts as a log line when it starts between
+// top-level events with anything other than JSON, so events split over
+// several lines or packed onto one still reach the decoder whole. Under
+// array framing the commas and closing bracket between events are JSON too.
+type serverLogFilter struct {
+	r *bufio.Reader
+
+	started   bool
+	inArray   bool
+	depth     int
+	inString  bool
+	escaped   bool
+	lineStart bool
+	skipping  bool
+
+	pending []byte
+	err     error
+}
+
+func newServerLogFilter(r *bufio.Reader) *serverLogFilter {
+	return &serverLogFilter{r: r, lineStart: true}
+}
+
+func (f *serverLogFilter) Read(p []byte) (int, error) {
+	for len(f.pending) == 0 {
+		if f.err != nil {
+			return 0, f.err
+		}
+		chunk, err := f.r.ReadSlice('\n')
+		if err != nil && err != bufio.ErrBufferFull {
+			f.err = err
+		}
+		f.filter(chunk)
+	}
+	n := copy(p, f.pending)
+	f.pending = f.pending[n:]
+	return n, nil
+}
+
+// filter passes on chunk, up to and including a newline, unless it belongs
+// to a log line. ReadSlice reuses its buffer, so the chunk is only kept
+// until Read has copied it out.
+func (f *serverLogFilter) filter(chunk []byte) {
+	if len(chunk) == 0 {
+		return
+	}
+	endsLine := chunk[len(chunk)-1] == '\n'
+	if f.lineStart && !f.skipping && f.logLine(chunk) {
+		f.skipping = true
+		debugf("server log: %s", bytes.TrimSpace(chunk))
+	}
+	f.lineStart = endsLine
+	if f.skipping {
+		f.skipping = !endsLine
+		return
+	}
+	for _, b := range chunk {
+		f.scan(b)
+	}
+	f.pending = chunk
+}
+
+// logLine reports whether a line starting with chunk is text between
+// events rather than part of one.
+func (f *serverLogFilter) logLine(chunk []byte) bool {
+	line := bytes.TrimLeft(chunk, " \t\r\n")
+	outer := 0
+	if f.inArray {
+		outer = 1
+	}
+	if len(line) == 0 || f.inString || f.depth > outer {
+		return false
+	}
+	switch line[0] {
+	case '{':
+		return false
+	case '[':
+		// Only the stream's first line may open an array of events, and a
+		// bracketed log prefix such as "[INFO]" does not.
+		if f.started {
+			return true
+		}
+		rest := bytes.TrimLeft(line[1:], " \t\r\n")
+		return len(rest) > 0 && rest[0] != '{' && rest[0] != ']'
+	case ',', ']':
+		return !f.inArray
+	}
+	return true
+}
+
+// scan tracks nesting outside strings, so a log line can be told apart
+// from a line inside an event.
+func (f *serverLogFilter) scan(b byte) {
+	if f.inString {
+		switch {
+		case f.escaped:
+			f.escaped = false
+		case b == '\\':
+			f.escaped = true
+		case b == '"':
+			f.inString = false
+		}
+		return
+	}
+	switch b {
+	case '"':
+		f.inString = true
+	case '{', '[':
+		if !f.started && b == '[' {
+			f.inArray = true
+		}
+		f.depth++
+	case '}', ']':
+		f.depth--
+	}
+	if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+		f.started = true
+	}
+}
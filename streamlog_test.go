@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+// serverLogStreams interleave log lines with events in each framing the
+// decoder accepts; every stream holds two events of dataType "e".
+var serverLogStreams = []string{
+	"starting\n{\"dataType\": \"e\"}\nWARN slow\n{\"dataType\": \"e\"}\n",
+	"[INFO] starting\n{\"dataType\": \"e\"}{\"dataType\": \"e\"}\n[INFO] done\n",
+	"{\n  \"note\": \"a \\\" { in a string\",\n  \"dataType\": \"e\"\n}\nlog\n{\"dataType\":\n\"e\"}\n",
+	"[\n{\"dataType\": \"e\"}\nprogress: 50%\n,\n{\"dataType\": \"e\"}\n]\n",
+}
+
+func TestServerLogFilter(t *testing.T) {
+	for _, stream := range serverLogStreams {
+		reader := bufio.NewReaderSize(newServerLogFilter(bufio.NewReaderSize(strings.NewReader(stream), 16)), 16)
+		decoder, inArray, err := newEventDecoder(reader)
+		if err != nil {
+			t.Fatalf("stream %q: %v", stream, err)
+		}
+		events := 0
+		for {
+			event, err := nextEvent(decoder, inArray, false)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("stream %q: %v", stream, err)
+			}
+			if event["dataType"] != "e" {
+				t.Errorf("stream %q: unexpected event %v", stream, event)
+			}
+			events++
+		}
+		if events != 2 {
+			t.Errorf("stream %q: got %d events, want 2", stream, events)
+		}
+	}
+}
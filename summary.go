@@ -0,0 +1,234 @@
+package main
+
+import "fmt"
+
+// Exit codes returned by the tool so wrapper scripts can react to the
+// outcome of a run:
+//
+//	0  every file was processed and the coverage gate (if any) was met
+//	2  one or more files failed to process
+//	3  the aggregate final coverage is below -min-coverage
+//	4  a fatal error prevented the run from starting or completing
+//	5  a file's coverage dropped against the -baseline report
+//	6  the run's parse warnings exceeded -max-warnings
+//
+// When several apply the lowest non-zero code wins; in particular file
+// errors take precedence since the aggregate is then computed over an
+// incomplete set of files.
+const (
+	exitOK           = 0
+	exitFileErrors   = 2
+	exitCoverageGate = 3
+	exitFatal        = 4
+	exitRegression   = 5
+	exitWarnings     = 6
+)
+
+// Summary aggregates results across a run. Coverage is weighted by the
+// total lines of each file.
+type Summary struct {
+	Root       string
+	Processed  int
+	Failed     int
+	NoLines    int
+	TestsAdded float64
+	TotalLines float64
+
+	GateFailed  bool
+	Regressions int
+	// Warnings counts parse warnings across all files; TooManyWarnings is
+	// set when they exceed -max-warnings.
+	Warnings        int
+	TooManyWarnings bool
+	// Unprocessed counts files skipped because a run limit was reached.
+	Unprocessed int
+	// DuplicateFunctions counts functions skipped by -dedupe-functions.
+	DuplicateFunctions int
+	// Targeted counts files with an expected coverage, MetExpected those
+	// whose final coverage reached it.
+	Targeted    int
+	MetExpected int
+
+	// Server is what the first server that identified itself reported.
+	Server ServerInfo
+	// FromTrailer counts files whose numbers came from a done trailer.
+	FromTrailer int
+	// Incomplete counts files whose stream ended without a summary; like
+	// files without measurable lines they are left out of the aggregates.
+	Incomplete int
+	// Unsupported counts files the server rejected as unsupported; they
+	// are not counted as processed.
+	Unsupported int
+	// Excluded aggregates the files with an -aggregate-exclude-tags tag on
+	// their own, so they don't move the headline figures or the gate.
+	Excluded *Summary
+
+	sumInitial      float64
+	sumFinal        float64
+	weightedInitial float64
+	weightedFinal   float64
+
+	// Coverage by test type is weighted over the files that report it.
+	unit        typeCoverage
+	integration typeCoverage
+}
+
+// typeCoverage aggregates one test type's coverage, weighted by total lines.
+type typeCoverage struct {
+	files    int
+	lines    float64
+	weighted float64
+	sum      float64
+}
+
+func (t *typeCoverage) add(v *float64, lines float64) {
+	if v == nil {
+		return
+	}
+	t.files++
+	t.lines += lines
+	t.weighted += *v * lines
+	t.sum += *v
+}
+
+// coverage falls back to a plain mean when no line counts are known.
+func (t typeCoverage) coverage() (float64, bool) {
+	switch {
+	case t.files == 0:
+		return 0, false
+	case t.lines == 0:
+		return t.sum / float64(t.files), true
+	}
+	return t.weighted / t.lines, true
+}
+
+// UnitCoverage and IntegrationCoverage report false when no file had the
+// test type's coverage.
+func (s *Summary) UnitCoverage() (float64, bool) { return s.unit.coverage() }
+
+func (s *Summary) IntegrationCoverage() (float64, bool) { return s.integration.coverage() }
+
+// Add counts a result. Files without measurable lines are excluded from
+// the aggregates so they don't skew the coverage figures. Files stopped by
+// -stop-at-expected have no line counts and so carry no weight either.
+// Parse warnings count toward -max-warnings whichever bucket a file is in.
+func (s *Summary) Add(r Result) {
+	s.Warnings += len(r.Metrics.Warnings)
+	if r.Status == statusUnsupported {
+		s.Unsupported++
+		return
+	}
+	if r.ExcludedFromAggregate {
+		if s.Excluded == nil {
+			s.Excluded = &Summary{}
+		}
+		r.ExcludedFromAggregate = false
+		s.Excluded.Add(r)
+		return
+	}
+	s.Processed++
+	s.TestsAdded += r.Metrics.TestAdded
+	if r.Metrics.FromTrailer {
+		s.FromTrailer++
+	}
+	if r.MetExpected == metYes || r.MetExpected == metNo {
+		s.Targeted++
+		if r.MetExpected == metYes {
+			s.MetExpected++
+		}
+	}
+	if r.Status == statusNoLines {
+		s.NoLines++
+		return
+	}
+	if r.Status == statusIncomplete {
+		s.Incomplete++
+		return
+	}
+	s.TotalLines += r.Metrics.TotalLines
+	s.unit.add(r.Metrics.UnitCoverage, r.Metrics.TotalLines)
+	s.integration.add(r.Metrics.IntegrationCoverage, r.Metrics.TotalLines)
+	s.sumInitial += r.Metrics.InitialCoverage
+	s.sumFinal += r.Metrics.FinalCoverage
+	s.weightedInitial += r.Metrics.InitialCoverage * r.Metrics.TotalLines
+	s.weightedFinal += r.Metrics.FinalCoverage * r.Metrics.TotalLines
+}
+
+// InitialCoverage and FinalCoverage fall back to a plain mean when no line
+// counts are known, as in -measure-only runs.
+func (s *Summary) InitialCoverage() float64 {
+	if s.TotalLines == 0 {
+		return s.mean(s.sumInitial)
+	}
+	return s.weightedInitial / s.TotalLines
+}
+
+func (s *Summary) FinalCoverage() float64 {
+	if s.TotalLines == 0 {
+		return s.mean(s.sumFinal)
+	}
+	return s.weightedFinal / s.TotalLines
+}
+
+// mean averages sum over the files that were measured.
+func (s *Summary) mean(sum float64) float64 {
+	measured := s.Processed - s.NoLines - s.Incomplete
+	if measured == 0 {
+		return 0
+	}
+	return sum / float64(measured)
+}
+
+func (s *Summary) Print() {
+	failed := fmt.Sprint(s.Failed)
+	if s.Failed > 0 {
+		failed = red(failed)
+	}
+	fmt.Printf("Root directory: %s\nFiles processed: %d, failed: %s, no measurable lines: %d\nAggregate coverage: %s\nTests added: %.0f\n",
+		s.Root, s.Processed, failed, s.NoLines, coverageChange(s.InitialCoverage(), s.FinalCoverage()), s.TestsAdded)
+	if s.Unprocessed > 0 {
+		fmt.Printf("Files left unprocessed: %d\n", s.Unprocessed)
+	}
+	if unit, ok := s.UnitCoverage(); ok {
+		fmt.Printf("Unit coverage: %.2f%% over %d files\n", unit, s.unit.files)
+	}
+	if integration, ok := s.IntegrationCoverage(); ok {
+		fmt.Printf("Integration coverage: %.2f%% over %d files\n", integration, s.integration.files)
+	}
+	if s.Warnings > 0 {
+		fmt.Printf("Parse warnings: %d\n", s.Warnings)
+	}
+	if s.Incomplete > 0 {
+		fmt.Printf("Incomplete streams: %d\n", s.Incomplete)
+	}
+	if e := s.Excluded; e != nil {
+		fmt.Printf("Excluded from aggregate: %d files, coverage %s, tests added %.0f\n",
+			e.Processed, coverageChange(e.InitialCoverage(), e.FinalCoverage()), e.TestsAdded)
+	}
+	if s.Unsupported > 0 {
+		fmt.Printf("Files unsupported by the server: %d\n", s.Unsupported)
+	}
+	if s.DuplicateFunctions > 0 {
+		fmt.Printf("Duplicate functions skipped: %d\n", s.DuplicateFunctions)
+	}
+	if s.FromTrailer > 0 {
+		fmt.Printf("Files with numbers from a done trailer: %d\n", s.FromTrailer)
+	}
+	if s.Targeted > 0 {
+		fmt.Printf("Met expected coverage: %d of %d files\n", s.MetExpected, s.Targeted)
+	}
+}
+
+func exitCode(s Summary) int {
+	switch {
+	case s.Failed > 0:
+		return exitFileErrors
+	case s.GateFailed:
+		return exitCoverageGate
+	case s.Regressions > 0:
+		return exitRegression
+	case s.TooManyWarnings:
+		return exitWarnings
+	}
+	return exitOK
+}
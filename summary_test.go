@@ -0,0 +1,112 @@
+package main
+
+import "testing"
+
+func result(status string, initial, final, totalLines float64) Result {
+	return Result{Status: status, Metrics: Metrics{InitialCoverage: initial, FinalCoverage: final, TotalLines: totalLines}}
+}
+
+func TestSummaryZeroLineFiles(t *testing.T) {
+	if got := resultStatus(Metrics{FinalCoverage: 50}, false); got != statusNoLines {
+		t.Errorf("file with no total lines has status %q, want %q", got, statusNoLines)
+	}
+
+	var s Summary
+	s.Add(result(statusNoLines, 0, 0, 0))
+	s.Add(result(statusNoLines, 0, 0, 0))
+	if s.Processed != 2 || s.NoLines != 2 {
+		t.Errorf("counted %d processed, %d without lines, want 2 and 2", s.Processed, s.NoLines)
+	}
+	if s.InitialCoverage() != 0 || s.FinalCoverage() != 0 {
+		t.Errorf("aggregate coverage %v -> %v, want 0 -> 0", s.InitialCoverage(), s.FinalCoverage())
+	}
+
+	s.Add(result(statusOK, 20, 60, 10))
+	s.Add(result(statusOK, 50, 80, 30))
+	if s.InitialCoverage() != 42.5 || s.FinalCoverage() != 75 {
+		t.Errorf("aggregate coverage %v -> %v, want 42.5 -> 75 weighted over files with lines", s.InitialCoverage(), s.FinalCoverage())
+	}
+}
+
+// TestSummaryNoLineCounts checks the plain mean used when no file reports
+// line counts, as in -measure-only runs.
+func TestSummaryNoLineCounts(t *testing.T) {
+	var s Summary
+	s.Add(result(statusOK, 20, 40, 0))
+	s.Add(result(statusOK, 40, 90, 0))
+	s.Add(result(statusIncomplete, 90, 90, 0))
+	if s.InitialCoverage() != 30 || s.FinalCoverage() != 65 {
+		t.Errorf("aggregate coverage %v -> %v, want 30 -> 65", s.InitialCoverage(), s.FinalCoverage())
+	}
+}
+
+// TestSummaryExcludedWarnings checks that files excluded from the aggregate
+// still count toward -max-warnings.
+func TestSummaryExcludedWarnings(t *testing.T) {
+	var s Summary
+	warned := result(statusOK, 20, 60, 10)
+	warned.Metrics.Warnings = []ParseWarning{{}, {}}
+	s.Add(warned)
+	warned.ExcludedFromAggregate = true
+	s.Add(warned)
+	if s.Warnings != 4 {
+		t.Errorf("counted %d warnings, want 4", s.Warnings)
+	}
+	if s.Processed != 1 || s.Excluded == nil || s.Excluded.Processed != 1 {
+		t.Errorf("counted %d processed and %+v excluded, want 1 of each", s.Processed, s.Excluded)
+	}
+}
+
+// TestMetExpected checks the Met Expected? verdicts and that only files
+// with a verdict count as targeted.
+func TestMetExpected(t *testing.T) {
+	for _, tc := range []struct {
+		m           Metrics
+		expected    float64
+		measureOnly bool
+		want        string
+	}{
+		{Metrics{FinalCoverage: 80}, 80, false, metYes},
+		{Metrics{FinalCoverage: 79.99}, 80, false, metNo},
+		{Metrics{FinalCoverage: 90}, 0, false, metNoTarget},
+		{Metrics{InitialCoverage: 90}, 80, true, ""},
+		{Metrics{FinalCoverage: 90, Incomplete: true}, 80, false, ""},
+	} {
+		if got := metExpected(tc.m, tc.expected, tc.measureOnly); got != tc.want {
+			t.Errorf("%+v against %v (measure only %v): got %q, want %q", tc.m, tc.expected, tc.measureOnly, got, tc.want)
+		}
+	}
+
+	var s Summary
+	for _, verdict := range []string{metYes, metNo, metYes, metNoTarget, ""} {
+		r := result(statusOK, 10, 50, 10)
+		r.MetExpected = verdict
+		s.Add(r)
+	}
+	if s.Targeted != 3 || s.MetExpected != 2 {
+		t.Errorf("counted %d of %d targeted files meeting their expected coverage, want 2 of 3", s.MetExpected, s.Targeted)
+	}
+}
+
+// TestSummaryTypeCoverage checks unit and integration coverage are each
+// weighted over only the files that report them.
+func TestSummaryTypeCoverage(t *testing.T) {
+	var s Summary
+	if _, ok := s.UnitCoverage(); ok {
+		t.Error("unit coverage known before any file reported it")
+	}
+	low, high := 40.0, 90.0
+	a := result(statusOK, 20, 60, 10)
+	a.Metrics.UnitCoverage = &low
+	b := result(statusOK, 20, 60, 30)
+	b.Metrics.UnitCoverage = &high
+	b.Metrics.IntegrationCoverage = &high
+	s.Add(a)
+	s.Add(b)
+	if got, ok := s.UnitCoverage(); !ok || got != 77.5 {
+		t.Errorf("unit coverage %v, %v; want 77.5 weighted by lines", got, ok)
+	}
+	if got, ok := s.IntegrationCoverage(); !ok || got != 90 {
+		t.Errorf("integration coverage %v, %v; want 90 from the one file reporting it", got, ok)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// exitSummary is the single JSON line -summary-json writes to stderr as the
+// run ends, for scripts that wrap the tool.
+type exitSummary struct {
+	Files           int     `json:"files"`
+	Processed       int     `json:"processed"`
+	Failed          int     `json:"failed"`
+	NoLines         int     `json:"noMeasurableLines"`
+	Unsupported     int     `json:"unsupported"`
+	Unprocessed     int     `json:"unprocessed"`
+	InitialCoverage float64 `json:"initialCoverage"`
+	FinalCoverage   float64 `json:"finalCoverage"`
+	TestsAdded      float64 `json:"testsAdded"`
+	DurationSeconds float64 `json:"durationSeconds"`
+	ExitCode        int     `json:"exitCode"`
+	Interrupted     bool    `json:"interrupted,omitempty"`
+}
+
+func newExitSummary(s Summary, files int, duration time.Duration, precision, code int) exitSummary {
+	return exitSummary{
+		Files:           files,
+		Processed:       s.Processed,
+		Failed:          s.Failed,
+		NoLines:         s.NoLines,
+		Unsupported:     s.Unsupported,
+		Unprocessed:     s.Unprocessed,
+		InitialCoverage: roundTo(s.InitialCoverage(), precision),
+		FinalCoverage:   roundTo(s.FinalCoverage(), precision),
+		TestsAdded:      s.TestsAdded,
+		DurationSeconds: roundTo(duration.Seconds(), 3),
+		ExitCode:        code,
+	}
+}
+
+func printSummaryJSON(e exitSummary) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		fmt.Println("Failed to marshal summary JSON:", err)
+		return
+	}
+	fmt.Fprintln(os.Stderr, string(data))
+}
+
+// exitInterrupted is the conventional exit code of a process stopped by
+// SIGINT.
+const exitInterrupted = 130
+
+// summaryOnSignal stops a -summary-json run on SIGINT or SIGTERM by
+// cancelling its context. run then stops dispatching files, closes the
+// reports, which saves rows held in memory, and prints its summary marked
+// interrupted. A second signal exits at once. Without -summary-json the
+// watcher is nil and leaves signals alone.
+type summaryOnSignal struct {
+	signals     chan os.Signal
+	interrupted atomic.Bool
+}
+
+func watchSignals(cfg *Config, cancel context.CancelFunc) *summaryOnSignal {
+	if !cfg.SummaryJSON {
+		return nil
+	}
+	w := &summaryOnSignal{signals: make(chan os.Signal, 1)}
+	signal.Notify(w.signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig, ok := <-w.signals
+		if !ok {
+			return
+		}
+		signal.Stop(w.signals)
+		fmt.Printf("Received %s; stopping after saving progress\n", sig)
+		w.interrupted.Store(true)
+		cancel()
+	}()
+	return w
+}
+
+// Interrupted reports whether a signal stopped the run.
+func (w *summaryOnSignal) Interrupted() bool {
+	return w != nil && w.interrupted.Load()
+}
+
+func (w *summaryOnSignal) Stop() {
+	if w == nil {
+		return
+	}
+	signal.Stop(w.signals)
+	close(w.signals)
+}
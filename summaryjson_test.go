@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSummaryJSONInterrupted interrupts a run while its second file is in
+// flight and checks that the in-memory JSON report still holds the first
+// file and that the summary counts the other two as unprocessed.
+func TestSummaryJSONInterrupted(t *testing.T) {
+	dir := t.TempDir()
+	project := filepath.Join(dir, "project")
+	writeProject(t, project, "a.py", "b.py", "c.py")
+	release := make(chan struct{})
+	server := eventServer(t, func(req GenerateTestRequest) []map[string]string {
+		if filepath.Base(req.SrcFilePath) == "b.py" {
+			self, _ := os.FindProcess(os.Getpid())
+			self.Signal(os.Interrupt)
+			<-release
+		}
+		return []map[string]string{
+			{"dataType": "calculatedCoverage", "calculatedCoverage": "Current coverage is 40%"},
+			{"dataType": "summary", "coverageIncreased": "Coverage increased from 40% to 75%", "linesCovered": "15", "totalLines": "20", "testAdded": "2"},
+		}
+	})
+	t.Cleanup(func() { close(release) })
+
+	stderr := os.Stderr
+	errFile, err := os.Create(filepath.Join(dir, "stderr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer errFile.Close()
+	os.Stderr = errFile
+	report := filepath.Join(dir, "report.json")
+	code := run([]string{"-root", project, "-api-url", server.URL, "-format", "json", "-output", report, "-summary-json"})
+	os.Stderr = stderr
+
+	if code != exitInterrupted {
+		t.Errorf("got exit code %d, want %d", code, exitInterrupted)
+	}
+	rows, err := readReport(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0]["path"] != "a.py" {
+		t.Errorf("report holds %v, want the row of a.py", rows)
+	}
+	data, err := os.ReadFile(errFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e exitSummary
+	if err := json.Unmarshal([]byte(strings.TrimSpace(string(data))), &e); err != nil {
+		t.Fatalf("stderr %q: %v", data, err)
+	}
+	if !e.Interrupted || e.ExitCode != exitInterrupted || e.Files != 3 || e.Processed != 1 || e.Unprocessed != 2 {
+		t.Errorf("got summary %+v", e)
+	}
+}
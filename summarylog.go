@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// summaryLog appends one tab-separated line per file to a text log, e.g.
+//
+//	pkg/a.py	init=40.50	final=72.00	delta=31.50	tests=3	dur=1m2s	status=ok
+//
+// Lines are written as each file finishes so the log survives a crash.
+// Spaces in the status are replaced with dashes to keep fields greppable.
+// A nil log discards writes.
+type summaryLog struct {
+	file *os.File
+}
+
+func openSummaryLog(path string) (*summaryLog, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open summary log: %w", err)
+	}
+	return &summaryLog{file: f}, nil
+}
+
+func (l *summaryLog) Write(path string, m Metrics, duration time.Duration, status string) {
+	if l == nil {
+		return
+	}
+	_, err := fmt.Fprintf(l.file, "%s\tinit=%.2f\tfinal=%.2f\tdelta=%.2f\ttests=%.0f\tdur=%s\tstatus=%s\n",
+		path, m.InitialCoverage, m.FinalCoverage, m.Delta(), m.TestAdded, duration.Round(time.Millisecond), strings.ReplaceAll(status, " ", "-"))
+	if err != nil {
+		fmt.Printf("Failed to write summary log for %s: %v\n", path, err)
+	}
+}
+
+func (l *summaryLog) Close() error {
+	return l.file.Close()
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestSummaryLog checks the line format, that a second run appends, and
+// that a nil log discards writes.
+func TestSummaryLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "summary.log")
+	for _, name := range []string{"a.py", "b.py"} {
+		l, err := openSummaryLog(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l.Write(name, Metrics{InitialCoverage: 40.5, FinalCoverage: 72, TestAdded: 3}, 62*time.Second, statusNoLines)
+		if err := l.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var discard *summaryLog
+	discard.Write("c.py", Metrics{}, 0, statusOK)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "a.py\tinit=40.50\tfinal=72.00\tdelta=31.50\ttests=3\tdur=1m2s\tstatus=no-measurable-lines\n" +
+		"b.py\tinit=40.50\tfinal=72.00\tdelta=31.50\ttests=3\tdur=1m2s\tstatus=no-measurable-lines\n"
+	if string(data) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", data, want)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+const untagged = "(untagged)"
+
+// tagRule attaches tags to the files matching a glob.
+type tagRule struct {
+	pattern string
+	tags    []string
+}
+
+// loadTagRules reads "glob tag[,tag...]" lines. Globs use path.Match syntax
+// on slash-separated relative paths, and a trailing /** matches everything
+// below a directory. Blank lines and lines starting with # are ignored.
+func loadTagRules(file string) ([]tagRule, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tags file: %w", err)
+	}
+	defer f.Close()
+
+	var rules []tagRule
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected \"glob tag[,tag...]\", got %q", file, lineNo, line)
+		}
+		if _, err := path.Match(fields[0], ""); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid glob %q", file, lineNo, fields[0])
+		}
+		rule := tagRule{pattern: fields[0]}
+		for _, tag := range strings.Split(fields[1], ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				rule.tags = append(rule.tags, tag)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read tags file: %w", err)
+	}
+	return rules, nil
+}
+
+func (r tagRule) matches(name string) bool {
+	if dir, ok := strings.CutSuffix(r.pattern, "/**"); ok {
+		return strings.HasPrefix(name, dir+"/")
+	}
+	ok, _ := path.Match(r.pattern, name)
+	return ok
+}
+
+// resolveTags returns the tags for a slash-separated relative path. In
+// "union" mode every matching rule contributes; in "last" mode only the
+// last matching rule in the file counts.
+func resolveTags(rules []tagRule, name, mode string) []string {
+	var tags []string
+	for _, rule := range rules {
+		if !rule.matches(name) {
+			continue
+		}
+		if mode == "last" {
+			tags = nil
+		}
+		for _, tag := range rule.tags {
+			if !contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// excludedFromAggregate reports whether any of a file's tags is one of the
+// -aggregate-exclude-tags.
+func excludedFromAggregate(cfg *Config, tags []string) bool {
+	for _, tag := range tags {
+		if contains(cfg.AggregateExcludeTags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// tagSummaries aggregates results per tag. A file counts towards each of
+// its tags; files without tags are grouped as (untagged).
+func tagSummaries(results []Result) ([]string, map[string]*Summary) {
+	summaries := make(map[string]*Summary)
+	for _, r := range results {
+		tags := r.Tags
+		if len(tags) == 0 {
+			tags = []string{untagged}
+		}
+		// A tag's own figures include its excluded files.
+		r.ExcludedFromAggregate = false
+		for _, tag := range tags {
+			if summaries[tag] == nil {
+				summaries[tag] = &Summary{}
+			}
+			summaries[tag].Add(r)
+		}
+	}
+	names := make([]string, 0, len(summaries))
+	for tag := range summaries {
+		names = append(names, tag)
+	}
+	sort.Strings(names)
+	return names, summaries
+}
+
+func printTagSummaries(results []Result) {
+	names, summaries := tagSummaries(results)
+	for _, tag := range names {
+		s := summaries[tag]
+		fmt.Printf("Tag %s: %d files, coverage %.2f%% -> %.2f%%, tests added %.0f\n",
+			tag, s.Processed, s.InitialCoverage(), s.FinalCoverage(), s.TestsAdded)
+	}
+}
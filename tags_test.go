@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveTags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tags.txt")
+	data := "# ownership\napi/** backend\napi/*_views.py web,backend\nlegacy/** legacy\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := loadTagRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name, mode string
+		want       []string
+	}{
+		{"api/user_views.py", "union", []string{"backend", "web"}},
+		{"api/user_views.py", "last", []string{"web", "backend"}},
+		{"api/sub/models.py", "union", []string{"backend"}},
+		{"apix/models.py", "union", nil},
+		{"main.py", "union", nil},
+	} {
+		if got := resolveTags(rules, tc.name, tc.mode); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s in %s mode: got %v, want %v", tc.name, tc.mode, got, tc.want)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("api/[ backend\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadTagRules(path); err == nil || !strings.Contains(err.Error(), "invalid glob") {
+		t.Errorf("got error %v, want an invalid glob", err)
+	}
+}
+
+// TestTagSummaries checks that a file counts towards each of its tags and
+// untagged files are grouped together.
+func TestTagSummaries(t *testing.T) {
+	results := []Result{
+		{Path: "a.py", Tags: []string{"backend", "web"}, Status: statusOK, Metrics: Metrics{InitialCoverage: 10, FinalCoverage: 50, TotalLines: 10, TestAdded: 2}},
+		{Path: "b.py", Tags: []string{"backend"}, Status: statusOK, Metrics: Metrics{InitialCoverage: 30, FinalCoverage: 70, TotalLines: 10, TestAdded: 1}},
+		{Path: "c.py", Status: statusOK, Metrics: Metrics{FinalCoverage: 20, TotalLines: 10}},
+	}
+	names, summaries := tagSummaries(results)
+	if want := []string{untagged, "backend", "web"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("got tags %v, want %v", names, want)
+	}
+	for tag, want := range map[string][2]float64{untagged: {1, 0}, "backend": {2, 3}, "web": {1, 2}} {
+		if s := summaries[tag]; float64(s.Processed) != want[0] || s.TestsAdded != want[1] {
+			t.Errorf("tag %s: %d files, %v tests added; want %v and %v", tag, s.Processed, s.TestsAdded, want[0], want[1])
+		}
+	}
+	if got := summaries["backend"].FinalCoverage(); got != 60 {
+		t.Errorf("backend final coverage %v, want 60", got)
+	}
+}
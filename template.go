@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var templatePlaceholder = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// templateKeys lists the placeholders supported in output filenames.
+var templateKeys = []string{"date", "lang", "count", "host", "chunk"}
+
+// outputTemplateVars returns the values substituted into output filenames.
+func outputTemplateVars(start time.Time, lang string, count, chunk int) map[string]string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown-host"
+	}
+	return map[string]string{
+		"date":  start.Format("2006-01-02"),
+		"lang":  lang,
+		"count": strconv.Itoa(count),
+		"host":  host,
+		"chunk": strconv.Itoa(chunk),
+	}
+}
+
+// expandTemplate replaces {key} placeholders in s with values from vars and
+// rejects any placeholder it does not know.
+func expandTemplate(s string, vars map[string]string) (string, error) {
+	var unknown string
+	out := templatePlaceholder.ReplaceAllStringFunc(s, func(m string) string {
+		key := m[1 : len(m)-1]
+		value, ok := vars[key]
+		if !ok && unknown == "" {
+			unknown = key
+		}
+		return value
+	})
+	if unknown != "" {
+		return "", fmt.Errorf("unknown placeholder {%s} in %q (supported: %v)", unknown, s, templateKeys)
+	}
+	return out, nil
+}
+
+// validateTemplate checks s for unknown placeholders without expanding it.
+func validateTemplate(s string) error {
+	vars := make(map[string]string, len(templateKeys))
+	for _, key := range templateKeys {
+		vars[key] = ""
+	}
+	_, err := expandTemplate(s, vars)
+	return err
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpandTemplate(t *testing.T) {
+	start := time.Date(2024, 3, 9, 15, 0, 0, 0, time.UTC)
+	vars := outputTemplateVars(start, "python", 42, 3)
+	got, err := expandTemplate("reports/{lang}-{date}-{count}-chunk{chunk}.xlsx", vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "reports/python-2024-03-09-42-chunk3.xlsx"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got, _ := expandTemplate("{host}.csv", vars); got != vars["host"]+".csv" || vars["host"] == "" {
+		t.Errorf("{host} expanded to %q", got)
+	}
+
+	for _, s := range []string{"{user}.xlsx", "{date}-{Date}.xlsx"} {
+		if err := validateTemplate(s); err == nil || !strings.Contains(err.Error(), "unknown placeholder") {
+			t.Errorf("%s: got error %v, want an unknown placeholder", s, err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import "fmt"
+
+// tidyIdentifiers are the columns that identify a row in the tidy CSV; every
+// other report column becomes a metric.
+var tidyIdentifiers = map[string]bool{"root": true, "path": true, "abs_path": true, "function": true, "tags": true}
+
+// tidyCSVExporter writes the long layout of -format tidy-csv: one row per
+// file and metric, which pivot tables and charting tools handle more easily
+// than the wide report. Blank values are left out.
+type tidyCSVExporter struct {
+	*csvExporter
+	ids     []Column
+	metrics []Column
+}
+
+func newTidyCSVExporter(path string, cols []Column, appendMode bool) (*tidyCSVExporter, error) {
+	e := &tidyCSVExporter{}
+	for _, c := range cols {
+		if tidyIdentifiers[c.Key] {
+			e.ids = append(e.ids, c)
+		} else {
+			e.metrics = append(e.metrics, c)
+		}
+	}
+	header := append(append([]Column{}, e.ids...), Column{Key: "metric", Header: "Metric"}, Column{Key: "value", Header: "Value"})
+	inner, err := newCSVExporter(path, header, appendMode)
+	if err != nil {
+		return nil, err
+	}
+	e.csvExporter = inner
+	return e, nil
+}
+
+func (e *tidyCSVExporter) Write(r Result) error {
+	for _, m := range e.metrics {
+		value := fmt.Sprint(m.Value(r))
+		if value == "" {
+			continue
+		}
+		record := make([]string, 0, len(e.ids)+2)
+		for _, c := range e.ids {
+			record = append(record, fmt.Sprint(c.Value(r)))
+		}
+		e.writer.Write(append(record, m.Key, value))
+	}
+	e.writer.Flush()
+	e.warnings = append(e.warnings, warningRecords(r)...)
+	return e.writer.Error()
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestTidyCSV checks the long layout: the identifying columns repeated on
+// one row per metric, with blank metrics left out.
+func TestTidyCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report-tidy.csv")
+	cols := []Column{*columnByKey("path"), *columnByKey("tags"), *columnByKey("final_coverage"), *columnByKey("tests_added"), *columnByKey("request_id")}
+	e, err := newTidyCSVExporter(path, cols, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Write(Result{Path: "a.py", Tags: []string{"api", "web"}, Status: statusOK, Metrics: Metrics{FinalCoverage: 72.5, TestAdded: 3}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Filepath,Tags,Metric,Value\n" +
+		"a.py,\"api,web\",final_coverage,72.5\n" +
+		"a.py,\"api,web\",tests_added,3\n"
+	if string(data) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", data, want)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/template"
+	"time"
+)
+
+// timingsChartRows caps the bars drawn by -timings-chart; the slowest files
+// are the ones worth seeing, and the rest are summed up in a closing line.
+const timingsChartRows = 100
+
+type timingsBar struct {
+	Label    string
+	Duration string
+	Y        int
+	Width    float64
+	TextX    float64
+}
+
+var timingsChartTemplate = template.Must(template.New("timings").Parse(`<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="{{.Height}}" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+  <title>Time per file, slowest first</title>
+  <text x="10" y="20" font-size="13" font-weight="bold">Time per file, slowest first ({{.Total}} in total)</text>
+{{- range .Bars}}
+  <text x="{{$.LabelX}}" y="{{.Y}}" dy="12" text-anchor="end">{{html .Label}}</text>
+  <rect x="{{$.BarX}}" y="{{.Y}}" width="{{.Width}}" height="16" fill="#4c78a8"><title>{{html .Label}}: {{.Duration}}</title></rect>
+  <text x="{{.TextX}}" y="{{.Y}}" dy="12">{{.Duration}}</text>
+{{- end}}
+{{- if .More}}
+  <text x="{{.LabelX}}" y="{{.MoreY}}" dy="12" text-anchor="end">{{.More}}</text>
+{{- end}}
+</svg>
+`))
+
+// writeTimingsChart writes an SVG bar chart of each result's duration,
+// longest first, scaled to the slowest file.
+func writeTimingsChart(file string, results []Result) error {
+	sorted := make([]Result, 0, len(results))
+	var total time.Duration
+	for _, r := range results {
+		if r.Duration > 0 {
+			sorted = append(sorted, r)
+			total += r.Duration
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Duration > sorted[j].Duration })
+
+	const barWidth, rowHeight, top = 500.0, 20, 36
+	shown := sorted[:min(len(sorted), timingsChartRows)]
+	labelWidth := 0
+	labels := make([]string, len(shown))
+	for i, r := range shown {
+		label := r.Path
+		if r.Root != "" {
+			label = r.Root + "/" + r.Path
+		}
+		if r.Function != "" {
+			label += ":" + r.Function
+		}
+		labels[i] = label
+		labelWidth = max(labelWidth, 7*len([]rune(label)))
+	}
+	barX := labelWidth + 20
+	bars := make([]timingsBar, len(shown))
+	for i, r := range shown {
+		width := roundTo(barWidth*r.Duration.Seconds()/shown[0].Duration.Seconds(), 1)
+		bars[i] = timingsBar{
+			Label:    labels[i],
+			Duration: r.Duration.Round(time.Millisecond).String(),
+			Y:        top + i*rowHeight,
+			Width:    width,
+			TextX:    float64(barX) + width + 4,
+		}
+	}
+	more := ""
+	if hidden := len(sorted) - len(shown); hidden > 0 {
+		var rest time.Duration
+		for _, r := range sorted[len(shown):] {
+			rest += r.Duration
+		}
+		more = fmt.Sprintf("%d more files, %s in total", hidden, rest.Round(time.Millisecond))
+	}
+
+	rows := len(bars)
+	if more != "" {
+		rows++
+	}
+	data := map[string]interface{}{
+		"Bars":   bars,
+		"Total":  total.Round(time.Millisecond).String(),
+		"More":   more,
+		"MoreY":  top + len(bars)*rowHeight,
+		"LabelX": labelWidth + 10,
+		"BarX":   barX,
+		"Width":  barX + int(barWidth) + 100,
+		"Height": top + rows*rowHeight + 10,
+	}
+	return writeFileAtomic(file, func(w io.Writer) error {
+		if err := timingsChartTemplate.Execute(w, data); err != nil {
+			return fmt.Errorf("failed to render timings chart: %w", err)
+		}
+		return nil
+	})
+}
+
+// saveTimingsChart writes the -timings-chart, if asked for.
+func saveTimingsChart(cfg *Config, results []Result) {
+	if cfg.TimingsChart == "" {
+		return
+	}
+	if err := writeTimingsChart(cfg.TimingsChart, results); err != nil {
+		fmt.Println("Failed to write timings chart:", err)
+	} else {
+		fmt.Printf("Timings chart saved as %s\n", cfg.TimingsChart)
+	}
+}
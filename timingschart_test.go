@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestTimingsChart checks the chart draws a bar per timed result, slowest
+// first and scaled to it, and sums up the files past timingsChartRows.
+func TestTimingsChart(t *testing.T) {
+	results := []Result{
+		{Path: "fast.py", Duration: time.Second},
+		{Path: "slow.py", Root: "svc", Function: "parse", Duration: 4 * time.Second},
+		{Path: "skipped.py"},
+	}
+	for i := 0; i < timingsChartRows; i++ {
+		results = append(results, Result{Path: fmt.Sprintf("f%d.py", i), Duration: time.Millisecond})
+	}
+	path := filepath.Join(t.TempDir(), "timings.svg")
+	if err := writeTimingsChart(path, results); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var svg struct {
+		Rects []struct {
+			Width string `xml:"width,attr"`
+			Title string `xml:"title"`
+		} `xml:"rect"`
+		Texts []string `xml:"text"`
+	}
+	if err := xml.Unmarshal(data, &svg); err != nil {
+		t.Fatalf("chart is not valid XML: %v", err)
+	}
+	if len(svg.Rects) != timingsChartRows {
+		t.Fatalf("drew %d bars, want %d", len(svg.Rects), timingsChartRows)
+	}
+	if first, second := svg.Rects[0], svg.Rects[1]; first.Title != "svc/slow.py:parse: 4s" || first.Width != "500" || second.Title != "fast.py: 1s" || second.Width != "125" {
+		t.Errorf("first bars %+v and %+v, want slow.py at full width and fast.py at a quarter", first, second)
+	}
+	if last := svg.Texts[len(svg.Texts)-1]; last != "2 more files, 2ms in total" {
+		t.Errorf("closing line %q, want the 2 files not drawn", last)
+	}
+	if strings.Contains(string(data), "skipped.py") {
+		t.Error("a result without a duration was drawn")
+	}
+}
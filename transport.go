@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Transport fetches the event stream for one request from the generation
+// server. Stream returns once the request is accepted and delivers events
+// on the channel, closing it when the stream ends. A failure mid-stream
+// arrives as a last event with Err set. Cancelling ctx abandons the stream.
+type Transport interface {
+	Stream(ctx context.Context, req GenerateTestRequest) (<-chan StreamEvent, error)
+}
+
+// StreamEvent is one event of a generation stream, under the keys of the
+// HTTP JSON events whichever transport carried it.
+type StreamEvent struct {
+	Fields map[string]interface{}
+	Err    error
+
+	// Header is set on events made from response headers, which belong to
+	// every file of a batch.
+	Header bool
+}
+
+// emit hands an event to the consumer, reporting false once ctx is done.
+func emit(ctx context.Context, events chan<- StreamEvent, event StreamEvent) bool {
+	select {
+	case events <- event:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func newTransport(cfg *Config) (Transport, error) {
+	switch cfg.Transport {
+	case "http":
+		return &httpTransport{cfg: cfg}, nil
+	case "grpc":
+		return newGRPCTransport(cfg)
+	case "websocket":
+		return &websocketTransport{cfg: cfg}, nil
+	}
+	return nil, fmt.Errorf("unknown -transport %q", cfg.Transport)
+}
+
+// httpTransport POSTs the request as JSON and reads the response body as a
+// stream of JSON events.
+type httpTransport struct {
+	cfg *Config
+}
+
+func (t *httpTransport) Stream(ctx context.Context, requestBody GenerateTestRequest) (<-chan StreamEvent, error) {
+	cfg := t.cfg
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", cfg.endpoint, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cfg.APIToken != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.APIToken)
+	}
+	if cfg.DumpRequests {
+		dumpRequest(req, jsonData)
+	}
+
+	resp, err := cfg.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send POST request: %w", err)
+	}
+
+	// Print response status for debugging
+	fmt.Printf("Response Status: %d\n", resp.StatusCode)
+
+	if resp.StatusCode != http.StatusOK {
+		if location := resp.Header.Get("Location"); location != "" {
+			fmt.Printf("Redirected to %s\n", location)
+		}
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusUnprocessableEntity {
+			return nil, fmt.Errorf("%w: %s", errUnsupported, bytes.TrimSpace(bodyBytes))
+		}
+		if id := resp.Header.Get("X-Request-ID"); id != "" {
+			return nil, fmt.Errorf("received non-OK response: %d (request ID %s)\nBody: %s", resp.StatusCode, id, string(bodyBytes))
+		}
+		return nil, fmt.Errorf("received non-OK response: %d\nBody: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var body io.Reader = resp.Body
+	if cfg.MaxResponseBytes > 0 {
+		body = &limitedReader{r: resp.Body, remaining: cfg.MaxResponseBytes}
+	}
+
+	// Read the response stream line by line
+	reader := bufio.NewReaderSize(body, readBufferSize(cfg))
+	if err := skipStreamPreamble(reader); err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("error reading JSON stream: %w", err)
+	}
+	fmt.Printf("Streaming response for %s:\n", requestBody.SrcFilePath)
+
+	// The filter hands large reads through, so a minimal buffer on top of
+	// it only serves newEventDecoder's peek.
+	decoder, inArray, err := newEventDecoder(bufio.NewReaderSize(newServerLogFilter(reader), 16))
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("error reading JSON stream: %w", err)
+	}
+	events := make(chan StreamEvent)
+	go func() {
+		defer close(events)
+		defer resp.Body.Close()
+		if info := serverInfoHeaders(resp.Header); info != nil {
+			if !emit(ctx, events, StreamEvent{Fields: info, Header: true}) {
+				return
+			}
+		}
+		if id := resp.Header.Get("X-Request-ID"); id != "" {
+			if !emit(ctx, events, StreamEvent{Fields: map[string]interface{}{"requestId": id}, Header: true}) {
+				return
+			}
+		}
+		for {
+			event, err := nextEvent(decoder, inArray, cfg.JSONCompact)
+			if err == io.EOF {
+				fmt.Println("\nStream ended.")
+				return
+			}
+			if err != nil {
+				emit(ctx, events, StreamEvent{Err: fmt.Errorf("error reading JSON stream: %w", err)})
+				return
+			}
+			if !emit(ctx, events, StreamEvent{Fields: event}) {
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+// serverInfoHeaders turns version headers into a serverInfo event, so they
+// are checked like a server that sends the event itself.
+func serverInfoHeaders(h http.Header) map[string]interface{} {
+	schema, server := h.Get("X-Schema-Version"), h.Get("X-Server-Version")
+	if schema == "" && server == "" {
+		return nil
+	}
+	return map[string]interface{}{"dataType": "serverInfo", "schemaVersion": schema, "serverVersion": server}
+}
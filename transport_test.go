@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newHTTPTestConfig points the HTTP transport at a server that answers
+// every request with body.
+func newHTTPTestConfig(t testing.TB, body string) *Config {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	cfg := &Config{client: server.Client(), endpoint: server.URL}
+	cfg.transport = &httpTransport{cfg: cfg}
+	return cfg
+}
+
+// TestHTTPTransportPreamble checks that a byte order mark or whitespace in
+// front of the first event, as some proxies add, doesn't break the stream.
+func TestHTTPTransportPreamble(t *testing.T) {
+	const events = `{"dataType": "calculatedCoverage", "calculatedCoverage": "Current coverage is 40%"}
+{"dataType": "summary", "coverageIncreased": "Coverage increased from 40% to 75%", "linesCovered": "15", "totalLines": "20", "testAdded": "2"}
+`
+	const array = `[{"dataType": "calculatedCoverage", "calculatedCoverage": "Current coverage is 40%"},
+{"dataType": "summary", "coverageIncreased": "Coverage increased from 40% to 75%", "linesCovered": "15", "totalLines": "20", "testAdded": "2"}]
+`
+	for _, tc := range []struct{ name, body string }{
+		{"byte order mark", "\xef\xbb\xbf" + events},
+		{"leading whitespace", " \r\n\t\n" + events},
+		{"byte order mark and whitespace", "\xef\xbb\xbf\r\n  " + events},
+		{"byte order mark before an array", "\xef\xbb\xbf\n" + array},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			metrics, err := streamMetrics(newHTTPTestConfig(t, tc.body), GenerateTestRequest{SrcFilePath: "app.py"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if metrics.InitialCoverage != 40 || metrics.FinalCoverage != 75 || metrics.TestAdded != 2 || len(metrics.Warnings) != 0 {
+				t.Errorf("got %+v", metrics)
+			}
+		})
+	}
+}
+
+// BenchmarkReadBuffer streams fat and small events through the HTTP
+// transport at several -read-buffer sizes.
+func BenchmarkReadBuffer(b *testing.B) {
+	for _, stream := range []struct {
+		name string
+		body string
+	}{
+		{"256KiB events", syntheticStream(64, 256<<10)},
+		{"small events", syntheticStream(100000, 20)},
+	} {
+		for _, size := range []int{1 << 10, 4 << 10, 64 << 10, 1 << 20} {
+			b.Run(fmt.Sprintf("%s/%dKiB", stream.name, size>>10), func(b *testing.B) {
+				cfg := newHTTPTestConfig(b, stream.body)
+				cfg.ReadBuffer = size
+				discardStdout(b)
+				b.SetBytes(int64(len(stream.body)))
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := streamMetrics(cfg, GenerateTestRequest{SrcFilePath: "app.py"}); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// emptyReader returns no bytes and no error, which io.Reader allows.
+type emptyReader struct{}
+
+func (emptyReader) Read([]byte) (int, error) { return 0, nil }
+
+// TestLimitedReader checks what a read past -max-response-bytes reports:
+// EOF for a body of exactly the limit, errResponseTooLarge for more, and
+// io.ErrNoProgress for a reader that never answers the probe.
+func TestLimitedReader(t *testing.T) {
+	tests := []struct {
+		name string
+		r    io.Reader
+		want error
+	}{
+		{"exact", strings.NewReader("abcd"), io.EOF},
+		{"too large", strings.NewReader("abcde"), errResponseTooLarge},
+		{"no progress", io.MultiReader(strings.NewReader("abcd"), emptyReader{}), io.ErrNoProgress},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &limitedReader{r: tt.r, remaining: 4}
+			data, err := io.ReadAll(l)
+			if tt.want == io.EOF {
+				if err != nil || string(data) != "abcd" {
+					t.Errorf("got %q, %v; want %q, nil", data, err, "abcd")
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestHTTPTransportFraming checks that events are read whether the server
+// sends NDJSON, concatenated objects or a JSON array, and that an array
+// cut short fails the file.
+func TestHTTPTransportFraming(t *testing.T) {
+	const coverage = `{"dataType": "calculatedCoverage", "calculatedCoverage": "Current coverage is 40%"}`
+	const summary = `{"dataType": "summary", "coverageIncreased": "Coverage increased from 40% to 75%", "linesCovered": "15", "totalLines": "20", "testAdded": "2"}`
+	for _, tc := range []struct{ name, body string }{
+		{"ndjson", coverage + "\n" + summary + "\n"},
+		{"concatenated", coverage + summary},
+		{"array", "[\n  " + coverage + ",\n  " + summary + "\n]\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			metrics, err := streamMetrics(newHTTPTestConfig(t, tc.body), GenerateTestRequest{SrcFilePath: "app.py"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if metrics.InitialCoverage != 40 || metrics.FinalCoverage != 75 || metrics.Incomplete {
+				t.Errorf("got %+v", metrics)
+			}
+		})
+	}
+
+	_, err := streamMetrics(newHTTPTestConfig(t, "["+coverage+","), GenerateTestRequest{SrcFilePath: "app.py"})
+	if err == nil {
+		t.Error("truncated array accepted")
+	}
+}
+
+// TestDumpRequests checks that -dump-requests prints the headers and the
+// indented body with the API token redacted.
+func TestDumpRequests(t *testing.T) {
+	cfg := newHTTPTestConfig(t, `{"dataType": "summary", "coverageIncreased": "Coverage increased to 50%"}`)
+	cfg.APIToken, cfg.DumpRequests = "secret-token", true
+	out := captureStdout(t, func() {
+		if _, err := streamMetrics(cfg, GenerateTestRequest{SrcFilePath: "app.py", ExpectedCoverage: 80}); err != nil {
+			t.Error(err)
+		}
+	})
+	for _, want := range []string{"Request: POST " + cfg.endpoint, "Authorization: <redacted>", "Content-Type: application/json", "\n  \"sourceFilePath\": \"app.py\",\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "secret-token") {
+		t.Errorf("output shows the API token:\n%s", out)
+	}
+}
+
+// endlessTransport streams coverage events until the consumer cancels,
+// then closes done.
+type endlessTransport struct {
+	done chan struct{}
+}
+
+func (t endlessTransport) Stream(ctx context.Context, req GenerateTestRequest) (<-chan StreamEvent, error) {
+	events := make(chan StreamEvent)
+	go func() {
+		defer close(t.done)
+		defer close(events)
+		for emit(ctx, events, coverageEvent("60%")) {
+		}
+	}()
+	return events, nil
+}
+
+// TestStreamCancel checks that a consumer returning early cancels the
+// transport's stream rather than leaving it blocked on the channel.
+func TestStreamCancel(t *testing.T) {
+	transport := endlessTransport{make(chan struct{})}
+	cfg := &Config{transport: transport, StopAtExpected: true}
+	metrics, err := streamMetrics(cfg, GenerateTestRequest{SrcFilePath: "app.py", ExpectedCoverage: 50})
+	if err != nil || !metrics.StoppedEarly {
+		t.Fatalf("got %+v, error %v", metrics, err)
+	}
+	select {
+	case <-transport.done:
+	case <-time.After(5 * time.Second):
+		t.Error("stream still running after streamMetrics returned")
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// runValidateReport checks a report written by an earlier run, merge or
+// append: the header must hold known, distinct columns, every row must read
+// back as a result, and an Excel report's Tags sheet must match the totals
+// recomputed from its rows. Every problem is listed before exiting.
+func runValidateReport(path string) int {
+	keys, rows, err := readReportTable(path)
+	if err != nil {
+		fmt.Printf("Error reading report %s: %v\n", path, err)
+		return exitFatal
+	}
+
+	problems := validateHeader(keys)
+	var results []Result
+	for i, row := range rows {
+		r, rowProblems := validateRow(row)
+		for _, p := range rowProblems {
+			problems = append(problems, fmt.Sprintf("row %d (%s): %s", i+1, row["path"], p))
+		}
+		results = append(results, r)
+	}
+	if strings.HasSuffix(strings.ToLower(path), ".xlsx") {
+		tagProblems, err := validateTagSheet(path, results)
+		if err != nil {
+			fmt.Printf("Error reading report %s: %v\n", path, err)
+			return exitFatal
+		}
+		problems = append(problems, tagProblems...)
+	}
+
+	if len(problems) > 0 {
+		fmt.Printf("Report %s has %d problems:\n", path, len(problems))
+		for _, p := range problems {
+			fmt.Println("  " + p)
+		}
+		return exitFatal
+	}
+	fmt.Printf("Report %s is valid: %d columns, %d rows\n", path, len(keys), len(rows))
+	return exitOK
+}
+
+func validateHeader(keys []string) []string {
+	var problems []string
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if columnByKey(key) == nil {
+			problems = append(problems, fmt.Sprintf("header: unknown column %q", key))
+		}
+		if seen[key] {
+			problems = append(problems, fmt.Sprintf("header: column %q appears more than once", key))
+		}
+		seen[key] = true
+	}
+	return problems
+}
+
+var knownStatuses = []string{statusOK, statusError, statusNoLines, statusStopped, statusIncomplete, statusUnsupported}
+
+// validateRow reads a row back as a result, as -merge does, and checks the
+// values for consistency.
+func validateRow(row ReportRow) (Result, []string) {
+	var problems []string
+	r, err := rowToResult(row)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	if row["path"] == "" {
+		problems = append(problems, "empty path")
+	}
+	if !contains(knownStatuses, r.Status) {
+		problems = append(problems, fmt.Sprintf("unknown status %q", r.Status))
+	}
+	for _, key := range []string{"flaky_runs", "b_initial_coverage", "b_final_coverage", "b_tests_added", "delta_final_coverage", "delta_tests_added"} {
+		if row[key] == "" {
+			continue
+		}
+		if _, err := strconv.ParseFloat(row[key], 64); err != nil {
+			problems = append(problems, fmt.Sprintf("invalid %s %q", key, row[key]))
+		}
+	}
+	for _, key := range []string{"initial_coverage", "final_coverage"} {
+		if v, err := strconv.ParseFloat(row[key], 64); err == nil && (v < 0 || v > 100) {
+			problems = append(problems, fmt.Sprintf("%s %s is outside 0-100", key, row[key]))
+		}
+	}
+	if r.Metrics.LinesCovered > r.Metrics.TotalLines && row["total_lines"] != "" {
+		problems = append(problems, fmt.Sprintf("lines covered %s exceed total lines %s", row["lines_covered"], row["total_lines"]))
+	}
+	return r, problems
+}
+
+// validateTagSheet compares the Tags sheet's aggregate rows with the ones
+// writeTagSheet would compute from the report's rows now.
+func validateTagSheet(path string, results []Result) ([]string, error) {
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open report: %w", err)
+	}
+	defer f.Close()
+	if idx, _ := f.GetSheetIndex("Tags"); idx < 0 {
+		return nil, nil
+	}
+	table, err := f.GetRows("Tags", excelize.Options{RawCellValue: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Tags sheet: %w", err)
+	}
+
+	names, summaries := tagSummaries(results)
+	var problems []string
+	found := make(map[string]bool)
+	for _, record := range table[min(1, len(table)):] {
+		if len(record) == 0 {
+			continue
+		}
+		tag := record[0]
+		found[tag] = true
+		s, ok := summaries[tag]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("Tags sheet: tag %q has no rows in the report", tag))
+			continue
+		}
+		want := []float64{float64(s.Processed), roundTo(s.InitialCoverage(), 2), roundTo(s.FinalCoverage(), 2), s.TotalLines, s.TestsAdded}
+		headers := []string{"files", "initial coverage", "final coverage", "total lines", "tests added"}
+		for i, w := range want {
+			cell := ""
+			if i+1 < len(record) {
+				cell = record[i+1]
+			}
+			got, err := strconv.ParseFloat(cell, 64)
+			if err != nil || math.Abs(got-w) > 0.005 {
+				problems = append(problems, fmt.Sprintf("Tags sheet: tag %q has %s %q, recomputed %v", tag, headers[i], cell, w))
+			}
+		}
+	}
+	for _, tag := range names {
+		if !found[tag] {
+			problems = append(problems, fmt.Sprintf("Tags sheet: tag %q is missing", tag))
+		}
+	}
+	return problems, nil
+}
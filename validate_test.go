@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestValidateReport checks that a report written by a run validates, and
+// that a malformed one lists each problem and exits non-zero.
+func TestValidateReport(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.csv")
+	end := time.Date(2024, 3, 9, 15, 0, 0, 0, time.UTC)
+	writeReport(t, valid, reportColumns(&Config{}), Result{Path: "a.py", Status: statusOK, StartTime: end.Add(-time.Minute), EndTime: end, Duration: time.Minute,
+		Metrics: Metrics{InitialCoverage: 10, FinalCoverage: 60, LinesCovered: 6, TotalLines: 10}})
+	var code int
+	out := captureStdout(t, func() { code = runValidateReport(valid) })
+	if code != exitOK || !strings.Contains(out, "is valid") {
+		t.Errorf("valid report: exit code %d, output:\n%s", code, out)
+	}
+
+	invalid := filepath.Join(dir, "invalid.csv")
+	report := "Filepath,Status,Final Coverage,Lines Covered,Total Lines,Status\na.py,done,150,12,10,done\n"
+	if err := os.WriteFile(invalid, []byte(report), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out = captureStdout(t, func() { code = runValidateReport(invalid) })
+	if code != exitFatal {
+		t.Errorf("invalid report: exit code %d, want %d", code, exitFatal)
+	}
+	for _, want := range []string{`column "status" appears more than once`, `unknown status "done"`, "final_coverage 150 is outside 0-100", "lines covered 12 exceed total lines 10"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("invalid report output lacks %q:\n%s", want, out)
+		}
+	}
+
+	if code := runValidateReport(filepath.Join(dir, "missing.csv")); code != exitFatal {
+		t.Errorf("missing report: exit code %d, want %d", code, exitFatal)
+	}
+}
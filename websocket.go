@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// websocketTransport sends the request as the first message on a websocket
+// to the generate endpoint and receives one JSON event per message until
+// the server closes the connection. When the stream is abandoned, for
+// example by -stop-at-expected, it sends a {"type":"cancel"} control frame
+// so the server can stop generating before the connection closes.
+type websocketTransport struct {
+	cfg *Config
+}
+
+type controlMessage struct {
+	Type string `json:"type"`
+}
+
+func (t *websocketTransport) Stream(ctx context.Context, req GenerateTestRequest) (<-chan StreamEvent, error) {
+	cfg := t.cfg
+	wsURL := "ws" + strings.TrimPrefix(cfg.endpoint, "http")
+	config, err := websocket.NewConfig(wsURL, cfg.APIURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid websocket URL %q: %w", wsURL, err)
+	}
+	if cfg.APIToken != "" {
+		config.Header.Set("Authorization", "Bearer "+cfg.APIToken)
+	}
+
+	ws, err := config.DialContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect websocket: %w", err)
+	}
+	if cfg.Timeout > 0 {
+		ws.SetDeadline(time.Now().Add(cfg.Timeout))
+	}
+	if err := websocket.JSON.Send(ws, req); err != nil {
+		ws.Close()
+		return nil, fmt.Errorf("failed to send websocket request: %w", err)
+	}
+	fmt.Printf("Streaming response for %s:\n", req.SrcFilePath)
+
+	// ended is closed once the server has finished the stream; until then
+	// a done ctx means the client abandoned it.
+	events := make(chan StreamEvent)
+	ended := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			websocket.JSON.Send(ws, controlMessage{Type: "cancel"})
+		case <-ended:
+		}
+		ws.Close()
+	}()
+	go func() {
+		defer close(events)
+		for {
+			var event map[string]interface{}
+			err := websocket.JSON.Receive(ws, &event)
+			if err == io.EOF {
+				fmt.Println("\nStream ended.")
+				close(ended)
+				return
+			}
+			if err != nil {
+				close(ended)
+				emit(ctx, events, StreamEvent{Err: fmt.Errorf("error reading websocket stream: %w", err)})
+				return
+			}
+			if !emit(ctx, events, StreamEvent{Fields: event}) {
+				return
+			}
+		}
+	}()
+	return events, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// TestWebsocketCancel checks that abandoning a websocket stream, here with
+// -stop-at-expected, sends the server a cancel control frame.
+func TestWebsocketCancel(t *testing.T) {
+	controls := make(chan controlMessage, 1)
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		var req GenerateTestRequest
+		if err := websocket.JSON.Receive(ws, &req); err != nil {
+			return
+		}
+		websocket.JSON.Send(ws, map[string]string{"dataType": "calculatedCoverage", "calculatedCoverage": "Current coverage is 40%"})
+		websocket.JSON.Send(ws, map[string]string{"dataType": "calculatedCoverage", "calculatedCoverage": "Current coverage is 85%"})
+		var control controlMessage
+		if err := websocket.JSON.Receive(ws, &control); err == nil {
+			controls <- control
+		}
+	}))
+	defer server.Close()
+
+	cfg := &Config{APIURL: server.URL, endpoint: server.URL + "/api/generate", StopAtExpected: true}
+	cfg.transport = &websocketTransport{cfg: cfg}
+	metrics, err := streamMetrics(cfg, GenerateTestRequest{SrcFilePath: "app.py", ExpectedCoverage: 80})
+	if err != nil || !metrics.StoppedEarly || metrics.FinalCoverage != 85 {
+		t.Fatalf("got %+v, error %v", metrics, err)
+	}
+	select {
+	case control := <-controls:
+		if control.Type != "cancel" {
+			t.Errorf("got control frame %+v, want cancel", control)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("server received no cancel control frame")
+	}
+}